@@ -0,0 +1,168 @@
+package tgclient
+
+import (
+	"context"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// CallbackQuery describes inline keyboard button press on a regular message
+// (from TL_updateBotCallbackQuery) or on a message sent via inline mode
+// (from TL_updateInlineBotCallbackQuery, InlineMsgID is set and Peer is nil).
+type CallbackQuery struct {
+	QueryID       int64
+	UserID        int64
+	Peer          mtproto.TL // Peer: TL_peerUser | TL_peerChat | TL_peerChannel
+	MsgID         int32
+	InlineMsgID   mtproto.TL // InputBotInlineMessageID
+	ChatInstance  int64
+	Data          []byte
+	GameShortName string
+	Update        mtproto.TL
+}
+
+// OnInlineQuery subscribes handler to inline queries sent to the bot. See AnswerInlineQuery.
+func (d *Dispatcher) OnInlineQuery(handler func(mtproto.TL_updateBotInlineQuery), filters ...UpdateFilter) {
+	On(d, handler, filters...)
+}
+
+// OnCallbackQuery subscribes handler to inline keyboard button presses. See AnswerCallbackQuery.
+func (d *Dispatcher) OnCallbackQuery(handler func(CallbackQuery), filters ...UpdateFilter) {
+	On(d, func(upd mtproto.TL_updateBotCallbackQuery) {
+		handler(CallbackQuery{
+			QueryID: upd.QueryID, UserID: upd.UserID, Peer: upd.Peer, MsgID: upd.MsgID,
+			ChatInstance: upd.ChatInstance, Data: upd.Data, GameShortName: mtproto.DerefOr(upd.GameShortName, ""),
+			Update: upd,
+		})
+	}, filters...)
+	On(d, func(upd mtproto.TL_updateInlineBotCallbackQuery) {
+		handler(CallbackQuery{
+			QueryID: upd.QueryID, UserID: upd.UserID, InlineMsgID: upd.MsgID,
+			ChatInstance: upd.ChatInstance, Data: upd.Data, GameShortName: mtproto.DerefOr(upd.GameShortName, ""),
+			Update: upd,
+		})
+	}, filters...)
+}
+
+// InlineArticle returns inline query result which sends text message.
+func InlineArticle(id, title, description, text string, entities []mtproto.TL) mtproto.TL_inputBotInlineResult {
+	res := mtproto.TL_inputBotInlineResult{
+		ID:          id,
+		Type:        "article",
+		Title:       &title,
+		SendMessage: mtproto.TL_inputBotInlineMessageText{Message: text, Entities: entities},
+	}
+	if description != "" {
+		res.Description = &description
+	}
+	return res
+}
+
+// InlinePhoto returns inline query result which sends already uploaded photo with caption.
+func InlinePhoto(id string, photo mtproto.TL_InputPhoto, caption string) mtproto.TL_inputBotInlineResultPhoto {
+	return mtproto.TL_inputBotInlineResultPhoto{
+		ID:          id,
+		Type:        "photo",
+		Photo:       photo,
+		SendMessage: mtproto.TL_inputBotInlineMessageMediaAuto{Message: caption},
+	}
+}
+
+// InlineDocument returns inline query result which sends already uploaded document with caption.
+// Type is one of "file", "video", "audio", "voice", "gif", "sticker".
+func InlineDocument(id, typ, title string, document mtproto.TL_InputDocument, caption string) mtproto.TL_inputBotInlineResultDocument {
+	return mtproto.TL_inputBotInlineResultDocument{
+		ID:          id,
+		Type:        typ,
+		Title:       &title,
+		Document:    document,
+		SendMessage: mtproto.TL_inputBotInlineMessageMediaAuto{Message: caption},
+	}
+}
+
+// InlineAnswerOpts are optional AnswerInlineQuery parameters.
+type InlineAnswerOpts struct {
+	CacheTime  int32  // seconds, server default (300) is used if zero
+	Private    bool   // results may be cached only for the user who sent the query
+	Gallery    bool   // show results as a gallery (for media results)
+	NextOffset string // passed back in the next query (as Offset) when user scrolls results
+}
+
+// AnswerInlineQuery sends results (see InlineArticle, InlinePhoto, InlineDocument)
+// for inline query queryID. Opts may be nil.
+func (c *TGClient) AnswerInlineQuery(queryID int64, results []mtproto.TL_InputBotInlineResult, opts *InlineAnswerOpts) error {
+	return c.AnswerInlineQueryCtx(context.Background(), queryID, results, opts)
+}
+
+// AnswerInlineQueryCtx is AnswerInlineQuery with context, see SendSyncCtx.
+func (c *TGClient) AnswerInlineQueryCtx(ctx context.Context, queryID int64, results []mtproto.TL_InputBotInlineResult, opts *InlineAnswerOpts) error {
+	if opts == nil {
+		opts = &InlineAnswerOpts{}
+	}
+	resultsTL := make([]mtproto.TL, len(results))
+	for i, r := range results {
+		resultsTL[i] = r
+	}
+	req := mtproto.TL_messages_setInlineBotResults{
+		Gallery:   opts.Gallery,
+		Private:   opts.Private,
+		QueryID:   queryID,
+		Results:   resultsTL,
+		CacheTime: opts.CacheTime,
+	}
+	if req.CacheTime == 0 {
+		req.CacheTime = 300
+	}
+	if opts.NextOffset != "" {
+		req.NextOffset = &opts.NextOffset
+	}
+	res, err := c.SendSyncCtx(ctx, req)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if _, ok := res.(mtproto.TL_boolTrue); !ok {
+		return merry.Wrap(mtproto.WrongRespError(res))
+	}
+	return nil
+}
+
+// CallbackAnswerOpts are optional AnswerCallbackQuery parameters.
+type CallbackAnswerOpts struct {
+	Text      string // notification text shown to user
+	Alert     bool   // show text as an alert instead of a toast
+	URL       string // URL to open (for games and t.me/bot?start= links)
+	CacheTime int32  // seconds
+}
+
+// AnswerCallbackQuery answers callback query (button press must be answered,
+// otherwise client shows progress indicator). Opts may be nil.
+func (c *TGClient) AnswerCallbackQuery(queryID int64, opts *CallbackAnswerOpts) error {
+	return c.AnswerCallbackQueryCtx(context.Background(), queryID, opts)
+}
+
+// AnswerCallbackQueryCtx is AnswerCallbackQuery with context, see SendSyncCtx.
+func (c *TGClient) AnswerCallbackQueryCtx(ctx context.Context, queryID int64, opts *CallbackAnswerOpts) error {
+	if opts == nil {
+		opts = &CallbackAnswerOpts{}
+	}
+	req := mtproto.TL_messages_setBotCallbackAnswer{
+		Alert:     opts.Alert,
+		QueryID:   queryID,
+		CacheTime: opts.CacheTime,
+	}
+	if opts.Text != "" {
+		req.Message = &opts.Text
+	}
+	if opts.URL != "" {
+		req.URL = &opts.URL
+	}
+	res, err := c.SendSyncCtx(ctx, req)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if _, ok := res.(mtproto.TL_boolTrue); !ok {
+		return merry.Wrap(mtproto.WrongRespError(res))
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package tgclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// BulkProgressHandler receives total number of affected messages after each processed chunk.
+type BulkProgressHandler func(affectedCount int)
+
+// repeatAffectedHistory sends request until whole history is processed.
+// Methods returning messages.affectedHistory process history in chunks and
+// return positive offset if request must be repeated for next chunk.
+// https://core.telegram.org/constructor/messages.affectedHistory
+func (c *TGClient) repeatAffectedHistory(ctx context.Context, req mtproto.TLReq, progressHnd BulkProgressHandler) (int, error) {
+	total := 0
+	for {
+		res, err := c.SendSyncRetryCtx(ctx, req, time.Second, 0, 30*time.Second)
+		if err != nil {
+			return total, merry.Wrap(err)
+		}
+		affected, ok := res.(mtproto.TL_messages_affectedHistory)
+		if !ok {
+			return total, mtproto.WrongRespError(res)
+		}
+		// affected messages are not sent as updates, so pts should be applied here to avoid false gaps
+		c.updates.processAffectedPTS(affectedChannelID(req), affected.PTS, affected.PTSCount)
+		total += int(affected.PTSCount)
+		if progressHnd != nil {
+			progressHnd(total)
+		}
+		if affected.Offset <= 0 {
+			return total, nil
+		}
+	}
+}
+
+// affectedChannelID returns channel ID if request affects channel history (and returns channel pts).
+func affectedChannelID(req mtproto.TLReq) int64 {
+	var peer mtproto.TL
+	switch x := req.(type) {
+	case mtproto.TL_channels_deleteParticipantHistory:
+		peer = x.Channel
+	case mtproto.TL_messages_deleteHistory:
+		peer = x.Peer
+	case mtproto.TL_messages_readMentions:
+		peer = x.Peer
+	case mtproto.TL_messages_unpinAllMessages:
+		peer = x.Peer
+	}
+	switch x := peer.(type) {
+	case mtproto.TL_inputChannel:
+		return x.ChannelID
+	case mtproto.TL_inputPeerChannel:
+		return x.ChannelID
+	}
+	return 0
+}
+
+// DeleteHistory deletes whole chat history. If revoke is true, messages are deleted for all participants.
+// Returns number of affected messages.
+func (c *TGClient) DeleteHistory(peer mtproto.TL_InputPeer, revoke bool, progressHnd BulkProgressHandler) (int, error) {
+	return c.DeleteHistoryCtx(context.Background(), peer, revoke, progressHnd)
+}
+
+// DeleteHistoryCtx is DeleteHistory with context, see SendSyncCtx.
+func (c *TGClient) DeleteHistoryCtx(ctx context.Context, peer mtproto.TL_InputPeer, revoke bool, progressHnd BulkProgressHandler) (int, error) {
+	inputPeer, err := c.toInputPeer(peer)
+	if err != nil {
+		return 0, merry.Wrap(err)
+	}
+	count, err := c.repeatAffectedHistory(ctx, mtproto.TL_messages_deleteHistory{
+		Peer:   inputPeer,
+		Revoke: revoke,
+	}, progressHnd)
+	return count, merry.Wrap(err)
+}
+
+// DeleteUserHistory deletes all messages sent by participant in channel (supergroup).
+func (c *TGClient) DeleteUserHistory(channel mtproto.TL_InputChannel, participant mtproto.TL_InputPeer, progressHnd BulkProgressHandler) (int, error) {
+	return c.DeleteUserHistoryCtx(context.Background(), channel, participant, progressHnd)
+}
+
+// DeleteUserHistoryCtx is DeleteUserHistory with context, see SendSyncCtx.
+func (c *TGClient) DeleteUserHistoryCtx(ctx context.Context, channel mtproto.TL_InputChannel, participant mtproto.TL_InputPeer, progressHnd BulkProgressHandler) (int, error) {
+	inputChannel, err := c.toInputChannel(channel)
+	if err != nil {
+		return 0, merry.Wrap(err)
+	}
+	inputParticipant, err := c.toInputPeer(participant)
+	if err != nil {
+		return 0, merry.Wrap(err)
+	}
+	count, err := c.repeatAffectedHistory(ctx, mtproto.TL_channels_deleteParticipantHistory{
+		Channel:     inputChannel,
+		Participant: inputParticipant,
+	}, progressHnd)
+	return count, merry.Wrap(err)
+}
+
+// ReadAllMentions marks all mentions in chat as read.
+func (c *TGClient) ReadAllMentions(peer mtproto.TL_InputPeer, progressHnd BulkProgressHandler) (int, error) {
+	return c.ReadAllMentionsCtx(context.Background(), peer, progressHnd)
+}
+
+// ReadAllMentionsCtx is ReadAllMentions with context, see SendSyncCtx.
+func (c *TGClient) ReadAllMentionsCtx(ctx context.Context, peer mtproto.TL_InputPeer, progressHnd BulkProgressHandler) (int, error) {
+	inputPeer, err := c.toInputPeer(peer)
+	if err != nil {
+		return 0, merry.Wrap(err)
+	}
+	count, err := c.repeatAffectedHistory(ctx, mtproto.TL_messages_readMentions{
+		Peer: inputPeer,
+	}, progressHnd)
+	return count, merry.Wrap(err)
+}
+
+// UnpinAllMessages unpins all pinned messages in chat.
+func (c *TGClient) UnpinAllMessages(peer mtproto.TL_InputPeer, progressHnd BulkProgressHandler) (int, error) {
+	return c.UnpinAllMessagesCtx(context.Background(), peer, progressHnd)
+}
+
+// UnpinAllMessagesCtx is UnpinAllMessages with context, see SendSyncCtx.
+func (c *TGClient) UnpinAllMessagesCtx(ctx context.Context, peer mtproto.TL_InputPeer, progressHnd BulkProgressHandler) (int, error) {
+	inputPeer, err := c.toInputPeer(peer)
+	if err != nil {
+		return 0, merry.Wrap(err)
+	}
+	count, err := c.repeatAffectedHistory(ctx, mtproto.TL_messages_unpinAllMessages{
+		Peer: inputPeer,
+	}, progressHnd)
+	return count, merry.Wrap(err)
+}
+
+// PinMessage pins message in chat. If silent is true, chat members will not be notified.
+func (c *TGClient) PinMessage(peer mtproto.TL_InputPeer, msgID int32, silent bool) error {
+	return c.PinMessageCtx(context.Background(), peer, msgID, silent)
+}
+
+// PinMessageCtx is PinMessage with context, see SendSyncCtx.
+func (c *TGClient) PinMessageCtx(ctx context.Context, peer mtproto.TL_InputPeer, msgID int32, silent bool) error {
+	inputPeer, err := c.toInputPeer(peer)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	return c.updatePinnedMessage(ctx, mtproto.TL_messages_updatePinnedMessage{
+		Peer:   inputPeer,
+		ID:     msgID,
+		Silent: silent,
+	})
+}
+
+func (c *TGClient) UnpinMessage(peer mtproto.TL_InputPeer, msgID int32) error {
+	return c.UnpinMessageCtx(context.Background(), peer, msgID)
+}
+
+// UnpinMessageCtx is UnpinMessage with context, see SendSyncCtx.
+func (c *TGClient) UnpinMessageCtx(ctx context.Context, peer mtproto.TL_InputPeer, msgID int32) error {
+	inputPeer, err := c.toInputPeer(peer)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	return c.updatePinnedMessage(ctx, mtproto.TL_messages_updatePinnedMessage{
+		Peer:  inputPeer,
+		ID:    msgID,
+		Unpin: true,
+	})
+}
+
+func (c *TGClient) updatePinnedMessage(ctx context.Context, req mtproto.TL_messages_updatePinnedMessage) error {
+	res, err := c.SendSyncCtx(ctx, req)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if _, ok := res.(mtproto.TL_rpcError); ok {
+		return mtproto.WrongRespError(res)
+	}
+	c.handleEvent(res)
+	return nil
+}
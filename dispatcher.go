@@ -0,0 +1,174 @@
+package tgclient
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+)
+
+// ChatMemberUpdate describes participant change in a basic group (from TL_updateChatParticipant)
+// or in a channel/supergroup (from TL_updateChannelParticipant, IsChannel is set).
+// Prev and New are ChatParticipant or ChannelParticipant, nil if user was not/is not a participant.
+type ChatMemberUpdate struct {
+	ChatID    int64
+	IsChannel bool
+	UserID    int64
+	ActorID   int64
+	Date      int32
+	Prev      mtproto.TL
+	New       mtproto.TL
+	Invite    mtproto.TL // (optional) ExportedChatInvite used to join
+	Update    mtproto.TL
+}
+
+// ConnectionRestored is emitted after reconnection when updates state is re-synced.
+// If CaughtUp is false, updates sent while client was offline were skipped (see TGClient.SetCatchUp),
+// so consumers may need to reconcile their state (reload dialogs, etc.).
+type ConnectionRestored struct {
+	CaughtUp bool
+	State    mtproto.TL_updates_state
+}
+
+// Dispatcher routes updates to handlers subscribed to specific update constructors
+// (see On) or to some common events (new/edited/deleted messages, etc.).
+// Handlers are called synchronously in order of subscription.
+// Each subscription may have filters (see UpdateFilter), handler is called only if all of them pass.
+type Dispatcher struct {
+	mutex    sync.RWMutex
+	byType   map[reflect.Type][]subscription
+	handlers []subscription
+	single   UpdateHandler // set by SetUpdateHandler, called after subscriptions
+
+	connRestoredHandlers []func(ConnectionRestored)
+}
+
+type subscription struct {
+	handler UpdateHandler
+	filters []UpdateFilter
+}
+
+func (s subscription) call(update mtproto.TL) {
+	for _, filter := range s.filters {
+		if !filter(update) {
+			return
+		}
+	}
+	s.handler(update)
+}
+
+func newDispatcher() *Dispatcher {
+	return &Dispatcher{byType: make(map[reflect.Type][]subscription)}
+}
+
+// On subscribes handler to updates of type T, for example:
+//
+//	tgclient.On(tg.Dispatcher(), func(upd mtproto.TL_updateUserTyping) { ... })
+func On[T mtproto.TL](d *Dispatcher, handler func(T), filters ...UpdateFilter) {
+	var zero T
+	d.subscribe(subscription{handler2update(handler), filters}, reflect.TypeOf(zero))
+}
+
+func handler2update[T mtproto.TL](handler func(T)) UpdateHandler {
+	return func(update mtproto.TL) { handler(update.(T)) }
+}
+
+// OnUpdate subscribes handler to all updates.
+func (d *Dispatcher) OnUpdate(handler UpdateHandler, filters ...UpdateFilter) {
+	d.subscribe(subscription{handler, filters}, nil)
+}
+
+// OnNewMessage subscribes handler to new messages (TL_message or TL_messageService) in all chats.
+func (d *Dispatcher) OnNewMessage(handler func(message mtproto.TL), filters ...UpdateFilter) {
+	On(d, func(upd mtproto.TL_updateNewMessage) { handler(upd.Message) }, filters...)
+	On(d, func(upd mtproto.TL_updateNewChannelMessage) { handler(upd.Message) }, filters...)
+}
+
+// OnEditedMessage subscribes handler to message edits in all chats.
+func (d *Dispatcher) OnEditedMessage(handler func(message mtproto.TL), filters ...UpdateFilter) {
+	On(d, func(upd mtproto.TL_updateEditMessage) { handler(upd.Message) }, filters...)
+	On(d, func(upd mtproto.TL_updateEditChannelMessage) { handler(upd.Message) }, filters...)
+}
+
+// OnDeletedMessages subscribes handler to message deletions.
+// ChannelID is 0 for messages from private chats and basic groups.
+func (d *Dispatcher) OnDeletedMessages(handler func(channelID int64, msgIDs []int32), filters ...UpdateFilter) {
+	On(d, func(upd mtproto.TL_updateDeleteMessages) { handler(0, upd.Messages) }, filters...)
+	On(d, func(upd mtproto.TL_updateDeleteChannelMessages) { handler(upd.ChannelID, upd.Messages) }, filters...)
+}
+
+// OnUserStatus subscribes handler to users online status changes (TL_userStatusOnline, TL_userStatusOffline, etc.).
+func (d *Dispatcher) OnUserStatus(handler func(userID int64, status mtproto.TL), filters ...UpdateFilter) {
+	On(d, func(upd mtproto.TL_updateUserStatus) { handler(upd.UserID, upd.Status) }, filters...)
+}
+
+// OnChatMember subscribes handler to participant changes in groups and channels.
+func (d *Dispatcher) OnChatMember(handler func(ChatMemberUpdate), filters ...UpdateFilter) {
+	On(d, func(upd mtproto.TL_updateChatParticipant) {
+		handler(ChatMemberUpdate{
+			ChatID: upd.ChatID, UserID: upd.UserID, ActorID: upd.ActorID, Date: upd.Date,
+			Prev: upd.PrevParticipant, New: upd.NewParticipant, Invite: upd.Invite, Update: upd,
+		})
+	}, filters...)
+	On(d, func(upd mtproto.TL_updateChannelParticipant) {
+		handler(ChatMemberUpdate{
+			ChatID: upd.ChannelID, IsChannel: true, UserID: upd.UserID, ActorID: upd.ActorID, Date: upd.Date,
+			Prev: upd.PrevParticipant, New: upd.NewParticipant, Invite: upd.Invite, Update: upd,
+		})
+	}, filters...)
+}
+
+// SetUpdateHandler sets handler that receives all updates, replacing the one set before
+// (nil removes it). It is called after all subscriptions, unlike OnUpdate it may be set only once,
+// like the TGClient.SetUpdateHandler callback which it serves.
+func (d *Dispatcher) SetUpdateHandler(handler UpdateHandler) {
+	d.mutex.Lock()
+	d.single = handler
+	d.mutex.Unlock()
+}
+
+// OnConnectionRestored subscribes handler to ConnectionRestored events.
+func (d *Dispatcher) OnConnectionRestored(handler func(ConnectionRestored)) {
+	d.mutex.Lock()
+	d.connRestoredHandlers = append(d.connRestoredHandlers, handler)
+	d.mutex.Unlock()
+}
+
+func (d *Dispatcher) dispatchConnectionRestored(event ConnectionRestored) {
+	d.mutex.RLock()
+	handlers := d.connRestoredHandlers
+	d.mutex.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+func (d *Dispatcher) subscribe(sub subscription, updateType reflect.Type) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if updateType == nil {
+		// T is an interface (like mtproto.TL), handler accepts any update
+		d.handlers = append(d.handlers, sub)
+		return
+	}
+	d.byType[updateType] = append(d.byType[updateType], sub)
+}
+
+// Dispatch passes update to all handlers subscribed to it.
+func (d *Dispatcher) Dispatch(update mtproto.TL) {
+	d.mutex.RLock()
+	typed := d.byType[reflect.TypeOf(update)]
+	common := d.handlers
+	single := d.single
+	d.mutex.RUnlock()
+
+	for _, sub := range common {
+		sub.call(update)
+	}
+	for _, sub := range typed {
+		sub.call(update)
+	}
+	if single != nil {
+		single(update)
+	}
+}
@@ -0,0 +1,101 @@
+package tgclient
+
+import (
+	"reflect"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+)
+
+// UpdateFilter decides whether update should be passed to the handler.
+// Filters are evaluated by Dispatcher before calling handler, so irrelevant updates cost almost nothing.
+type UpdateFilter func(update mtproto.TL) bool
+
+// FilterPeer passes updates related to one of the peers (TL_peerUser, TL_peerChat or TL_peerChannel).
+// Peer is taken from the message (for message updates) or from ChannelID field (like in updateDeleteChannelMessages).
+func FilterPeer(peers ...mtproto.TL_Peer) UpdateFilter {
+	return func(update mtproto.TL) bool {
+		peer := updatePeer(update)
+		if peer == nil {
+			return false
+		}
+		for _, p := range peers {
+			if p == peer {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterIncoming passes only messages sent to current user.
+func FilterIncoming() UpdateFilter {
+	return func(update mtproto.TL) bool {
+		out, ok := updateMessageOut(update)
+		return ok && !out
+	}
+}
+
+// FilterOutgoing passes only messages sent by current user.
+func FilterOutgoing() UpdateFilter {
+	return func(update mtproto.TL) bool {
+		out, ok := updateMessageOut(update)
+		return ok && out
+	}
+}
+
+// FilterMedia passes only messages with media (photos, documents, polls, etc.).
+func FilterMedia() UpdateFilter {
+	return func(update mtproto.TL) bool {
+		msg, ok := updateMessage(update).(mtproto.TL_message)
+		if !ok || msg.Media == nil {
+			return false
+		}
+		_, isEmpty := msg.Media.(mtproto.TL_messageMediaEmpty)
+		return !isEmpty
+	}
+}
+
+// updateMessage returns message from message update.
+// Short message updates (updateShortMessage, updateShortChatMessage) are returned as is.
+func updateMessage(update mtproto.TL) mtproto.TL {
+	switch upd := update.(type) {
+	case mtproto.TL_updateNewMessage:
+		return upd.Message
+	case mtproto.TL_updateNewChannelMessage:
+		return upd.Message
+	case mtproto.TL_updateEditMessage:
+		return upd.Message
+	case mtproto.TL_updateEditChannelMessage:
+		return upd.Message
+	case mtproto.TL_updateShortMessage, mtproto.TL_updateShortChatMessage:
+		return upd
+	}
+	return nil
+}
+
+func updateMessageOut(update mtproto.TL) (bool, bool) {
+	msg := updateMessage(update)
+	if msg == nil {
+		return false, false
+	}
+	out := updateField(msg, "Out")
+	if out.Kind() != reflect.Bool {
+		return false, false
+	}
+	return out.Bool(), true
+}
+
+func updatePeer(update mtproto.TL) mtproto.TL_Peer {
+	switch msg := updateMessage(update).(type) {
+	case mtproto.TL_message, mtproto.TL_messageService:
+		return MessagePeer(msg)
+	case mtproto.TL_updateShortMessage:
+		return mtproto.TL_peerUser{UserID: msg.UserID}
+	case mtproto.TL_updateShortChatMessage:
+		return mtproto.TL_peerChat{ChatID: msg.ChatID}
+	}
+	if channelID := updateField(update, "ChannelID"); channelID.Kind() == reflect.Int64 {
+		return mtproto.TL_peerChannel{ChannelID: channelID.Int()}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package tgclient
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+)
+
+func TestDispatcher(t *testing.T) {
+	d := newDispatcher()
+	var log []string
+	d.OnUpdate(func(update mtproto.TL) { log = append(log, reflect.TypeOf(update).Name()) })
+	d.OnNewMessage(func(message mtproto.TL) { log = append(log, "new") })
+	d.OnDeletedMessages(func(channelID int64, msgIDs []int32) { log = append(log, "deleted") })
+	On(d, func(upd mtproto.TL_updateUserTyping) { log = append(log, "typing") })
+
+	d.Dispatch(mtproto.TL_updateNewChannelMessage{Message: mtproto.TL_message{}})
+	d.Dispatch(mtproto.TL_updateDeleteChannelMessages{ChannelID: 1})
+	d.Dispatch(mtproto.TL_updateUserTyping{})
+	d.Dispatch(mtproto.TL_updateUserStatus{})
+
+	expected := []string{
+		"TL_updateNewChannelMessage", "new",
+		"TL_updateDeleteChannelMessages", "deleted",
+		"TL_updateUserTyping", "typing",
+		"TL_updateUserStatus",
+	}
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("wrong handlers calls: %v", log)
+	}
+}
+
+func TestDispatcherFilters(t *testing.T) {
+	d := newDispatcher()
+	var ids []int32
+	handler := func(message mtproto.TL) { ids = append(ids, message.(mtproto.TL_message).ID) }
+	d.OnNewMessage(handler, FilterPeer(mtproto.TL_peerChannel{ChannelID: 1}), FilterIncoming())
+
+	newMsg := func(id int32, peer mtproto.TL, out bool) mtproto.TL {
+		return mtproto.TL_updateNewChannelMessage{Message: mtproto.TL_message{ID: id, PeerID: peer, Out: out}}
+	}
+	d.Dispatch(newMsg(1, mtproto.TL_peerChannel{ChannelID: 1}, false))
+	d.Dispatch(newMsg(2, mtproto.TL_peerChannel{ChannelID: 2}, false))
+	d.Dispatch(newMsg(3, mtproto.TL_peerChannel{ChannelID: 1}, true))
+	d.Dispatch(newMsg(4, mtproto.TL_peerUser{UserID: 1}, false))
+
+	if !reflect.DeepEqual(ids, []int32{1}) {
+		t.Errorf("wrong filtered messages: %v", ids)
+	}
+}
+
+func TestDispatcherSetUpdateHandler(t *testing.T) {
+	d := newDispatcher()
+	var log []string
+	d.SetUpdateHandler(func(update mtproto.TL) { log = append(log, "old") })
+	d.SetUpdateHandler(func(update mtproto.TL) { log = append(log, "single") })
+	d.OnUpdate(func(update mtproto.TL) { log = append(log, "any") })
+
+	d.Dispatch(mtproto.TL_updateUserTyping{})
+	d.SetUpdateHandler(nil)
+	d.Dispatch(mtproto.TL_updateUserTyping{})
+
+	if !reflect.DeepEqual(log, []string{"any", "single", "any"}) {
+		t.Errorf("wrong handlers calls: %v", log)
+	}
+}
+
+func TestUpdateWorkersPeerOrder(t *testing.T) {
+	c := &TGClient{log: mtproto.Logger{Hnd: mtproto.NoopLogHandler{}}, dispatcher: newDispatcher(), updateWorkersCount: 4}
+	received := make(map[int64][]int32)
+	mutex := sync.Mutex{}
+	c.Dispatcher().OnNewMessage(func(message mtproto.TL) {
+		msg := message.(mtproto.TL_message)
+		mutex.Lock()
+		received[msg.PeerID.(mtproto.TL_peerChannel).ChannelID] = append(received[msg.PeerID.(mtproto.TL_peerChannel).ChannelID], msg.ID)
+		mutex.Unlock()
+	})
+
+	c.startUpdateWorkers()
+	for id := int32(0); id < 100; id++ {
+		for channelID := int64(1); channelID <= 10; channelID++ {
+			peer := mtproto.TL_peerChannel{ChannelID: channelID}
+			c.handleUpdate(mtproto.TL_updateNewChannelMessage{Message: mtproto.TL_message{ID: id, PeerID: peer}})
+		}
+	}
+	c.stopUpdateWorkers()
+
+	for channelID, ids := range received {
+		for i, id := range ids {
+			if int32(i) != id {
+				t.Fatalf("wrong order for channel %d: %v", channelID, ids)
+			}
+		}
+	}
+	if len(received) != 10 {
+		t.Errorf("expected updates from 10 channels, got %d", len(received))
+	}
+}
@@ -1,11 +1,10 @@
 package tgclient
 
 import (
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -52,22 +51,47 @@ type FilePartsResult struct {
 	BytesWritten  int
 }
 
+// there may be several connections to the same DC, see DownloadFileParallel
+type fileMTKey struct {
+	dcID  int32
+	index int
+}
+
 type Downloader struct {
 	tg             *TGClient
-	fileMTs        map[int32]*mtproto.MTProto
+	fileMTs        map[fileMTKey]*mtproto.MTProto
 	fileMTsMutex   *sync.Mutex
 	filePartsQueue chan *filePart
 	routinesWG     sync.WaitGroup
 	log            mtproto.Logger
+	// PreferFastestDC makes downloader connect to the fastest (preferably media-only)
+	// DC address. Latencies should be measured first, see TGClient.StartDCLatencyProber.
+	PreferFastestDC bool
+	// VerifyHashes makes DownloadFile* functions check downloaded data with upload.getFileHashes.
+	// Chunks with mismatched hashes are re-fetched, download fails with ErrFileHashMismatch
+	// if mismatch persists. Not all locations support hashes (photos usually do not).
+	VerifyHashes bool
+	// Routines is a number of goroutines downloading parts requested via DownloadFile*
+	// (DefaultDownloadRoutines if zero). Should be set before InitAndConnect.
+	Routines int
 }
 
+const DefaultDownloadRoutines = 1
+
 func (d *Downloader) Start(tg *TGClient) {
 	d.tg = tg
-	d.fileMTs = make(map[int32]*mtproto.MTProto)
+	d.fileMTs = make(map[fileMTKey]*mtproto.MTProto)
 	d.fileMTsMutex = &sync.Mutex{}
 	d.filePartsQueue = make(chan *filePart, 1)
 	d.log = tg.log
-	go d.partsDownloadRoutine()
+	routines := d.Routines
+	if routines <= 0 {
+		routines = DefaultDownloadRoutines
+	}
+	d.routinesWG.Add(routines)
+	for i := 0; i < routines; i++ {
+		go d.partsDownloadRoutine()
+	}
 }
 
 func (d *Downloader) Stop() error {
@@ -77,9 +101,9 @@ func (d *Downloader) Stop() error {
 	d.fileMTsMutex.Lock()
 	defer d.fileMTsMutex.Unlock()
 	var err error
-	for dcID, mt := range d.fileMTs {
+	for key, mt := range d.fileMTs {
 		err = mt.Disconnect()
-		delete(d.fileMTs, dcID)
+		delete(d.fileMTs, key)
 	}
 	return merry.Wrap(err)
 }
@@ -182,6 +206,83 @@ func (d *Downloader) DownloadFileParts(
 	return partsRes, nil
 }
 
+// max upload.getFile limit, offsets are multiples of it
+const downloadChunkSize = 1024 * 1024
+
+// DownloadedFile is a result of DownloadFile.
+type DownloadedFile struct {
+	Size int64
+	Type mtproto.TL // storage.FileType: TL_storage_fileJPEG | TL_storage_fileMP4 | ...
+	DcID int32      // DC the file was actually downloaded from
+}
+
+// DownloadFile downloads whole file from location and writes it to w.
+// Parts are requested sequentially by 1MB, download is finished when a shorter part is received.
+// FILE_MIGRATE_X errors make the rest of the file to be downloaded from DC X.
+//
+// Download starts from the current DC. If file's DC is known (TL_document.DCID, TL_photo.DCID),
+// DownloadFileFromDC or DownloadMedia should be used instead to avoid the migration round-trip.
+func (d *Downloader) DownloadFile(location mtproto.TL_InputFileLocation, w io.Writer) (*DownloadedFile, error) {
+	return d.DownloadFileFromDC(location, d.tg.mt.CopySession().DCID, w)
+}
+
+// DownloadFileFromDC is like DownloadFile but requests file parts from DC dcID.
+// If it differs from the current DC, a separate connection is made with exported authorization.
+func (d *Downloader) DownloadFileFromDC(location mtproto.TL_InputFileLocation, dcID int32, w io.Writer) (*DownloadedFile, error) {
+	if dcID == 0 {
+		dcID = d.tg.mt.CopySession().DCID
+	}
+	res := &DownloadedFile{DcID: dcID}
+	mismatchCount := 0
+	for {
+		mt, err := d.getFileMT(res.DcID)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		resTL := mt.SendSync(mtproto.TL_upload_getFile{
+			Location: location,
+			Offset:   res.Size,
+			Limit:    downloadChunkSize,
+		})
+		switch part := resTL.(type) {
+		case mtproto.TL_upload_file:
+			d.tg.transferLimiter.Wait(len(part.Bytes))
+			if d.VerifyHashes {
+				if err := d.verifyFileHashes(mt, location, res.Size, part.Bytes); err != nil {
+					if errors.Is(err, ErrFileHashMismatch) && mismatchCount < hashMismatchRetries {
+						mismatchCount++
+						d.log.Warn("%s, re-fetching", err)
+						continue
+					}
+					return nil, merry.Wrap(err)
+				}
+				mismatchCount = 0
+			}
+			if _, err := w.Write(part.Bytes); err != nil {
+				return nil, merry.Wrap(err)
+			}
+			res.Size += int64(len(part.Bytes))
+			res.Type = part.Type
+			if len(part.Bytes) < downloadChunkSize {
+				return res, nil
+			}
+		case mtproto.TL_upload_fileCDNRedirect:
+			return nil, merry.New("cdn redirect: " + mtproto.Sprint(part))
+		default:
+			rpcErr, ok := mtproto.AsRPCError(resTL)
+			if !ok {
+				return nil, mtproto.WrongRespError(resTL)
+			}
+			newDcID, ok := rpcErr.MigrateDC()
+			if !ok || newDcID == res.DcID {
+				return nil, mtproto.WrongRespError(resTL)
+			}
+			d.log.Info("got %s, downloading from DC %d", rpcErr.FullMessage(), newDcID)
+			res.DcID = newDcID
+		}
+	}
+}
+
 func (d *Downloader) ReqestFilePart(dcID int32, fileLocation mtproto.TL, offset, limit int64) chan *FileResponse {
 	part := &filePart{
 		dcID:     dcID,
@@ -195,7 +296,6 @@ func (d *Downloader) ReqestFilePart(dcID int32, fileLocation mtproto.TL, offset,
 }
 
 func (d *Downloader) partsDownloadRoutine() {
-	d.routinesWG.Add(1)
 	for part := range d.filePartsQueue {
 		fileResp := FileResponse{DcID: part.dcID}
 		mt, err := d.getFileMT(part.dcID)
@@ -213,14 +313,14 @@ func (d *Downloader) partsDownloadRoutine() {
 
 		switch res := resTL.(type) {
 		case mtproto.TL_upload_file:
+			d.tg.transferLimiter.Wait(len(res.Bytes))
 			fileResp.Data = res.Bytes
 		case mtproto.TL_upload_fileCDNRedirect:
 			fileResp.Err = merry.New("cdn redirect: " + mtproto.Sprint(res))
 		case mtproto.TL_rpcError:
-			if strings.HasPrefix(res.ErrorMessage, "FILE_MIGRATE_") {
+			if newDcID, ok := mtproto.NewRPCError(res).MigrateDC(); ok {
 				d.log.Warn("got %s, part DC is %d", res.ErrorMessage, part.dcID)
-				id, _ := strconv.Atoi(res.ErrorMessage[13:])
-				part.dcID = int32(id)
+				part.dcID = newDcID
 				select {
 				case d.filePartsQueue <- part:
 					continue
@@ -241,19 +341,31 @@ func (d *Downloader) partsDownloadRoutine() {
 }
 
 func (d *Downloader) getFileMT(dcID int32) (*mtproto.MTProto, error) {
+	return d.getFileMTNum(dcID, 0)
+}
+
+// getFileMTNum returns index-th connection to the DC (creating it if needed).
+func (d *Downloader) getFileMTNum(dcID int32, index int) (*mtproto.MTProto, error) {
 	d.fileMTsMutex.Lock()
 	defer d.fileMTsMutex.Unlock()
 
-	if mt := d.fileMTs[dcID]; mt != nil {
+	key := fileMTKey{dcID, index}
+	if mt := d.fileMTs[key]; mt != nil {
 		return mt, nil
 	}
 
-	mt, err := d.tg.mt.NewConnection(dcID)
+	var mt *mtproto.MTProto
+	var err error
+	if d.PreferFastestDC {
+		mt, err = d.tg.mt.NewMediaConnection(dcID)
+	} else {
+		mt, err = d.tg.mt.NewConnection(dcID)
+	}
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
 
-	d.log.Info("connected to file DC %d", dcID)
-	d.fileMTs[dcID] = mt
+	d.log.Info("connected to file DC %d (#%d)", dcID, index)
+	d.fileMTs[key] = mt
 	return mt, nil
 }
@@ -0,0 +1,68 @@
+package tgclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+var ErrFileHashMismatch = merry.Sentinel("file part hash mismatch")
+
+// how many times a chunk is re-fetched after hash mismatch
+const hashMismatchRetries = 2
+
+// checkFileHashes verifies data (starting at offset) against SHA256 hashes of file ranges.
+// Returns end offset of the verified area: hashes usually cover only a part of the data,
+// the rest should be checked with hashes received from the next upload.getFileHashes call.
+func checkFileHashes(offset int64, data []byte, hashes []mtproto.TL_fileHash) (int64, error) {
+	verifiedUntil := offset
+	dataEnd := offset + int64(len(data))
+	for _, h := range hashes {
+		if h.Offset != verifiedUntil || h.Offset >= dataEnd {
+			continue
+		}
+		end := h.Offset + int64(h.Limit)
+		if end > dataEnd {
+			// the last range of the file may be shorter than limit
+			end = dataEnd
+		}
+		hash := sha256.Sum256(data[h.Offset-offset : end-offset])
+		if !bytes.Equal(hash[:], h.Hash) {
+			return verifiedUntil, merry.Wrap(ErrFileHashMismatch, merry.AppendMessagef("range %d-%d", h.Offset, end))
+		}
+		verifiedUntil = end
+	}
+	return verifiedUntil, nil
+}
+
+// verifyFileHashes checks chunk data with hashes from upload.getFileHashes.
+// Hashes must be requested from the DC the file is stored on, so mt should be the connection chunk was received from.
+func (d *Downloader) verifyFileHashes(mt *mtproto.MTProto, location mtproto.TL_InputFileLocation, offset int64, data []byte) error {
+	dataEnd := offset + int64(len(data))
+	for pos := offset; pos < dataEnd; {
+		res := mt.SendSync(mtproto.TL_upload_getFileHashes{Location: location, Offset: pos})
+		vec, ok := res.(mtproto.VectorObject)
+		if !ok {
+			return mtproto.WrongRespError(res)
+		}
+		hashes := make([]mtproto.TL_fileHash, 0, len(vec))
+		for _, item := range vec {
+			h, ok := item.(mtproto.TL_fileHash)
+			if !ok {
+				return merry.New(mtproto.UnexpectedTL("file hash", item))
+			}
+			hashes = append(hashes, h)
+		}
+		newPos, err := checkFileHashes(pos, data[pos-offset:], hashes)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		if newPos <= pos {
+			return merry.Errorf("no file hashes for offset %d", pos)
+		}
+		pos = newPos
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package tgclient
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+)
+
+func TestCheckFileHashes(t *testing.T) {
+	data := make([]byte, 300)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	hashOf := func(from, to int) []byte {
+		h := sha256.Sum256(data[from:to])
+		return h[:]
+	}
+	// chunk starts at offset 1000, the last range is shorter than limit
+	hashes := []mtproto.TL_fileHash{
+		{Offset: 1000, Limit: 128, Hash: hashOf(0, 128)},
+		{Offset: 1128, Limit: 128, Hash: hashOf(128, 256)},
+		{Offset: 1256, Limit: 128, Hash: hashOf(256, 300)},
+	}
+	until, err := checkFileHashes(1000, data, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until != 1300 {
+		t.Fatalf("expected verified until 1300, got %d", until)
+	}
+
+	// hashes covering only a part of the data
+	until, err = checkFileHashes(1000, data, hashes[:1])
+	if err != nil || until != 1128 {
+		t.Fatalf("expected verified until 1128, got %d (%v)", until, err)
+	}
+
+	data[200] ^= 0xFF
+	if _, err := checkFileHashes(1000, data, hashes); !errors.Is(err, ErrFileHashMismatch) {
+		t.Fatalf("expected hash mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package tgclient
+
+import (
+	"io"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// MediaFile describes downloadable file of a photo or a document.
+type MediaFile struct {
+	Location mtproto.TL_InputFileLocation
+	DcID     int32 // DC where the file is stored
+	Size     int64
+}
+
+// MediaFileLocation returns location of the file of media which may be TL_document, TL_photo
+// (its largest size is used) or TL_messageMediaDocument/TL_messageMediaPhoto containing one of them.
+func MediaFileLocation(media mtproto.TL) (*MediaFile, error) {
+	switch m := media.(type) {
+	case mtproto.TL_messageMediaDocument:
+		return MediaFileLocation(m.Document)
+	case mtproto.TL_messageMediaPhoto:
+		return MediaFileLocation(m.Photo)
+	case mtproto.TL_document:
+		return &MediaFile{
+			Location: mtproto.TL_inputDocumentFileLocation{
+				ID:            m.ID,
+				AccessHash:    m.AccessHash,
+				FileReference: m.FileReference,
+			},
+			DcID: m.DCID,
+			Size: m.Size,
+		}, nil
+	case mtproto.TL_photo:
+		sizeType, size := largestPhotoSize(m.Sizes)
+		if sizeType == "" {
+			return nil, merry.Errorf("photo %d has no downloadable sizes", m.ID)
+		}
+		return &MediaFile{
+			Location: mtproto.TL_inputPhotoFileLocation{
+				ID:            m.ID,
+				AccessHash:    m.AccessHash,
+				FileReference: m.FileReference,
+				ThumbSize:     sizeType,
+			},
+			DcID: m.DCID,
+			Size: size,
+		}, nil
+	default:
+		return nil, merry.New(mtproto.UnexpectedTL("media", media))
+	}
+}
+
+func largestPhotoSize(sizes []mtproto.TL) (string, int64) {
+	sizeType := ""
+	maxSize := int64(-1)
+	for _, sizeTL := range sizes {
+		switch s := sizeTL.(type) {
+		case mtproto.TL_photoSize:
+			if int64(s.Size) > maxSize {
+				sizeType, maxSize = s.Type, int64(s.Size)
+			}
+		case mtproto.TL_photoSizeProgressive:
+			if len(s.Sizes) > 0 && int64(s.Sizes[len(s.Sizes)-1]) > maxSize {
+				sizeType, maxSize = s.Type, int64(s.Sizes[len(s.Sizes)-1])
+			}
+		}
+	}
+	return sizeType, maxSize
+}
+
+// DownloadMedia downloads file of media (see MediaFileLocation) from its DC and writes it to w.
+// Files from other DCs are requested over a separate connection with exported authorization,
+// so caller does not have to handle FILE_MIGRATE_X errors.
+func (d *Downloader) DownloadMedia(media mtproto.TL, w io.Writer) (*DownloadedFile, error) {
+	file, err := MediaFileLocation(media)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	res, err := d.DownloadFileFromDC(file.Location, file.DcID, w)
+	return res, merry.Wrap(err)
+}
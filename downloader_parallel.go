@@ -0,0 +1,159 @@
+package tgclient
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+type fileChunk struct {
+	index int64
+	data  []byte
+	typ   mtproto.TL
+	err   error
+}
+
+// DownloadFileParallel is like DownloadFile but requests file chunks over connCount separate
+// connections to the DC simultaneously. Chunks are written to w in order, at most 2*connCount
+// chunks (1MB each) are kept in memory. File size must be known (from Document or PhotoSize).
+func (d *Downloader) DownloadFileParallel(location mtproto.TL_InputFileLocation, dcID int32, size int64, w io.Writer, connCount int) (*DownloadedFile, error) {
+	if connCount < 1 {
+		connCount = 1
+	}
+	chunksCount := (size + downloadChunkSize - 1) / downloadChunkSize
+	if chunksCount == 0 {
+		return d.DownloadFile(location, w)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// limits number of chunks downloaded ahead of writing
+	window := make(chan struct{}, connCount*2)
+	jobs := make(chan int64)
+	results := make(chan fileChunk, connCount)
+
+	go func() {
+		defer close(jobs)
+		for i := int64(0); i < chunksCount; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	dc := &parallelDownloadDC{id: dcID}
+	for i := 0; i < connCount; i++ {
+		go func(connIndex int) {
+			for index := range jobs {
+				chunk := d.downloadChunk(location, dc, connIndex, index)
+				select {
+				case results <- chunk:
+				case <-done:
+					return
+				}
+			}
+		}(i)
+	}
+
+	res := &DownloadedFile{}
+	pending := make(map[int64]fileChunk)
+	for next := int64(0); next < chunksCount; {
+		chunk := <-results
+		if chunk.err != nil {
+			return nil, merry.Wrap(chunk.err)
+		}
+		pending[chunk.index] = chunk
+		for {
+			chunk, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if _, err := w.Write(chunk.data); err != nil {
+				return nil, merry.Wrap(err)
+			}
+			res.Size += int64(len(chunk.data))
+			res.Type = chunk.typ
+			next++
+			<-window
+		}
+	}
+	res.DcID = dc.get()
+	return res, nil
+}
+
+// parallelDownloadDC is the DC file is downloaded from, it may be changed by FILE_MIGRATE_X
+type parallelDownloadDC struct {
+	mutex sync.Mutex
+	id    int32
+}
+
+func (dc *parallelDownloadDC) get() int32 {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+	return dc.id
+}
+
+func (dc *parallelDownloadDC) set(id int32) {
+	dc.mutex.Lock()
+	dc.id = id
+	dc.mutex.Unlock()
+}
+
+func (d *Downloader) downloadChunk(location mtproto.TL_InputFileLocation, dc *parallelDownloadDC, connIndex int, index int64) fileChunk {
+	mismatchCount := 0
+	for {
+		dcID := dc.get()
+		mt, err := d.getFileMTNum(dcID, connIndex)
+		if err != nil {
+			return fileChunk{index: index, err: merry.Wrap(err)}
+		}
+		resTL := mt.SendSync(mtproto.TL_upload_getFile{
+			Location: location,
+			Offset:   index * downloadChunkSize,
+			Limit:    downloadChunkSize,
+		})
+		switch part := resTL.(type) {
+		case mtproto.TL_upload_file:
+			d.tg.transferLimiter.Wait(len(part.Bytes))
+			if d.VerifyHashes {
+				if err := d.verifyFileHashes(mt, location, index*downloadChunkSize, part.Bytes); err != nil {
+					if errors.Is(err, ErrFileHashMismatch) && mismatchCount < hashMismatchRetries {
+						mismatchCount++
+						d.log.Warn("%s, re-fetching", err)
+						continue
+					}
+					return fileChunk{index: index, err: merry.Wrap(err)}
+				}
+			}
+			return fileChunk{index: index, data: part.Bytes, typ: part.Type}
+		case mtproto.TL_upload_fileCDNRedirect:
+			return fileChunk{index: index, err: merry.New("cdn redirect: " + mtproto.Sprint(part))}
+		default:
+			rpcErr, ok := mtproto.AsRPCError(resTL)
+			if !ok {
+				return fileChunk{index: index, err: mtproto.WrongRespError(resTL)}
+			}
+			newDcID, ok := rpcErr.MigrateDC()
+			if !ok {
+				return fileChunk{index: index, err: mtproto.WrongRespError(resTL)}
+			}
+			if newDcID == dcID {
+				return fileChunk{index: index, err: mtproto.WrongRespError(resTL)}
+			}
+			d.log.Info("got %s, downloading from DC %d", rpcErr.FullMessage(), newDcID)
+			dc.set(newDcID)
+		}
+	}
+}
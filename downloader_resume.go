@@ -0,0 +1,185 @@
+package tgclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+var ErrNoDownloadProgress = merry.Sentinel("no download progress data")
+
+// DownloadProgress describes already downloaded part of the file: Offset bytes
+// (multiple of 1MB chunk size) and SHA256 hashes of each chunk to verify the data on resume.
+type DownloadProgress struct {
+	Offset      int64
+	ChunkHashes [][]byte
+}
+
+// DownloadProgressStore persists download progress, key identifies the download (target file path).
+type DownloadProgressStore interface {
+	Save(key string, progress *DownloadProgress) error
+	Load(key string, progress *DownloadProgress) error // should return ErrNoDownloadProgress if there is nothing saved
+	Delete(key string) error
+}
+
+// DownloadProgressFileStore keeps progress in JSON file next to the downloaded one (<path>.progress).
+type DownloadProgressFileStore struct{}
+
+func (s DownloadProgressFileStore) Save(key string, progress *DownloadProgress) error {
+	f, err := os.Create(key + ".progress.temp")
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(progress); err != nil {
+		return merry.Wrap(err)
+	}
+	if err := f.Close(); err != nil {
+		return merry.Wrap(err)
+	}
+
+	if err := os.Rename(key+".progress.temp", key+".progress"); err != nil {
+		return merry.Wrap(err)
+	}
+	return nil
+}
+
+func (s DownloadProgressFileStore) Load(key string, progress *DownloadProgress) error {
+	f, err := os.Open(key + ".progress")
+	if errors.Is(err, fs.ErrNotExist) {
+		return merry.Wrap(ErrNoDownloadProgress, merry.WithCause(err))
+	}
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(progress); err != nil {
+		return merry.Wrap(err)
+	}
+	return nil
+}
+
+func (s DownloadProgressFileStore) Delete(key string) error {
+	err := os.Remove(key + ".progress")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return merry.Wrap(err)
+}
+
+// DownloadFileResumable downloads file to fpath (via fpath+".temp") saving progress to store
+// after each chunk. If the download is interrupted (even by crash), next call with the same fpath
+// verifies already downloaded chunks by their hashes and continues from the last valid one.
+// ProgressHnd (optional) receives downloaded bytes count (including resumed part) and size
+// (which is used only for progress and may be negative if unknown).
+func (d *Downloader) DownloadFileResumable(
+	fpath string, location mtproto.TL_InputFileLocation, dcID int32, size int64, store DownloadProgressStore, progressHnd TransferProgressHandler,
+) (*DownloadedFile, error) {
+	tempFpath := fpath + ".temp"
+	if err := os.MkdirAll(filepath.Dir(tempFpath), os.ModePerm); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	fd, err := os.OpenFile(tempFpath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	defer fd.Close()
+
+	progress := &DownloadProgress{}
+	if err := store.Load(fpath, progress); err != nil && !errors.Is(err, ErrNoDownloadProgress) {
+		return nil, merry.Wrap(err)
+	}
+	if err := verifyDownloadProgress(fd, progress); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if progress.Offset > 0 {
+		d.log.Info("resuming download of '%s' from %d bytes", fpath, progress.Offset)
+	}
+	if err := fd.Truncate(progress.Offset); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if _, err := fd.Seek(progress.Offset, io.SeekStart); err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	var w io.Writer = fd
+	if progressHnd != nil {
+		pw := newProgressWriter(fd, size, progressHnd)
+		if err := pw.tracker.add(int(progress.Offset)); err != nil {
+			return nil, merry.Wrap(err)
+		}
+		w = pw
+	}
+
+	res := &DownloadedFile{Size: progress.Offset}
+	dc := &parallelDownloadDC{id: dcID}
+	for {
+		chunk := d.downloadChunk(location, dc, 0, progress.Offset/downloadChunkSize)
+		if chunk.err != nil {
+			return nil, merry.Wrap(chunk.err)
+		}
+		if _, err := w.Write(chunk.data); err != nil {
+			return nil, merry.Wrap(err)
+		}
+		res.Size += int64(len(chunk.data))
+		res.Type = chunk.typ
+		if len(chunk.data) < downloadChunkSize {
+			break
+		}
+
+		// data must reach the disk before progress is saved, otherwise it may be lost on crash
+		if err := fd.Sync(); err != nil {
+			return nil, merry.Wrap(err)
+		}
+		hash := sha256.Sum256(chunk.data)
+		progress.Offset += int64(len(chunk.data))
+		progress.ChunkHashes = append(progress.ChunkHashes, hash[:])
+		if err := store.Save(fpath, progress); err != nil {
+			return nil, merry.Wrap(err)
+		}
+	}
+	res.DcID = dc.get()
+
+	if err := fd.Close(); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if err := os.Rename(tempFpath, fpath); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if err := store.Delete(fpath); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return res, nil
+}
+
+// verifyDownloadProgress moves progress back to the last chunk present in the file with valid hash.
+func verifyDownloadProgress(fd *os.File, progress *DownloadProgress) error {
+	buf := make([]byte, downloadChunkSize)
+	validCount := 0
+	for _, expectedHash := range progress.ChunkHashes {
+		if _, err := fd.ReadAt(buf, int64(validCount)*downloadChunkSize); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return merry.Wrap(err)
+		}
+		hash := sha256.Sum256(buf)
+		if !bytes.Equal(hash[:], expectedHash) {
+			break
+		}
+		validCount++
+	}
+	progress.ChunkHashes = progress.ChunkHashes[:validCount]
+	progress.Offset = int64(validCount) * downloadChunkSize
+	return nil
+}
@@ -0,0 +1,31 @@
+package tgclient
+
+import (
+	"crypto/sha256"
+	"os"
+	"testing"
+)
+
+func TestVerifyDownloadProgress(t *testing.T) {
+	chunk := make([]byte, downloadChunkSize)
+	hash1 := sha256.Sum256(chunk)
+	chunk[0] = 1
+	hash2 := sha256.Sum256(chunk)
+
+	fd, err := os.Create(t.TempDir() + "/file.temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	// second chunk is corrupted (written partially), third is missing
+	fd.Write(make([]byte, downloadChunkSize))
+	fd.Write(make([]byte, downloadChunkSize/2))
+
+	progress := &DownloadProgress{Offset: 3 * downloadChunkSize, ChunkHashes: [][]byte{hash1[:], hash2[:], hash2[:]}}
+	if err := verifyDownloadProgress(fd, progress); err != nil {
+		t.Fatal(err)
+	}
+	if progress.Offset != downloadChunkSize || len(progress.ChunkHashes) != 1 {
+		t.Errorf("wrong verified progress: offset %d, %d hashes", progress.Offset, len(progress.ChunkHashes))
+	}
+}
@@ -0,0 +1,66 @@
+package tgclient
+
+import (
+	"context"
+	"io"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// StreamFile writes file part (length bytes starting from offset, or up to the end if length is negative)
+// to w chunk by chunk, so only one 1MB chunk is kept in memory. Offset does not have to be aligned,
+// so it may be used to serve HTTP Range requests. If w has Flush() (like http.ResponseWriter
+// or bufio.Writer), it is called after each chunk. Stops early if ctx is done.
+// Returns number of bytes written.
+func (d *Downloader) StreamFile(ctx context.Context, location mtproto.TL_InputFileLocation, dcID int32, offset, length int64, w io.Writer) (int64, error) {
+	dc := &parallelDownloadDC{id: dcID}
+	index := offset / downloadChunkSize
+	skip := offset % downloadChunkSize
+	var written int64
+	for length < 0 || written < length {
+		if err := ctx.Err(); err != nil {
+			return written, merry.Wrap(err)
+		}
+		chunk := d.downloadChunk(location, dc, 0, index)
+		if chunk.err != nil {
+			return written, merry.Wrap(chunk.err)
+		}
+
+		data := chunk.data
+		if skip > 0 {
+			if skip >= int64(len(data)) {
+				return written, nil
+			}
+			data = data[skip:]
+			skip = 0
+		}
+		if length >= 0 && int64(len(data)) > length-written {
+			data = data[:length-written]
+		}
+		n, err := w.Write(data)
+		written += int64(n)
+		if err != nil {
+			return written, merry.Wrap(err)
+		}
+		if err := flushWriter(w); err != nil {
+			return written, merry.Wrap(err)
+		}
+
+		if len(chunk.data) < downloadChunkSize {
+			break
+		}
+		index++
+	}
+	return written, nil
+}
+
+func flushWriter(w io.Writer) error {
+	switch f := w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package tgclient
+
+import (
+	"io"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+const webFileChunkSize = 512 * 1024
+
+// DownloadedWebFile is a result of DownloadWebFile.
+type DownloadedWebFile struct {
+	Size     int64
+	MIMEType string
+	FileType mtproto.TL // storage.FileType
+}
+
+// DownloadWebFile downloads remote file proxied by Telegram (InputWebFileLocation: TL_inputWebFileLocation,
+// TL_inputWebFileGeoPointLocation for map previews, etc.) via upload.getWebFile and writes it to w.
+// Web files are downloaded from the special DC (see MTProto.WebfileDCID).
+func (d *Downloader) DownloadWebFile(location mtproto.TL_InputWebFileLocation, w io.Writer) (*DownloadedWebFile, error) {
+	dcID := d.tg.mt.WebfileDCID()
+	if dcID == 0 {
+		dcID = d.tg.mt.CopySession().DCID
+	}
+	res := &DownloadedWebFile{}
+	for {
+		mt, err := d.getFileMT(dcID)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		resTL := mt.SendSync(mtproto.TL_upload_getWebFile{
+			Location: location,
+			Offset:   int32(res.Size),
+			Limit:    webFileChunkSize,
+		})
+		part, ok := resTL.(mtproto.TL_upload_webFile)
+		if !ok {
+			rpcErr, isRPCErr := mtproto.AsRPCError(resTL)
+			if !isRPCErr {
+				return nil, mtproto.WrongRespError(resTL)
+			}
+			newDcID, isMigrate := rpcErr.MigrateDC()
+			if !isMigrate || newDcID == dcID {
+				return nil, mtproto.WrongRespError(resTL)
+			}
+			d.log.Info("got %s, downloading web file from DC %d", rpcErr.FullMessage(), newDcID)
+			dcID = newDcID
+			continue
+		}
+
+		d.tg.transferLimiter.Wait(len(part.Bytes))
+		if _, err := w.Write(part.Bytes); err != nil {
+			return nil, merry.Wrap(err)
+		}
+		res.Size += int64(len(part.Bytes))
+		res.MIMEType = part.MIMEType
+		res.FileType = part.FileType
+		// size may be zero if it is unknown
+		if len(part.Bytes) < webFileChunkSize || (part.Size > 0 && res.Size >= int64(part.Size)) {
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package tgclient
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+type emojiKeywordsLang struct {
+	version  int32
+	keywords map[string][]string
+}
+
+// EmojiKeywords is a local keyword->emoticons dictionary for emoji suggestions.
+// It is loaded via messages.getEmojiKeywords and then updated incrementally
+// via messages.getEmojiKeywordsDifference, so Suggest() works without requests.
+// https://core.telegram.org/api/custom-emoji#emoji-keywords
+type EmojiKeywords struct {
+	tg    *TGClient
+	mutex sync.RWMutex
+	langs map[string]*emojiKeywordsLang
+}
+
+func NewEmojiKeywords(tg *TGClient) *EmojiKeywords {
+	return &EmojiKeywords{
+		tg:    tg,
+		langs: make(map[string]*emojiKeywordsLang),
+	}
+}
+
+// Update loads (or updates if already loaded) keywords for langCode.
+func (e *EmojiKeywords) Update(langCode string) error {
+	e.mutex.RLock()
+	lang, ok := e.langs[langCode]
+	var version int32
+	if ok {
+		version = lang.version
+	}
+	e.mutex.RUnlock()
+
+	var req mtproto.TLReq = mtproto.TL_messages_getEmojiKeywords{LangCode: langCode}
+	if ok {
+		req = mtproto.TL_messages_getEmojiKeywordsDifference{LangCode: langCode, FromVersion: version}
+	}
+	res := e.tg.SendSync(req)
+	diff, ok := res.(mtproto.TL_emojiKeywordsDifference)
+	if !ok {
+		return mtproto.WrongRespError(res)
+	}
+
+	if !e.applyDifference(langCode, diff) {
+		// local version is too old or unknown, server should return full list
+		res := e.tg.SendSync(mtproto.TL_messages_getEmojiKeywords{LangCode: langCode})
+		diff, ok := res.(mtproto.TL_emojiKeywordsDifference)
+		if !ok {
+			return mtproto.WrongRespError(res)
+		}
+		e.mutex.Lock()
+		delete(e.langs, langCode)
+		e.mutex.Unlock()
+		if !e.applyDifference(langCode, diff) {
+			return merry.Errorf("can not apply emoji keywords for %s from version %d", langCode, diff.FromVersion)
+		}
+	}
+	return nil
+}
+
+// Version returns locally stored keywords version for langCode (0 if not loaded).
+func (e *EmojiKeywords) Version(langCode string) int32 {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if lang, ok := e.langs[langCode]; ok {
+		return lang.version
+	}
+	return 0
+}
+
+// Suggest returns emoticons for keywords starting with prefix (case-insensitive).
+// Exact keyword matches go first.
+func (e *EmojiKeywords) Suggest(langCode, prefix string) []string {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return nil
+	}
+
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	lang, ok := e.langs[langCode]
+	if !ok {
+		return nil
+	}
+
+	var keywords []string
+	for keyword := range lang.keywords {
+		if strings.HasPrefix(keyword, prefix) {
+			keywords = append(keywords, keyword)
+		}
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if len(keywords[i]) != len(keywords[j]) {
+			return len(keywords[i]) < len(keywords[j])
+		}
+		return keywords[i] < keywords[j]
+	})
+
+	var res []string
+	seen := make(map[string]bool)
+	for _, keyword := range keywords {
+		for _, emoticon := range lang.keywords[keyword] {
+			if !seen[emoticon] {
+				seen[emoticon] = true
+				res = append(res, emoticon)
+			}
+		}
+	}
+	return res
+}
+
+// applyDifference returns false if diff can not be applied to the local version.
+func (e *EmojiKeywords) applyDifference(langCode string, diff mtproto.TL_emojiKeywordsDifference) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	lang, ok := e.langs[langCode]
+	if !ok {
+		if diff.FromVersion != 0 {
+			return false
+		}
+		lang = &emojiKeywordsLang{keywords: make(map[string][]string)}
+		e.langs[langCode] = lang
+	} else if diff.FromVersion != lang.version {
+		return false
+	}
+
+	for _, kwTL := range diff.Keywords {
+		switch kw := kwTL.(type) {
+		case mtproto.TL_emojiKeyword:
+			key := strings.ToLower(kw.Keyword)
+			emoticons := lang.keywords[key]
+			for _, emoticon := range kw.Emoticons {
+				if !containsStr(emoticons, emoticon) {
+					emoticons = append(emoticons, emoticon)
+				}
+			}
+			lang.keywords[key] = emoticons
+		case mtproto.TL_emojiKeywordDeleted:
+			key := strings.ToLower(kw.Keyword)
+			var emoticons []string
+			for _, emoticon := range lang.keywords[key] {
+				if !containsStr(kw.Emoticons, emoticon) {
+					emoticons = append(emoticons, emoticon)
+				}
+			}
+			if len(emoticons) == 0 {
+				delete(lang.keywords, key)
+			} else {
+				lang.keywords[key] = emoticons
+			}
+		default:
+			e.tg.log.Warn(mtproto.UnexpectedTL("emoji keyword", kwTL))
+		}
+	}
+	lang.version = diff.Version
+	return true
+}
+
+func containsStr(items []string, item string) bool {
+	for _, it := range items {
+		if it == item {
+			return true
+		}
+	}
+	return false
+}
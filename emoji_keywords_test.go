@@ -0,0 +1,58 @@
+package tgclient
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+)
+
+func TestEmojiKeywordsApplyDifference(t *testing.T) {
+	e := NewEmojiKeywords(&TGClient{log: mtproto.Logger{Hnd: mtproto.NoopLogHandler{}}})
+
+	if e.applyDifference("en", mtproto.TL_emojiKeywordsDifference{FromVersion: 3, Version: 4}) {
+		t.Error("difference from non-zero version should not be applied to empty dictionary")
+	}
+
+	ok := e.applyDifference("en", mtproto.TL_emojiKeywordsDifference{
+		FromVersion: 0,
+		Version:     5,
+		Keywords: []mtproto.TL{
+			mtproto.TL_emojiKeyword{Keyword: "cat", Emoticons: []string{"🐱", "🐈"}},
+			mtproto.TL_emojiKeyword{Keyword: "Catch", Emoticons: []string{"🧤"}},
+			mtproto.TL_emojiKeyword{Keyword: "dog", Emoticons: []string{"🐶"}},
+		},
+	})
+	if !ok {
+		t.Fatal("initial keywords were not applied")
+	}
+	if v := e.Version("en"); v != 5 {
+		t.Errorf("version: got %d, want 5", v)
+	}
+	if res := e.Suggest("en", "CA"); !reflect.DeepEqual(res, []string{"🐱", "🐈", "🧤"}) {
+		t.Errorf("suggest: got %v", res)
+	}
+
+	if e.applyDifference("en", mtproto.TL_emojiKeywordsDifference{FromVersion: 4, Version: 6}) {
+		t.Error("difference from wrong version should not be applied")
+	}
+
+	ok = e.applyDifference("en", mtproto.TL_emojiKeywordsDifference{
+		FromVersion: 5,
+		Version:     6,
+		Keywords: []mtproto.TL{
+			mtproto.TL_emojiKeywordDeleted{Keyword: "cat", Emoticons: []string{"🐈"}},
+			mtproto.TL_emojiKeywordDeleted{Keyword: "dog", Emoticons: []string{"🐶"}},
+			mtproto.TL_emojiKeyword{Keyword: "cat", Emoticons: []string{"😺"}},
+		},
+	})
+	if !ok {
+		t.Fatal("difference was not applied")
+	}
+	if res := e.Suggest("en", "cat"); !reflect.DeepEqual(res, []string{"🐱", "😺", "🧤"}) {
+		t.Errorf("suggest after diff: got %v", res)
+	}
+	if res := e.Suggest("en", "dog"); res != nil {
+		t.Errorf("deleted keyword: got %v", res)
+	}
+}
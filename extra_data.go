@@ -28,6 +28,7 @@ func (e *extraData) rememberEventExtraData(objs []mtproto.TL) {
 	if len(objs) == 0 {
 		return
 	}
+	e.tg.peers.Remember(objs)
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 	for _, obj := range objs {
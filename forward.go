@@ -0,0 +1,99 @@
+package tgclient
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// max number of messages in one messages.forwardMessages request
+const forwardMessagesLimit = 100
+
+// ForwardOpts are optional ForwardMessages parameters.
+type ForwardOpts struct {
+	Silent            bool
+	DropAuthor        bool // forward as a copy, without "Forwarded from" header
+	DropMediaCaptions bool
+}
+
+// ReplyTo sends text message as a reply to msg (TL_message) in the same chat.
+// Opts may be nil, opts.ReplyToMsgID is overwritten.
+func (c *TGClient) ReplyTo(msg mtproto.TL_message, text string, opts *SendMessageOpts) (mtproto.TL, error) {
+	return c.ReplyToCtx(context.Background(), msg, text, opts)
+}
+
+// ReplyToCtx is ReplyTo with context, see SendSyncCtx.
+func (c *TGClient) ReplyToCtx(ctx context.Context, msg mtproto.TL_message, text string, opts *SendMessageOpts) (mtproto.TL, error) {
+	replyOpts := SendMessageOpts{}
+	if opts != nil {
+		replyOpts = *opts
+	}
+	replyOpts.ReplyToMsgID = msg.ID
+	peer, err := c.Resolve(MessagePeer(msg))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	res, err := c.SendMessageCtx(ctx, peer, text, &replyOpts)
+	return res, merry.Wrap(err)
+}
+
+// ForwardMessages forwards messages with ids from fromPeer to toPeer (InputPeers or Peers).
+// Messages are forwarded in chunks of 100 (server limit per request). Returns forwarded messages
+// in the same order (messages that were not forwarded, e.g. deleted ones, are skipped).
+// Opts may be nil.
+func (c *TGClient) ForwardMessages(fromPeer, toPeer mtproto.TL_InputPeer, ids []int32, opts *ForwardOpts) ([]mtproto.TL, error) {
+	return c.ForwardMessagesCtx(context.Background(), fromPeer, toPeer, ids, opts)
+}
+
+// ForwardMessagesCtx is ForwardMessages with context, see SendSyncCtx.
+func (c *TGClient) ForwardMessagesCtx(ctx context.Context, fromPeer, toPeer mtproto.TL_InputPeer, ids []int32, opts *ForwardOpts) ([]mtproto.TL, error) {
+	fromInputPeer, err := c.toInputPeer(fromPeer)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	toInputPeer, err := c.toInputPeer(toPeer)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if opts == nil {
+		opts = &ForwardOpts{}
+	}
+
+	var forwarded []mtproto.TL
+	for start := 0; start < len(ids); start += forwardMessagesLimit {
+		end := start + forwardMessagesLimit
+		if end > len(ids) {
+			end = len(ids)
+		}
+		randomIDs := make([]int64, end-start)
+		for i := range randomIDs {
+			randomIDs[i] = rand.Int63()
+		}
+		res, err := c.SendSyncRetryCtx(ctx, mtproto.TL_messages_forwardMessages{
+			Silent:            opts.Silent,
+			DropAuthor:        opts.DropAuthor,
+			DropMediaCaptions: opts.DropMediaCaptions,
+			FromPeer:          fromInputPeer,
+			ID:                ids[start:end],
+			RandomID:          randomIDs,
+			ToPeer:            toInputPeer,
+		}, time.Second, 0, 30*time.Second)
+		if err != nil {
+			return forwarded, merry.Wrap(err)
+		}
+		if _, ok := mtproto.AsRPCError(res); ok {
+			return forwarded, mtproto.WrongRespError(res)
+		}
+		c.updates.Process(res)
+
+		for _, randomID := range randomIDs {
+			if msg, ok := findSentMessage(res, randomID); ok {
+				forwarded = append(forwarded, msg)
+			}
+		}
+	}
+	return forwarded, nil
+}
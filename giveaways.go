@@ -0,0 +1,109 @@
+package tgclient
+
+import (
+	"context"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// GiveawayResultsHandler is called for each new message with giveaway results.
+// Results are either TL_messageMediaGiveawayResults (message in a channel
+// which participated in the giveaway) or TL_messageActionGiveawayResults
+// (service message in the channel which launched the giveaway).
+type GiveawayResultsHandler func(message mtproto.TL, results mtproto.TL)
+
+func (c *TGClient) SetGiveawayResultsHandler(handler GiveawayResultsHandler) {
+	c.handleGiveawayResults = handler
+}
+
+// CheckGiftCode returns info about Telegram Premium gift code.
+// Slug is the last part of t.me/giftcode/<slug> link.
+func (c *TGClient) CheckGiftCode(slug string) (*mtproto.TL_payments_checkedGiftCode, error) {
+	return c.CheckGiftCodeCtx(context.Background(), slug)
+}
+
+// CheckGiftCodeCtx is CheckGiftCode with context, see SendSyncCtx.
+func (c *TGClient) CheckGiftCodeCtx(ctx context.Context, slug string) (*mtproto.TL_payments_checkedGiftCode, error) {
+	res, err := c.SendSyncCtx(ctx, mtproto.TL_payments_checkGiftCode{Slug: slug})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	code, ok := res.(mtproto.TL_payments_checkedGiftCode)
+	if !ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	c.rememberEventExtraData(code.Users)
+	c.rememberEventExtraData(code.Chats)
+	return &code, nil
+}
+
+// ApplyGiftCode activates Telegram Premium gift code for current account.
+// Returned updates are also passed to update handler.
+func (c *TGClient) ApplyGiftCode(slug string) (mtproto.TL, error) {
+	return c.ApplyGiftCodeCtx(context.Background(), slug)
+}
+
+// ApplyGiftCodeCtx is ApplyGiftCode with context, see SendSyncCtx.
+func (c *TGClient) ApplyGiftCodeCtx(ctx context.Context, slug string) (mtproto.TL, error) {
+	res, err := c.SendSyncCtx(ctx, mtproto.TL_payments_applyGiftCode{Slug: slug})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if _, ok := res.(mtproto.TL_rpcError); ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	c.handleEvent(res)
+	return res, nil
+}
+
+// GetGiveawayInfo returns giveaway status: TL_payments_giveawayInfo
+// if it is still in progress or TL_payments_giveawayInfoResults if it has ended.
+func (c *TGClient) GetGiveawayInfo(peer mtproto.TL_InputPeer, msgID int32) (mtproto.TL, error) {
+	return c.GetGiveawayInfoCtx(context.Background(), peer, msgID)
+}
+
+// GetGiveawayInfoCtx is GetGiveawayInfo with context, see SendSyncCtx.
+func (c *TGClient) GetGiveawayInfoCtx(ctx context.Context, peer mtproto.TL_InputPeer, msgID int32) (mtproto.TL, error) {
+	inputPeer, err := c.toInputPeer(peer)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	res, err := c.SendSyncCtx(ctx, mtproto.TL_payments_getGiveawayInfo{Peer: inputPeer, MsgID: msgID})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	switch res.(type) {
+	case mtproto.TL_payments_giveawayInfo, mtproto.TL_payments_giveawayInfoResults:
+		return res, nil
+	default:
+		return nil, mtproto.WrongRespError(res)
+	}
+}
+
+func (c *TGClient) dispatchGiveawayResults(update mtproto.TL) {
+	if c.handleGiveawayResults == nil {
+		return
+	}
+
+	var message mtproto.TL
+	switch upd := update.(type) {
+	case mtproto.TL_updateNewMessage:
+		message = upd.Message
+	case mtproto.TL_updateNewChannelMessage:
+		message = upd.Message
+	default:
+		return
+	}
+
+	switch msg := message.(type) {
+	case mtproto.TL_message:
+		if res, ok := msg.Media.(mtproto.TL_messageMediaGiveawayResults); ok {
+			c.handleGiveawayResults(msg, res)
+		}
+	case mtproto.TL_messageService:
+		if res, ok := msg.Action.(mtproto.TL_messageActionGiveawayResults); ok {
+			c.handleGiveawayResults(msg, res)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package tgclient
+
+import (
+	"github.com/3bl3gamer/tgclient/mtproto"
+)
+
+// HistoryOpts are optional IterHistory parameters.
+type HistoryOpts struct {
+	// OffsetID: iteration starts from messages older than it (or newer than it if Reverse is set).
+	OffsetID int32
+	// OffsetDate (unixtime): iteration starts from messages sent before it (or after it if Reverse is set).
+	// Used only if OffsetID is zero.
+	OffsetDate int32
+	// Reverse makes iterator to go from older messages to newer ones.
+	Reverse bool
+}
+
+// IterHistory iterates over chat history via messages.getHistory.
+// Peer may be InputPeer or Peer (see SendMessage). Opts may be nil.
+//
+//	iter := tg.IterHistory(peer, &tgclient.HistoryOpts{OffsetDate: since, Reverse: true})
+//	for iter.Next() {
+//		if msg, ok := iter.TLMessage(); ok {
+//			...
+//		}
+//	}
+//	if err := iter.Err(); err != nil {
+//		...
+//	}
+func (c *TGClient) IterHistory(peer mtproto.TL_InputPeer, opts *HistoryOpts) *MessagesIter {
+	if opts == nil {
+		opts = &HistoryOpts{}
+	}
+	inputPeer, err := c.toInputPeer(peer)
+	iter := c.newMessagesIter(func(offsetID, limit int32) (mtproto.TLReq, error) {
+		req := mtproto.TL_messages_getHistory{
+			Peer:     inputPeer,
+			OffsetID: offsetID,
+			Limit:    limit,
+		}
+		if offsetID == 0 {
+			req.OffsetDate = opts.OffsetDate
+		}
+		if opts.Reverse {
+			// negative offset returns limit messages starting from offset_id (or offset_date) towards newer ones
+			if offsetID != 0 || opts.OffsetDate == 0 {
+				req.OffsetID = offsetID + 1
+			}
+			req.AddOffset = -limit
+		}
+		return req, nil
+	})
+	iter.offsetID = opts.OffsetID
+	iter.reverse = opts.Reverse
+	iter.err = err
+	return iter
+}
@@ -0,0 +1,101 @@
+package tgclient
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// InputGeoPoint returns geo point for location-related requests.
+// Accuracy (in meters) is optional and may be 0.
+func InputGeoPoint(lat, long float64, accuracyRadius int32) mtproto.TL_inputGeoPoint {
+	point := mtproto.TL_inputGeoPoint{Lat: lat, Long: long}
+	if accuracyRadius > 0 {
+		point.AccuracyRadius = mtproto.Ref(accuracyRadius)
+	}
+	return point
+}
+
+// LocatedPeers is a parsed result of contacts.getLocated.
+type LocatedPeers struct {
+	Peers       []mtproto.TL_peerLocated
+	SelfExpires *time.Time // set if current user location is visible to others
+}
+
+// GetLocated returns users and geo-chats near the geoPoint (people nearby).
+func (c *TGClient) GetLocated(geoPoint mtproto.TL_InputGeoPoint) (*LocatedPeers, error) {
+	return c.GetLocatedCtx(context.Background(), geoPoint)
+}
+
+// GetLocatedCtx is GetLocated with context, see SendSyncCtx.
+func (c *TGClient) GetLocatedCtx(ctx context.Context, geoPoint mtproto.TL_InputGeoPoint) (*LocatedPeers, error) {
+	return c.getLocated(ctx, mtproto.TL_contacts_getLocated{GeoPoint: geoPoint})
+}
+
+// SetSelfLocated makes current user visible to people nearby at geoPoint for expires duration
+// (and also returns people nearby). Location visibility is removed automatically after expiration.
+// Pass zero duration to make it visible until StopSelfLocated.
+func (c *TGClient) SetSelfLocated(geoPoint mtproto.TL_InputGeoPoint, expires time.Duration) (*LocatedPeers, error) {
+	return c.SetSelfLocatedCtx(context.Background(), geoPoint, expires)
+}
+
+// SetSelfLocatedCtx is SetSelfLocated with context, see SendSyncCtx.
+func (c *TGClient) SetSelfLocatedCtx(ctx context.Context, geoPoint mtproto.TL_InputGeoPoint, expires time.Duration) (*LocatedPeers, error) {
+	secs := int32(math.MaxInt32)
+	if expires > 0 {
+		secs = int32(expires / time.Second)
+	}
+	return c.getLocated(ctx, mtproto.TL_contacts_getLocated{
+		Background:  true,
+		GeoPoint:    geoPoint,
+		SelfExpires: mtproto.Ref(secs),
+	})
+}
+
+// StopSelfLocated hides and removes current user location from people nearby.
+func (c *TGClient) StopSelfLocated() error {
+	return c.StopSelfLocatedCtx(context.Background())
+}
+
+// StopSelfLocatedCtx is StopSelfLocated with context, see SendSyncCtx.
+func (c *TGClient) StopSelfLocatedCtx(ctx context.Context) error {
+	_, err := c.getLocated(ctx, mtproto.TL_contacts_getLocated{
+		Background:  true,
+		GeoPoint:    mtproto.TL_inputGeoPointEmpty{},
+		SelfExpires: mtproto.Ref(int32(0)),
+	})
+	return err
+}
+
+func (c *TGClient) getLocated(ctx context.Context, req mtproto.TL_contacts_getLocated) (*LocatedPeers, error) {
+	res, err := c.SendSyncCtx(ctx, req)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	updates, ok := res.(mtproto.TL_updates)
+	if !ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	c.rememberEventExtraData(updates.Users)
+	c.rememberEventExtraData(updates.Chats)
+
+	located := &LocatedPeers{}
+	for _, updTL := range updates.Updates {
+		upd, ok := updTL.(mtproto.TL_updatePeerLocated)
+		if !ok {
+			continue
+		}
+		for _, peerTL := range upd.Peers {
+			switch peer := peerTL.(type) {
+			case mtproto.TL_peerLocated:
+				located.Peers = append(located.Peers, peer)
+			case mtproto.TL_peerSelfLocated:
+				located.SelfExpires = mtproto.Ref(time.Unix(int64(peer.Expires), 0))
+			}
+		}
+	}
+	return located, nil
+}
@@ -0,0 +1,140 @@
+package tgclient
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"mime"
+	"path/filepath"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// SendMediaOpts are optional SendPhoto/SendDocument/SendVideo parameters.
+type SendMediaOpts struct {
+	Caption      string
+	Entities     []mtproto.TL // caption entities
+	ReplyToMsgID int32
+	Silent       bool
+	// MIMEType of the document, detected by file name extension if empty
+	MIMEType string
+}
+
+// VideoInfo describes video sent with SendVideo.
+type VideoInfo struct {
+	Duration          float64 // seconds
+	W, H              int32
+	SupportsStreaming bool
+}
+
+// SendPhoto uploads image data (see UploadFile, size may be negative if unknown)
+// and sends it to peer (InputPeer or Peer) as a photo. Returns sent message (TL_message).
+func (c *TGClient) SendPhoto(peer mtproto.TL_InputPeer, data io.Reader, size int64, name string, opts *SendMediaOpts) (mtproto.TL, error) {
+	return c.SendPhotoCtx(context.Background(), peer, data, size, name, opts)
+}
+
+// SendPhotoCtx is SendPhoto with context, see SendSyncCtx.
+func (c *TGClient) SendPhotoCtx(ctx context.Context, peer mtproto.TL_InputPeer, data io.Reader, size int64, name string, opts *SendMediaOpts) (mtproto.TL, error) {
+	file, err := c.UploadFileCtx(ctx, data, size, name)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	msg, err := c.sendMedia(ctx, peer, mtproto.TL_inputMediaUploadedPhoto{File: file}, opts)
+	return msg, merry.Wrap(err)
+}
+
+// SendDocument uploads data and sends it to peer as a file named name.
+func (c *TGClient) SendDocument(peer mtproto.TL_InputPeer, data io.Reader, size int64, name string, opts *SendMediaOpts) (mtproto.TL, error) {
+	return c.SendDocumentCtx(context.Background(), peer, data, size, name, opts)
+}
+
+// SendDocumentCtx is SendDocument with context, see SendSyncCtx.
+func (c *TGClient) SendDocumentCtx(ctx context.Context, peer mtproto.TL_InputPeer, data io.Reader, size int64, name string, opts *SendMediaOpts) (mtproto.TL, error) {
+	file, err := c.UploadFileCtx(ctx, data, size, name)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	msg, err := c.sendMedia(ctx, peer, mtproto.TL_inputMediaUploadedDocument{
+		ForceFile:  true,
+		File:       file,
+		MIMEType:   mediaMIMEType(name, opts),
+		Attributes: []mtproto.TL{mtproto.TL_documentAttributeFilename{FileName: name}},
+	}, opts)
+	return msg, merry.Wrap(err)
+}
+
+// SendVideo uploads data and sends it to peer as a video. Duration and dimensions are not
+// detected automatically, without them (zero VideoInfo) clients show the video with default size.
+func (c *TGClient) SendVideo(peer mtproto.TL_InputPeer, data io.Reader, size int64, name string, video VideoInfo, opts *SendMediaOpts) (mtproto.TL, error) {
+	return c.SendVideoCtx(context.Background(), peer, data, size, name, video, opts)
+}
+
+// SendVideoCtx is SendVideo with context, see SendSyncCtx.
+func (c *TGClient) SendVideoCtx(ctx context.Context, peer mtproto.TL_InputPeer, data io.Reader, size int64, name string, video VideoInfo, opts *SendMediaOpts) (mtproto.TL, error) {
+	file, err := c.UploadFileCtx(ctx, data, size, name)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	msg, err := c.sendMedia(ctx, peer, mtproto.TL_inputMediaUploadedDocument{
+		File:     file,
+		MIMEType: mediaMIMEType(name, opts),
+		Attributes: []mtproto.TL{
+			mtproto.TL_documentAttributeVideo{
+				SupportsStreaming: video.SupportsStreaming,
+				Duration:          video.Duration,
+				W:                 video.W,
+				H:                 video.H,
+			},
+			mtproto.TL_documentAttributeFilename{FileName: name},
+		},
+	}, opts)
+	return msg, merry.Wrap(err)
+}
+
+func mediaMIMEType(name string, opts *SendMediaOpts) string {
+	if opts != nil && opts.MIMEType != "" {
+		return opts.MIMEType
+	}
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// sendMedia sends media with messages.sendMedia and returns sent message.
+func (c *TGClient) sendMedia(ctx context.Context, peer mtproto.TL_InputPeer, media mtproto.TL_InputMedia, opts *SendMediaOpts) (mtproto.TL, error) {
+	inputPeer, err := c.toInputPeer(peer)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if opts == nil {
+		opts = &SendMediaOpts{}
+	}
+
+	req := mtproto.TL_messages_sendMedia{
+		Silent:   opts.Silent,
+		Peer:     inputPeer,
+		Media:    media,
+		Message:  opts.Caption,
+		RandomID: rand.Int63(),
+		Entities: opts.Entities,
+	}
+	if opts.ReplyToMsgID != 0 {
+		req.ReplyTo = mtproto.TL_inputReplyToMessage{ReplyToMsgID: opts.ReplyToMsgID}
+	}
+	res, err := c.SendSyncCtx(ctx, req)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if _, ok := mtproto.AsRPCError(res); ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	c.updates.Process(res)
+
+	msg, ok := findSentMessage(res, req.RandomID)
+	if !ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	return msg, nil
+}
@@ -0,0 +1,321 @@
+package tgclient
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+const messagesPageLimit = 100
+
+// MessageID returns ID of TL_message, TL_messageService or TL_messageEmpty (and 0 for other types).
+func MessageID(msg mtproto.TL) int32 {
+	switch m := msg.(type) {
+	case mtproto.TL_message:
+		return m.ID
+	case mtproto.TL_messageService:
+		return m.ID
+	case mtproto.TL_messageEmpty:
+		return m.ID
+	}
+	return 0
+}
+
+// MessagePeer returns chat (Peer) of TL_message or TL_messageService (and nil for other types).
+func MessagePeer(msg mtproto.TL) mtproto.TL_Peer {
+	var peer mtproto.TL
+	switch m := msg.(type) {
+	case mtproto.TL_message:
+		peer = m.PeerID
+	case mtproto.TL_messageService:
+		peer = m.PeerID
+	}
+	p, _ := peer.(mtproto.TL_Peer)
+	return p
+}
+
+// unpackMessages extracts messages from messages.Messages response
+// and remembers users and chats from it.
+func (c *TGClient) unpackMessages(res mtproto.TL) ([]mtproto.TL, error) {
+	switch r := res.(type) {
+	case mtproto.TL_messages_messages:
+		c.rememberEventExtraData(r.Users)
+		c.rememberEventExtraData(r.Chats)
+		return r.Messages, nil
+	case mtproto.TL_messages_messagesSlice:
+		c.rememberEventExtraData(r.Users)
+		c.rememberEventExtraData(r.Chats)
+		return r.Messages, nil
+	case mtproto.TL_messages_channelMessages:
+		c.rememberEventExtraData(r.Users)
+		c.rememberEventExtraData(r.Chats)
+		return r.Messages, nil
+	default:
+		return nil, mtproto.WrongRespError(res)
+	}
+}
+
+// findSentMessage looks for a message sent with randomID in updates returned by messages.send* requests.
+func findSentMessage(updates mtproto.TL, randomID int64) (mtproto.TL, bool) {
+	var items []mtproto.TL
+	switch u := updates.(type) {
+	case mtproto.TL_updates:
+		items = u.Updates
+	case mtproto.TL_updatesCombined:
+		items = u.Updates
+	default:
+		return nil, false
+	}
+
+	var msgID int32
+	for _, item := range items {
+		if upd, ok := item.(mtproto.TL_updateMessageID); ok && upd.RandomID == randomID {
+			msgID = upd.ID
+			break
+		}
+	}
+	if msgID == 0 {
+		return nil, false
+	}
+
+	for _, item := range items {
+		var msg mtproto.TL
+		switch upd := item.(type) {
+		case mtproto.TL_updateNewMessage:
+			msg = upd.Message
+		case mtproto.TL_updateNewChannelMessage:
+			msg = upd.Message
+		case mtproto.TL_updateNewScheduledMessage:
+			msg = upd.Message
+		default:
+			continue
+		}
+		if MessageID(msg) == msgID {
+			return msg, true
+		}
+	}
+	return nil, false
+}
+
+// MessagesIter iterates over messages page by page, from newest to oldest (or vice versa for reversed iterators).
+// Pages are requested with FLOOD_WAIT handling (waits up to 30 seconds are performed automatically).
+//
+//	iter := tg.IterSavedMessages(nil)
+//	for iter.Next() {
+//		msg := iter.Message()
+//	}
+//	if err := iter.Err(); err != nil {
+//		...
+//	}
+type MessagesIter struct {
+	c        *TGClient
+	makeReq  func(offsetID, limit int32) (mtproto.TLReq, error)
+	offsetID int32
+	reverse  bool       // makeReq returns messages newer than offsetID, iterating from oldest to newest
+	nextRate int32      // from the last messages.messagesSlice, used by messages.searchGlobal
+	lastMsg  mtproto.TL // last message of the last page
+	page     []mtproto.TL
+	cur      mtproto.TL
+	done     bool
+	err      error
+}
+
+func (c *TGClient) newMessagesIter(makeReq func(offsetID, limit int32) (mtproto.TLReq, error)) *MessagesIter {
+	return &MessagesIter{c: c, makeReq: makeReq}
+}
+
+func (it *MessagesIter) Next() bool {
+	return it.NextCtx(context.Background())
+}
+
+// NextCtx is Next with context, see SendSyncCtx. Context error is returned by Err.
+func (it *MessagesIter) NextCtx(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetchPage(ctx)
+	}
+	it.cur = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+func (it *MessagesIter) Message() mtproto.TL {
+	return it.cur
+}
+
+// TLMessage returns current message if it is a regular one (not TL_messageService or TL_messageEmpty).
+func (it *MessagesIter) TLMessage() (mtproto.TL_message, bool) {
+	msg, ok := it.cur.(mtproto.TL_message)
+	return msg, ok
+}
+
+func (it *MessagesIter) Err() error {
+	return it.err
+}
+
+func (it *MessagesIter) fetchPage(ctx context.Context) {
+	req, err := it.makeReq(it.offsetID, messagesPageLimit)
+	if err != nil {
+		it.err = merry.Wrap(err)
+		return
+	}
+	res, err := it.c.SendSyncRetryCtx(ctx, req, time.Second, 0, 30*time.Second)
+	if err != nil {
+		it.err = merry.Wrap(err)
+		return
+	}
+	msgs, err := it.c.unpackMessages(res)
+	if err != nil {
+		it.err = merry.Wrap(err)
+		return
+	}
+	if slice, ok := res.(mtproto.TL_messages_messagesSlice); ok && slice.NextRate != nil {
+		it.nextRate = *slice.NextRate
+	}
+	if it.reverse {
+		// server returns newest messages first, and page may also include already seen ones
+		newer := make([]mtproto.TL, 0, len(msgs))
+		for i := len(msgs) - 1; i >= 0; i-- {
+			if MessageID(msgs[i]) > it.offsetID {
+				newer = append(newer, msgs[i])
+			}
+		}
+		msgs = newer
+	}
+	if len(msgs) == 0 {
+		it.done = true
+		return
+	}
+	it.page = msgs
+	it.lastMsg = msgs[len(msgs)-1]
+	it.offsetID = MessageID(it.lastMsg)
+}
+
+// SendMessageOpts are optional SendMessage parameters.
+type SendMessageOpts struct {
+	Entities     []mtproto.TL // MessageEntity: TL_messageEntityBold | TL_messageEntityTextURL | ...
+	ReplyToMsgID int32
+	NoWebpage    bool
+	Silent       bool
+	ReplyMarkup  mtproto.TL
+}
+
+// SendMessage sends text message to peer and returns sent message (TL_message) with IDs assigned by server.
+// Peer may be InputPeer or Peer (TL_peerUser, TL_peerChannel, etc., access hash is taken from PeerCache).
+// Opts may be nil.
+func (c *TGClient) SendMessage(peer mtproto.TL_InputPeer, text string, opts *SendMessageOpts) (mtproto.TL, error) {
+	return c.SendMessageCtx(context.Background(), peer, text, opts)
+}
+
+// SendMessageCtx is SendMessage with context, see SendSyncCtx.
+func (c *TGClient) SendMessageCtx(ctx context.Context, peer mtproto.TL_InputPeer, text string, opts *SendMessageOpts) (mtproto.TL, error) {
+	inputPeer, err := c.toInputPeer(peer)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if opts == nil {
+		opts = &SendMessageOpts{}
+	}
+
+	req := mtproto.TL_messages_sendMessage{
+		NoWebpage:   opts.NoWebpage,
+		Silent:      opts.Silent,
+		Peer:        inputPeer,
+		Message:     text,
+		RandomID:    rand.Int63(),
+		ReplyMarkup: opts.ReplyMarkup,
+		Entities:    opts.Entities,
+	}
+	if opts.ReplyToMsgID != 0 {
+		req.ReplyTo = mtproto.TL_inputReplyToMessage{ReplyToMsgID: opts.ReplyToMsgID}
+	}
+	res, err := c.SendSyncCtx(ctx, req)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if _, ok := mtproto.AsRPCError(res); ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	// response contains updates with new pts, they should not cause a gap later
+	c.updates.Process(res)
+
+	if short, ok := res.(mtproto.TL_updateShortSentMessage); ok {
+		// private chats: server returns only IDs and (maybe) parsed entities and media
+		msg := mtproto.TL_message{
+			Out:       short.Out,
+			ID:        short.ID,
+			PeerID:    inputPeerToPeer(inputPeer),
+			Date:      short.Date,
+			Message:   text,
+			Media:     short.Media,
+			Entities:  short.Entities,
+			TTLPeriod: short.TTLPeriod,
+		}
+		if msg.Entities == nil {
+			msg.Entities = opts.Entities
+		}
+		if opts.ReplyToMsgID != 0 {
+			replyTo := opts.ReplyToMsgID
+			msg.ReplyTo = mtproto.TL_messageReplyHeader{ReplyToMsgID: &replyTo}
+		}
+		return msg, nil
+	}
+	msg, ok := findSentMessage(res, req.RandomID)
+	if !ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	return msg, nil
+}
+
+// SendMessageToUsername resolves username or t.me link (see ResolvePeer) and sends message to it.
+func (c *TGClient) SendMessageToUsername(username, text string, opts *SendMessageOpts) (mtproto.TL, error) {
+	return c.SendMessageToUsernameCtx(context.Background(), username, text, opts)
+}
+
+// SendMessageToUsernameCtx is SendMessageToUsername with context, see SendSyncCtx.
+func (c *TGClient) SendMessageToUsernameCtx(ctx context.Context, username, text string, opts *SendMessageOpts) (mtproto.TL, error) {
+	peer, err := c.ResolvePeerCtx(ctx, username)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	msg, err := c.SendMessageCtx(ctx, peer, text, opts)
+	return msg, merry.Wrap(err)
+}
+
+// toInputPeer returns peer as is if it is already InputPeer, otherwise resolves it (see Resolve).
+func (c *TGClient) toInputPeer(peer mtproto.TL_InputPeer) (mtproto.TL_InputPeer, error) {
+	p, ok := peer.(mtproto.TL_Peer)
+	if !ok {
+		return peer, nil
+	}
+	inputPeer, err := c.Resolve(p)
+	return inputPeer, merry.Wrap(err)
+}
+
+// toInputChannel returns channel as is if it is already InputChannel, otherwise resolves TL_peerChannel.
+func (c *TGClient) toInputChannel(channel mtproto.TL_InputChannel) (mtproto.TL_InputChannel, error) {
+	p, ok := channel.(mtproto.TL_peerChannel)
+	if !ok {
+		return channel, nil
+	}
+	inputChannel, err := c.ResolveChannel(p.ChannelID)
+	return inputChannel, merry.Wrap(err)
+}
+
+// inputPeerToPeer returns Peer for InputPeer, nil for TL_inputPeerSelf and unsupported types.
+func inputPeerToPeer(inputPeer mtproto.TL_InputPeer) mtproto.TL_Peer {
+	switch p := inputPeer.(type) {
+	case mtproto.TL_inputPeerUser:
+		return mtproto.TL_peerUser{UserID: p.UserID}
+	case mtproto.TL_inputPeerChat:
+		return mtproto.TL_peerChat{ChatID: p.ChatID}
+	case mtproto.TL_inputPeerChannel:
+		return mtproto.TL_peerChannel{ChannelID: p.ChannelID}
+	}
+	return nil
+}
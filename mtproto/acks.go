@@ -0,0 +1,60 @@
+package mtproto
+
+import "time"
+
+const (
+	// received message IDs are acknowledged with a delay, so that many of them are sent in one msgs_ack
+	ackFlushDelay = 500 * time.Millisecond
+	// acks are sent immediately when this many of them are pending (msgs_ack may contain up to 8192 IDs)
+	ackMaxPending = 1024
+)
+
+// scheduleAck adds incoming message ID to pending acks. They are sent with the next outgoing batch
+// (see takePendingAcksPacket) or by timer if nothing is being sent.
+func (m *MTProto) scheduleAck(msgID int64) {
+	m.mutex.Lock()
+	m.pendingAcks = append(m.pendingAcks, msgID)
+	if len(m.pendingAcks) >= ackMaxPending {
+		packet := m.takePendingAcksUnlocked()
+		m.mutex.Unlock()
+		m.enqueue(packet)
+		return
+	}
+	if m.ackTimer == nil {
+		m.ackTimer = time.AfterFunc(ackFlushDelay, m.flushAcks)
+	}
+	m.mutex.Unlock()
+}
+
+func (m *MTProto) flushAcks() {
+	if packet := m.takePendingAcksPacket(); packet != nil {
+		m.enqueue(packet)
+	}
+}
+
+// takePendingAcksPacket returns msgs_ack packet with all pending acks, nil if there are none.
+func (m *MTProto) takePendingAcksPacket() *packetToSend {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.takePendingAcksUnlocked()
+}
+
+func (m *MTProto) takePendingAcksUnlocked() *packetToSend {
+	if m.ackTimer != nil {
+		m.ackTimer.Stop()
+		m.ackTimer = nil
+	}
+	if len(m.pendingAcks) == 0 {
+		return nil
+	}
+	packet := newPacket(TL_msgsACK{MsgIDs: m.pendingAcks}, nil)
+	m.pendingAcks = nil
+	return packet
+}
+
+// dropPendingAcks is called on disconnection: unacknowledged messages will be resent by server.
+func (m *MTProto) dropPendingAcks() {
+	m.mutex.Lock()
+	m.takePendingAcksUnlocked()
+	m.mutex.Unlock()
+}
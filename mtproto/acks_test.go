@@ -0,0 +1,28 @@
+package mtproto
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestPendingAcks(t *testing.T) {
+	m := &MTProto{mutex: &sync.Mutex{}, serviceSendQueue: make(chan *packetToSend, 1)}
+	m.scheduleAck(1)
+	m.scheduleAck(3)
+	packet := m.takePendingAcksPacket()
+	if packet == nil || !reflect.DeepEqual(packet.msg, TL_msgsACK{MsgIDs: []int64{1, 3}}) {
+		t.Fatalf("wrong acks packet: %#v", packet)
+	}
+	if m.ackTimer != nil || m.takePendingAcksPacket() != nil {
+		t.Fatalf("acks were not cleared")
+	}
+
+	for i := 0; i < ackMaxPending; i++ {
+		m.scheduleAck(int64(i))
+	}
+	packet = <-m.serviceSendQueue
+	if ids := packet.msg.(TL_msgsACK).MsgIDs; len(ids) != ackMaxPending {
+		t.Fatalf("expected %d acks to be flushed, got %d", ackMaxPending, len(ids))
+	}
+}
@@ -0,0 +1,352 @@
+package mtproto
+
+import (
+	cryptoRand "crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ansel1/merry/v2"
+)
+
+type AuthDataProvider interface {
+	PhoneNumber() (string, error)
+	Code() (string, error)
+	Password() (string, error)
+}
+
+// Code() may return these errors to request code resending (via other method
+// if SentCodeInfo.NextType is set) or to cancel authorization.
+var ErrResendCode = merry.Sentinel("code resend requested")
+var ErrCancelCode = merry.Sentinel("code cancel requested")
+
+// SentCodeInfo describes how confirmation code was sent and how (and when) it may be resent.
+type SentCodeInfo struct {
+	PhoneCodeHash string
+	Type          TL            // auth.SentCodeType: TL_auth_sentCodeTypeApp | TL_auth_sentCodeTypeSMS | ...
+	NextType      TL            // (optional) auth.CodeType: TL_auth_codeTypeSMS | TL_auth_codeTypeCall | ...
+	Timeout       time.Duration // (optional) min delay before code may be resent
+}
+
+func NewSentCodeInfo(sentCode TL_auth_sentCode) SentCodeInfo {
+	return SentCodeInfo{
+		PhoneCodeHash: sentCode.PhoneCodeHash,
+		Type:          sentCode.Type,
+		NextType:      sentCode.NextType,
+		Timeout:       time.Duration(DerefOr(sentCode.Timeout, 0)) * time.Second,
+	}
+}
+
+// SentCodeReceiver may be optionally implemented by AuthDataProvider.
+// OnSentCode is called each time the code is (re)sent, right before Code().
+type SentCodeReceiver interface {
+	OnSentCode(SentCodeInfo)
+}
+
+// CodeSettingsProvider may be optionally implemented by AuthDataProvider
+// to control how confirmation code is delivered (flash call, missed call, etc.).
+type CodeSettingsProvider interface {
+	CodeSettings() TL_codeSettings
+}
+
+// DefaultCodeSettings are used by AuthFlow if no other settings are provided.
+var DefaultCodeSettings = TL_codeSettings{CurrentNumber: true}
+
+type ScanfAuthDataProvider struct{}
+
+func (ap ScanfAuthDataProvider) PhoneNumber() (string, error) {
+	var phonenumber string
+	fmt.Print("Enter phone number: ")
+	// Explictly reading intil "\n".
+	// Otherwise on Windows (where Enter produces two characters "\r\n") the "\n"
+	// will not be read by current Scanf, and next Scanf will read empty string.
+	// https://github.com/golang/go/issues/23562#issuecomment-1006666338
+	fmt.Scanf("%s\n", &phonenumber)
+	return phonenumber, nil
+}
+
+func (ap ScanfAuthDataProvider) Code() (string, error) {
+	var code string
+	fmt.Print("Enter code: ")
+	fmt.Scanf("%s\n", &code)
+	return code, nil
+}
+
+func (ap ScanfAuthDataProvider) Password() (string, error) {
+	var passwd string
+	fmt.Print("Enter password: ")
+	fmt.Scanf("%s\n", &passwd)
+	return passwd, nil
+}
+
+type AuthState int
+
+const (
+	AuthNeedPhone AuthState = iota
+	AuthNeedCode
+	AuthNeedPassword
+	AuthDone
+)
+
+func (s AuthState) String() string {
+	switch s {
+	case AuthNeedPhone:
+		return "NeedPhone"
+	case AuthNeedCode:
+		return "NeedCode"
+	case AuthNeedPassword:
+		return "NeedPassword"
+	case AuthDone:
+		return "Done"
+	}
+	return fmt.Sprintf("AuthState(%d)", int(s))
+}
+
+// AuthFlow performs authorization step by step without blocking on user input.
+// Each Next() call takes input required by current state (phone number,
+// code or password), sends related requests and moves flow to the next state:
+//
+//	flow := m.NewAuthFlow()
+//	state, err := flow.Next(phoneNumber) // -> AuthNeedCode
+//	state, err = flow.Next(code)         // -> AuthNeedPassword or AuthDone
+//	state, err = flow.Next(password)     // -> AuthDone
+//
+// If Next() fails due to wrong input (like PHONE_CODE_INVALID), the state
+// is not changed, so Next() may be called again with corrected input.
+type AuthFlow struct {
+	m            *MTProto
+	state        AuthState
+	codeSettings TL_codeSettings
+	phoneNumber  string
+	sentCode     TL_auth_sentCode
+	accPasswd    TL_account_password
+	user         TL
+}
+
+func (m *MTProto) NewAuthFlow() *AuthFlow {
+	return &AuthFlow{m: m, state: AuthNeedPhone, codeSettings: DefaultCodeSettings}
+}
+
+// SetCodeSettings sets options for sending confirmation code
+// (allow_flashcall, current_number, allow_missed_call, logout_tokens, etc.).
+// Should be called before the first Next().
+// https://core.telegram.org/constructor/codeSettings
+func (f *AuthFlow) SetCodeSettings(settings TL_codeSettings) {
+	f.codeSettings = settings
+}
+
+func (f *AuthFlow) State() AuthState {
+	return f.state
+}
+
+// SentCode returns info about last sent code. Valid in AuthNeedCode state.
+func (f *AuthFlow) SentCode() SentCodeInfo {
+	return NewSentCodeInfo(f.sentCode)
+}
+
+// PasswordHint returns 2FA password hint (may be empty). Valid in AuthNeedPassword state.
+func (f *AuthFlow) PasswordHint() string {
+	return DerefOr(f.accPasswd.Hint, "")
+}
+
+// User returns authorized user (TL_user). Valid in AuthDone state.
+func (f *AuthFlow) User() TL {
+	return f.user
+}
+
+func (f *AuthFlow) Next(input string) (AuthState, error) {
+	var err error
+	switch f.state {
+	case AuthNeedPhone:
+		err = f.sendCode(input)
+	case AuthNeedCode:
+		err = f.signIn(input)
+	case AuthNeedPassword:
+		err = f.checkPassword(input)
+	case AuthDone:
+		err = merry.New("auth flow is already done")
+	}
+	return f.state, merry.Wrap(err)
+}
+
+// ResendCode requests code to be sent again. Valid in AuthNeedCode state.
+func (f *AuthFlow) ResendCode() error {
+	if f.state != AuthNeedCode {
+		return merry.Errorf("can not resend code in %s state", f.state)
+	}
+	sentCode, err := f.m.ResendCode(f.phoneNumber, f.sentCode.PhoneCodeHash)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	f.sentCode = sentCode
+	return nil
+}
+
+// CancelCode cancels sent code and returns flow to AuthNeedPhone state.
+func (f *AuthFlow) CancelCode() error {
+	if f.state != AuthNeedCode {
+		return merry.Errorf("can not cancel code in %s state", f.state)
+	}
+	if err := f.m.CancelCode(f.phoneNumber, f.sentCode.PhoneCodeHash); err != nil {
+		return merry.Wrap(err)
+	}
+	f.state = AuthNeedPhone
+	return nil
+}
+
+// sendCode requests login code. PHONE_MIGRATE_X errors are handled by MTProto itself
+// (unless auto-migration is disabled with MTParams.NoAutoMigrate).
+func (f *AuthFlow) sendCode(phoneNumber string) error {
+	m := f.m
+	x := m.SendSync(TL_auth_sendCode{
+		PhoneNumber: phoneNumber,
+		APIID:       m.appCfg.AppID,
+		APIHash:     m.appCfg.AppHash,
+		Settings:    f.codeSettings,
+	})
+	switch x := x.(type) {
+	case TL_auth_sentCode:
+		f.phoneNumber = phoneNumber
+		f.sentCode = x
+		f.state = AuthNeedCode
+		return nil
+	case TL_auth_sentCodeSuccess:
+		// session was already authorized (e.g. with future auth token)
+		f.phoneNumber = phoneNumber
+		return merry.Wrap(f.handleAuthorization(x.Authorization))
+	default:
+		return WrongRespError(x)
+	}
+}
+
+func (f *AuthFlow) signIn(code string) error {
+	//if authSentCode.Phone_registered
+	x := f.m.SendSync(TL_auth_signIn{
+		PhoneNumber:       f.phoneNumber,
+		PhoneCodeHash:     f.sentCode.PhoneCodeHash,
+		PhoneCode:         Ref(code),
+		EmailVerification: nil,
+	})
+	if IsError(x, "SESSION_PASSWORD_NEEDED") {
+		x = f.m.SendSync(TL_account_getPassword{})
+		accPasswd, ok := x.(TL_account_password)
+		if !ok {
+			return WrongRespError(x)
+		}
+		f.accPasswd = accPasswd
+		f.state = AuthNeedPassword
+		return nil
+	}
+	return f.handleAuthorization(x)
+}
+
+func (f *AuthFlow) checkPassword(passwd string) error {
+	algo, ok := f.accPasswd.CurrentAlgo.(TL_passwordKDFAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow)
+	if !ok {
+		return merry.Errorf("unknown password algo %T, application update is maybe needed to log in",
+			f.accPasswd.CurrentAlgo)
+	}
+	passwdSRP, err := calcInputCheckPasswordSRP(algo, f.accPasswd, passwd, cryptoRand.Read, f.m.log.Debug)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	x := f.m.SendSync(TL_auth_checkPassword{passwdSRP})
+	if IsError(x, "SRP_ID_INVALID") {
+		// password params are outdated, refreshing them so Next() may be retried
+		res := f.m.SendSync(TL_account_getPassword{})
+		if accPasswd, ok := res.(TL_account_password); ok {
+			f.accPasswd = accPasswd
+		}
+	}
+	return f.handleAuthorization(x)
+}
+
+func (f *AuthFlow) handleAuthorization(x TL) error {
+	auth, ok := x.(TL_auth_authorization)
+	if !ok {
+		return WrongRespError(x)
+	}
+	f.user = auth.User
+	f.state = AuthDone
+	return nil
+}
+
+// Auth performs blocking authorization, prompting all required data from authData.
+func (m *MTProto) Auth(authData AuthDataProvider) error {
+	_, err := m.AuthEx(authData)
+	return merry.Wrap(err)
+}
+
+// AuthEx is same as Auth but also returns authorized user.
+// It is a simple wrapper over AuthFlow.
+func (m *MTProto) AuthEx(authData AuthDataProvider) (*TL_user, error) {
+	flow := m.NewAuthFlow()
+	if provider, ok := authData.(CodeSettingsProvider); ok {
+		flow.SetCodeSettings(provider.CodeSettings())
+	}
+	for {
+		var input string
+		var err error
+		switch flow.State() {
+		case AuthNeedPhone:
+			input, err = authData.PhoneNumber()
+		case AuthNeedCode:
+			if receiver, ok := authData.(SentCodeReceiver); ok {
+				receiver.OnSentCode(flow.SentCode())
+			}
+			input, err = authData.Code()
+			if errors.Is(err, ErrResendCode) {
+				if err := flow.ResendCode(); err != nil {
+					return nil, merry.Wrap(err)
+				}
+				continue
+			}
+			if errors.Is(err, ErrCancelCode) {
+				if err := flow.CancelCode(); err != nil {
+					return nil, merry.Wrap(err)
+				}
+				return nil, merry.Wrap(ErrCancelCode)
+			}
+		case AuthNeedPassword:
+			input, err = authData.Password()
+		case AuthDone:
+			userSelf, ok := flow.User().(TL_user)
+			if !ok {
+				return nil, merry.New(UnexpectedTL("authorized user", flow.User()))
+			}
+			m.log.Debug("signed in: id %d name <%s %s>", userSelf.ID, DerefOr(userSelf.FirstName, ""), DerefOr(userSelf.LastName, ""))
+			return &userSelf, nil
+		}
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		if _, err := flow.Next(input); err != nil {
+			return nil, merry.Wrap(err)
+		}
+	}
+}
+
+// ResendCode requests confirmation code to be sent again via SentCodeInfo.NextType method.
+func (m *MTProto) ResendCode(phoneNumber, phoneCodeHash string) (TL_auth_sentCode, error) {
+	x := m.SendSync(TL_auth_resendCode{
+		PhoneNumber:   phoneNumber,
+		PhoneCodeHash: phoneCodeHash,
+	})
+	sentCode, ok := x.(TL_auth_sentCode)
+	if !ok {
+		return TL_auth_sentCode{}, WrongRespError(x)
+	}
+	return sentCode, nil
+}
+
+// CancelCode invalidates previously sent confirmation code.
+func (m *MTProto) CancelCode(phoneNumber, phoneCodeHash string) error {
+	x := m.SendSync(TL_auth_cancelCode{
+		PhoneNumber:   phoneNumber,
+		PhoneCodeHash: phoneCodeHash,
+	})
+	if _, ok := x.(TL_boolTrue); !ok {
+		return WrongRespError(x)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package mtproto
+
+import "math/rand"
+
+// max number of resends of the same request after bad_msg_notification, bad_server_salt or msgs_state_info
+const maxResends = 3
+
+// handleBadMsgNotification applies correction required by the error code (if possible)
+// and resends rejected requests, other errors are passed to the callers.
+// https://core.telegram.org/mtproto/service_messages_about_messages#notice-of-ignored-error-message
+func (m *MTProto) handleBadMsgNotification(serverMsgID int64, data TL_badMsgNotification) {
+	canResend := true
+	switch data.ErrorCode {
+	case 16: // msg_id too low: client time is wrong
+		m.syncTimeFromMsgID(serverMsgID)
+	case 17: // msg_id too high: client time is wrong
+		m.syncTimeFromMsgID(serverMsgID)
+		// msg_id must grow monotonically within session, so IDs lower than the rejected one require a new session
+		m.startNewSession()
+	case 18, 19: // incorrect two lower order msg_id bits, container msg_id is the same as msg_id of a previous message
+		m.log.Warn("msg_id #%d was rejected (code %d), resending with new one", data.BadMsgID, data.ErrorCode)
+	case 20: // message too old, server does not know whether it was received
+		// resending is safe: if the message was received, server will answer the new one same way
+	case 32: // msg_seqno too low: server has received more content-related messages than we have counted
+		m.shiftSeqNo(64)
+	case 33: // msg_seqno too high
+		m.shiftSeqNo(-16)
+	case 34, 35: // even msg_seqno expected for irrelevant message, odd for content-related one
+		m.log.Warn("seq_no parity of #%d was rejected (code %d), resending", data.BadMsgID, data.ErrorCode)
+	case 64: // invalid container
+		m.log.Warn("container #%d was rejected, resending its messages", data.BadMsgID)
+	default:
+		canResend = false
+	}
+	for _, id := range m.takeBadMsgIDs(data.BadMsgID) {
+		if !canResend || !m.resendWithNewMsgID(id) {
+			m.respAndClearPacketData(id, data)
+		}
+	}
+}
+
+// handleBadServerSalt switches to the salt sent by server and resends rejected requests.
+func (m *MTProto) handleBadServerSalt(data TL_badServerSalt) {
+	m.session.ServerSalt = data.NewServerSalt
+	m.SaveSessionLogged()
+	// known future salts are apparently outdated, they will be requested again
+	m.dropFutureSalts()
+	for _, id := range m.takeBadMsgIDs(data.BadMsgID) {
+		if !m.resendWithNewMsgID(id) {
+			m.respAndClearPacketData(id, data)
+		}
+	}
+}
+
+// takeBadMsgIDs returns inner message IDs if badMsgID is a container or just badMsgID itself.
+func (m *MTProto) takeBadMsgIDs(badMsgID int64) []int64 {
+	m.mutex.Lock()
+	ids, isContainer := m.containerMsgs[badMsgID]
+	delete(m.containerMsgs, badMsgID)
+	m.mutex.Unlock()
+	if !isContainer {
+		ids = []int64{badMsgID}
+	}
+	return ids
+}
+
+func (m *MTProto) startNewSession() {
+	m.mutex.Lock()
+	m.session.sessionId = rand.Int63()
+	m.lastOutMsgID = 0
+	m.lastOutSeqNo = 0
+	m.mutex.Unlock()
+	m.log.Warn("msg_id was too high, starting new session")
+}
+
+func (m *MTProto) shiftSeqNo(delta int32) {
+	m.mutex.Lock()
+	m.lastOutSeqNo += delta
+	if m.lastOutSeqNo < 0 {
+		m.lastOutSeqNo = 0
+	}
+	seqNo := m.lastOutSeqNo
+	m.mutex.Unlock()
+	m.log.Warn("seq_no is out of sync, shifting it by %d to %d", delta, seqNo)
+}
+
+// resendWithNewMsgID resends request msgID (with new msg_id and seq_no). Returns false
+// if the request was not found or was already resent too many times.
+func (m *MTProto) resendWithNewMsgID(msgID int64) bool {
+	packet, ok := m.msgsByID.removeIf(msgID, func(p *packetToSend) bool { return p.resends < maxResends })
+	if !ok {
+		return false
+	}
+	m.mutex.Lock()
+	packet.resends++
+	// resent message must have new ID
+	packet.msgID = 0
+	packet.seqNo = 0
+	m.mutex.Unlock()
+
+	m.log.Debug("resending %T", packet.msg)
+	m.enqueue(packet)
+	return true
+}
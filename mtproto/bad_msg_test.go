@@ -0,0 +1,66 @@
+package mtproto
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBadServerSaltResendsContainer(t *testing.T) {
+	m := &MTProto{
+		mutex:         &sync.Mutex{},
+		session:       &SessionInfo{ServerSalt: 1},
+		sessionStore:  &SessNoopStore{},
+		msgsByID:      newPendingPackets(),
+		containerMsgs: map[int64][]int64{10: {100, 101}},
+		sendQueue:     make(chan *packetToSend, 3),
+		log:           Logger{Hnd: NoopLogHandler{}},
+	}
+	for _, id := range []int64{100, 101, 102} {
+		m.msgsByID.add(&packetToSend{msgID: id, msg: TL_help_getConfig{}, resp: make(chan TL, 1)})
+	}
+
+	m.process(0, 0, TL_badServerSalt{BadMsgID: 10, ErrorCode: 48, NewServerSalt: 2}, true)
+
+	if m.session.ServerSalt != 2 {
+		t.Errorf("salt was not updated: %d", m.session.ServerSalt)
+	}
+	if len(m.sendQueue) != 2 {
+		t.Fatalf("expected 2 resent packets, got %d", len(m.sendQueue))
+	}
+	if _, ok := m.msgsByID.get(102); !ok || m.msgsByID.len() != 1 {
+		t.Errorf("only container messages should be resent, pending: %d", m.msgsByID.len())
+	}
+}
+
+func TestBadMsgIDTooHighStartsNewSession(t *testing.T) {
+	m := &MTProto{
+		mutex:     &sync.Mutex{},
+		session:   &SessionInfo{sessionId: 1},
+		msgsByID:  newPendingPackets(),
+		sendQueue: make(chan *packetToSend, 1),
+		log:       Logger{Hnd: NoopLogHandler{}},
+	}
+	m.mutex.Lock()
+	m.outMsgIDTimeOffsetSec = 100 // client clock is ahead
+	badMsgID := m.generateMessageId()
+	m.lastOutSeqNo = 10
+	m.mutex.Unlock()
+	m.msgsByID.add(&packetToSend{msgID: badMsgID, msg: TL_help_getConfig{}, resp: make(chan TL, 1)})
+
+	serverMsgID := time.Now().Unix() << 32
+	m.process(serverMsgID, 0, TL_badMsgNotification{BadMsgID: badMsgID, ErrorCode: 17}, true)
+
+	if len(m.sendQueue) != 1 {
+		t.Fatalf("rejected message was not resent")
+	}
+	if m.session.sessionId == 1 || m.lastOutSeqNo != 0 {
+		t.Errorf("new session was not started: id=%d seq_no=%d", m.session.sessionId, m.lastOutSeqNo)
+	}
+	m.mutex.Lock()
+	msgID := m.generateMessageId()
+	m.mutex.Unlock()
+	if msgID >= badMsgID {
+		t.Errorf("next msg_id %d is not lower than rejected %d", msgID, badMsgID)
+	}
+}
@@ -0,0 +1,61 @@
+package mtproto
+
+import "sync"
+
+const (
+	// initial capacity of pooled buffers
+	pooledBufMinSize = 4 * 1024
+	// larger buffers (like file parts) are not returned to the pool, so it does not hold too much memory
+	pooledBufMaxSize = 64 * 1024
+)
+
+// bufPool holds byte slices used for encoding, encrypting and reading packets:
+// they are needed only until the packet is sent or decoded, so they are reused
+// instead of being allocated for every message.
+var bufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, pooledBufMinSize)
+		return &buf
+	},
+}
+
+// getBuf returns empty slice with capacity of at least size bytes.
+func getBuf(size int) []byte {
+	if size > pooledBufMaxSize {
+		return make([]byte, 0, size)
+	}
+	buf := *bufPool.Get().(*[]byte)
+	if cap(buf) < size {
+		bufPool.Put(&buf)
+		return make([]byte, 0, size)
+	}
+	return buf[:0]
+}
+
+// putBuf returns buffer to the pool, it must not be used after that.
+func putBuf(buf []byte) {
+	if cap(buf) < pooledBufMinSize || cap(buf) > pooledBufMaxSize {
+		return
+	}
+	buf = buf[:0]
+	bufPool.Put(&buf)
+}
+
+// growBuf returns buf resized to size, reallocating it only if capacity is not enough.
+func growBuf(buf []byte, size int) []byte {
+	if cap(buf) < size {
+		return make([]byte, size)
+	}
+	return buf[:size]
+}
+
+// newPooledEncodeBuf is like NewEncodeBuf but takes buffer from the pool, see release.
+func newPooledEncodeBuf(cap int) *EncodeBuf {
+	return &EncodeBuf{getBuf(cap)}
+}
+
+// release returns buffer to the pool, EncodeBuf (and its Buf()) must not be used after that.
+func (e *EncodeBuf) release() {
+	putBuf(e.buf)
+	e.buf = nil
+}
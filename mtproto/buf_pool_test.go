@@ -0,0 +1,42 @@
+package mtproto
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBufPool(t *testing.T) {
+	buf := getBuf(100)
+	if len(buf) != 0 || cap(buf) < 100 {
+		t.Fatalf("wrong buffer: len %d, cap %d", len(buf), cap(buf))
+	}
+	putBuf(append(buf, 1, 2, 3))
+
+	if buf := getBuf(pooledBufMaxSize + 1); cap(buf) < pooledBufMaxSize+1 {
+		t.Fatalf("buffer is too small: %d", cap(buf))
+	}
+
+	x := newPooledEncodeBuf(8)
+	x.Long(1)
+	if len(x.buf) != 8 {
+		t.Fatalf("wrong encoded length: %d", len(x.buf))
+	}
+	x.release()
+	if x.buf != nil {
+		t.Fatalf("buffer was not released")
+	}
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	authKey := make([]byte, 256)
+	m := &MTProto{mutex: &sync.Mutex{}, session: &SessionInfo{AuthKey: authKey, AuthKeyHash: sha1(authKey)[12:20]}}
+	obj := make([]byte, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := m.encrypt(int64(i)<<2, 1, obj)
+		if err != nil {
+			b.Fatal(err)
+		}
+		putBuf(buf)
+	}
+}
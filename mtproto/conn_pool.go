@@ -0,0 +1,117 @@
+package mtproto
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// ConnPool is a set of parallel connections (each with its own session) to the current DC.
+// Server handles requests of a single session more or less sequentially, so bulk workloads
+// (like file parts downloading or uploading) are faster when independent requests
+// are spread between several sessions.
+//
+// Pool connections do not receive updates and do not migrate between DCs.
+type ConnPool struct {
+	conns []*MTProto
+	next  uint32 // accessed atomically
+}
+
+// NewConnPool opens size new connections to the current DC (this connection is not a part of the pool).
+// Pool should be closed when it is not needed anymore.
+func (m *MTProto) NewConnPool(size int) (*ConnPool, error) {
+	if size <= 0 {
+		return nil, merry.Errorf("wrong connection pool size: %d", size)
+	}
+	dcID, addr := m.session.DCID, m.session.Addr
+	pool := &ConnPool{conns: make([]*MTProto, 0, size)}
+	for i := 0; i < size; i++ {
+		conn, err := m.newConnection(dcID, addr)
+		if err != nil {
+			if closeErr := pool.Close(); closeErr != nil {
+				m.log.Error(closeErr, "failed to close connection pool")
+			}
+			return nil, merry.Wrap(err)
+		}
+		pool.conns = append(pool.conns, conn)
+	}
+	return pool, nil
+}
+
+// Size returns number of connections in the pool.
+func (p *ConnPool) Size() int {
+	return len(p.conns)
+}
+
+// Conn returns the least loaded connection (the one with fewest queued and pending requests).
+// Search starts from the next connection each time, so equally loaded connections are used in turn.
+func (p *ConnPool) Conn() *MTProto {
+	start := int(atomic.AddUint32(&p.next, 1))
+	var best *MTProto
+	bestLoad := 0
+	for i := range p.conns {
+		conn := p.conns[(start+i)%len(p.conns)]
+		if load := conn.load(); best == nil || load < bestLoad {
+			best, bestLoad = conn, load
+		}
+	}
+	return best
+}
+
+// Send is like MTProto.Send, request is sent via the least loaded connection.
+func (p *ConnPool) Send(msg TLReq) chan TL {
+	return p.Conn().Send(msg)
+}
+
+// SendSync is like MTProto.SendSync, request is sent via the least loaded connection.
+func (p *ConnPool) SendSync(msg TLReq) TL {
+	return p.Conn().SendSync(msg)
+}
+
+// SendSyncCtx is like MTProto.SendSyncCtx, request is sent via the least loaded connection.
+func (p *ConnPool) SendSyncCtx(ctx context.Context, msg TLReq) (TL, error) {
+	res, err := p.Conn().SendSyncCtx(ctx, msg)
+	return res, merry.Wrap(err)
+}
+
+// SendSyncRetry is like MTProto.SendSyncRetry, request is sent via the least loaded connection.
+func (p *ConnPool) SendSyncRetry(
+	msg TLReq, failRetryInterval time.Duration,
+	floodNumShortRetries int, floodMaxWait time.Duration,
+) TL {
+	res, _ := p.SendSyncRetryCtx(context.Background(), msg, failRetryInterval, floodNumShortRetries, floodMaxWait)
+	return res
+}
+
+// SendSyncRetryCtx is like MTProto.SendSyncRetryCtx, request is sent via the least loaded connection.
+func (p *ConnPool) SendSyncRetryCtx(
+	ctx context.Context, msg TLReq, failRetryInterval time.Duration,
+	floodNumShortRetries int, floodMaxWait time.Duration,
+) (TL, error) {
+	res, err := p.Conn().SendSyncRetryCtx(ctx, msg, failRetryInterval, floodNumShortRetries, floodMaxWait)
+	return res, merry.Wrap(err)
+}
+
+// Invoke is like MTProto.Invoke, request is sent via the least loaded connection.
+func (p *ConnPool) Invoke(ctx context.Context, msg TLReq) (TL, error) {
+	res, err := p.Conn().Invoke(ctx, msg)
+	return res, merry.Wrap(err)
+}
+
+// Close disconnects all pool connections.
+func (p *ConnPool) Close() error {
+	var err error
+	for _, conn := range p.conns {
+		if e := conn.Disconnect(); e != nil {
+			err = e
+		}
+	}
+	return merry.Wrap(err)
+}
+
+// load returns number of requests waiting to be sent or waiting for response.
+func (m *MTProto) load() int {
+	return len(m.extSendQueue) + len(m.sendQueue) + m.msgsByID.len()
+}
@@ -0,0 +1,31 @@
+package mtproto
+
+import "testing"
+
+func TestConnPoolLeastLoaded(t *testing.T) {
+	newConn := func() *MTProto {
+		return &MTProto{
+			msgsByID:     newPendingPackets(),
+			extSendQueue: make(chan *packetToSend, 8),
+			sendQueue:    make(chan *packetToSend, 8),
+		}
+	}
+	busy, idle := newConn(), newConn()
+	busy.msgsByID.add(&packetToSend{msgID: 4})
+	busy.extSendQueue <- &packetToSend{}
+	pool := &ConnPool{conns: []*MTProto{busy, idle}}
+
+	for i := 0; i < 4; i++ {
+		if pool.Conn() != idle {
+			t.Fatalf("busy connection was selected")
+		}
+	}
+
+	// equally loaded connections are used in turn
+	idle.msgsByID.add(&packetToSend{msgID: 4})
+	idle.extSendQueue <- &packetToSend{}
+	first, second := pool.Conn(), pool.Conn()
+	if first == second {
+		t.Fatalf("same connection was selected twice")
+	}
+}
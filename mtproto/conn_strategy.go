@@ -0,0 +1,208 @@
+package mtproto
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/ansel1/merry/v2"
+	"golang.org/x/net/proxy"
+)
+
+// ConnStrategy opens connection to DC and initializes transport.
+type ConnStrategy interface {
+	Connect(dialer proxy.Dialer, dcID int32, addr string, log Logger) (net.Conn, Transport, error)
+}
+
+// SingleConnStrategy just connects to DC address with one transport (AbridgedTransport if not set).
+// It is the default strategy.
+type SingleConnStrategy struct {
+	Transport Transport
+}
+
+func (s SingleConnStrategy) Connect(dialer proxy.Dialer, dcID int32, addr string, log Logger) (net.Conn, Transport, error) {
+	transport := s.Transport
+	if transport == nil {
+		transport = AbridgedTransport{}
+	}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, nil, merry.Wrap(err)
+	}
+	tConn, err := transport.Init(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, merry.Wrap(err)
+	}
+	return tConn, transport, nil
+}
+
+// MTProxyConfig is an MTProxy server address and secret (see ParseMTProxySecret).
+type MTProxyConfig struct {
+	Addr   string
+	Secret []byte
+}
+
+// RacingConnStrategy tries multiple transport/port combinations in parallel
+// and uses the first one that completes the handshake (i.e. responds to req_pq_multi).
+// Candidates are started one by one with HeadStart delay, so the preferred one
+// (abridged to the DC address port, usually 443) has a chance to win on a good network.
+//
+// Tried combinations: abridged to DC address port, intermediate to ports 80 and 5222,
+// obfuscated abridged to DC address port and MTProxy (if configured).
+// HTTP transport is not supported.
+type RacingConnStrategy struct {
+	HeadStart    time.Duration // default: 300ms
+	ProbeTimeout time.Duration // default: 10s
+	MTProxy      *MTProxyConfig
+}
+
+type connCandidate struct {
+	addr      string
+	transport Transport
+}
+
+type connCandidateResult struct {
+	cand connCandidate
+	conn net.Conn
+	err  error
+}
+
+func (s RacingConnStrategy) candidates(dcID int32, addr string) ([]connCandidate, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	cands := []connCandidate{{addr, AbridgedTransport{}}}
+	for _, altPort := range []string{"80", "5222"} {
+		if altPort != port {
+			cands = append(cands, connCandidate{net.JoinHostPort(host, altPort), IntermediateTransport{}})
+		}
+	}
+	cands = append(cands, connCandidate{addr, ObfuscatedTransport{Inner: AbridgedTransport{}, DCID: int16(dcID)}})
+	if s.MTProxy != nil {
+		cands = append(cands, connCandidate{s.MTProxy.Addr, ObfuscatedTransport{
+			Inner:  IntermediateTransport{},
+			Secret: s.MTProxy.Secret,
+			DCID:   int16(dcID),
+		}})
+	}
+	return cands, nil
+}
+
+func (s RacingConnStrategy) Connect(dialer proxy.Dialer, dcID int32, addr string, log Logger) (net.Conn, Transport, error) {
+	headStart := s.HeadStart
+	if headStart == 0 {
+		headStart = 300 * time.Millisecond
+	}
+	probeTimeout := s.ProbeTimeout
+	if probeTimeout == 0 {
+		probeTimeout = 10 * time.Second
+	}
+
+	cands, err := s.candidates(dcID, addr)
+	if err != nil {
+		return nil, nil, merry.Wrap(err)
+	}
+
+	results := make(chan connCandidateResult, len(cands))
+	stop := make(chan struct{})
+	for i, cand := range cands {
+		go func(i int, cand connCandidate) {
+			select {
+			case <-stop:
+				results <- connCandidateResult{cand: cand, err: merry.New("cancelled")}
+				return
+			case <-time.After(time.Duration(i) * headStart):
+			}
+			conn, err := probeConnCandidate(dialer, cand, probeTimeout)
+			results <- connCandidateResult{cand, conn, err}
+		}(i, cand)
+	}
+
+	var lastErr error
+	for i := 0; i < len(cands); i++ {
+		res := <-results
+		if res.err != nil {
+			log.Debug("connection via %s to %s failed: %s", res.cand.transport.Name(), res.cand.addr, res.err)
+			lastErr = res.err
+			continue
+		}
+		close(stop)
+		// closing other successful connections (if any) in background
+		go func(remaining int) {
+			for j := 0; j < remaining; j++ {
+				if r := <-results; r.conn != nil {
+					r.conn.Close()
+				}
+			}
+		}(len(cands) - i - 1)
+		log.Info("connected via %s to %s", res.cand.transport.Name(), res.cand.addr)
+		return res.conn, res.cand.transport, nil
+	}
+	return nil, nil, merry.Prepend(lastErr, "all connection attempts failed")
+}
+
+// probeConnCandidate connects, inits transport and sends unencrypted req_pq_multi.
+// Connection is considered working if resPQ is received.
+func probeConnCandidate(dialer proxy.Dialer, cand connCandidate, timeout time.Duration) (net.Conn, error) {
+	rawConn, err := dialer.Dial("tcp", cand.addr)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	conn, err := cand.transport.Init(rawConn)
+	if err != nil {
+		rawConn.Close()
+		return nil, merry.Wrap(err)
+	}
+
+	nonce, err := generateNonce16()
+	if err != nil {
+		conn.Close()
+		return nil, merry.Wrap(err)
+	}
+	obj := TL_reqPQMulti{Nonce: nonce}.encode()
+	x := NewEncodeBuf(20 + len(obj))
+	x.Long(0)
+	x.Long(time.Now().Unix() << 32)
+	x.Int(int32(len(obj)))
+	x.Bytes(obj)
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, merry.Wrap(err)
+	}
+	if err := cand.transport.WritePacket(conn, x.buf); err != nil {
+		conn.Close()
+		return nil, merry.Wrap(err)
+	}
+	buf, err := cand.transport.ReadPacket(conn)
+	if err != nil {
+		conn.Close()
+		return nil, merry.Wrap(err)
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, merry.Wrap(err)
+	}
+
+	if len(buf) == 4 {
+		conn.Close()
+		return nil, merry.Errorf("server response error: %d", int32(binary.LittleEndian.Uint32(buf)))
+	}
+	dbuf := NewDecodeBuf(buf)
+	dbuf.Long() // auth_key_id
+	dbuf.Long() // msg_id
+	dbuf.Int()  // length
+	res := dbuf.Object()
+	if dbuf.err != nil {
+		conn.Close()
+		return nil, merry.Wrap(dbuf.err)
+	}
+	resPQ, ok := res.(TL_resPQ)
+	if !ok || resPQ.Nonce != nonce {
+		conn.Close()
+		return nil, merry.New("handshake: " + UnexpectedTL("resPQ", res))
+	}
+	return conn, nil
+}
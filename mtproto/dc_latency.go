@@ -0,0 +1,135 @@
+package mtproto
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type DCLatency struct {
+	DCID       int32
+	Addr       string
+	MediaOnly  bool
+	RTT        time.Duration // TCP connection time, zero if Err is set
+	Err        error
+	MeasuredAt time.Time
+}
+
+type dcLatencies struct {
+	mutex  sync.Mutex
+	byAddr map[string]DCLatency
+}
+
+// ProbeDCLatencies measures TCP connection time to all known (from the config) IPv4 DC addresses.
+// Probes are made in parallel, results are remembered and used by DCAddrFastest.
+func (m *MTProto) ProbeDCLatencies(timeout time.Duration) []DCLatency {
+	var options []TL_dcOption
+	for _, o := range m.dcOptions {
+		if !o.IPv6 && !o.CDN && !o.TCPOOnly {
+			options = append(options, o)
+		}
+	}
+
+	results := make([]DCLatency, len(options))
+	wg := sync.WaitGroup{}
+	for i, o := range options {
+		wg.Add(1)
+		go func(i int, o TL_dcOption) {
+			defer wg.Done()
+			res := DCLatency{
+				DCID:      o.ID,
+				Addr:      fmt.Sprintf("%s:%d", o.IPAddress, o.Port),
+				MediaOnly: o.MediaOnly,
+			}
+			res.RTT, res.Err = measureConnTime(m, res.Addr, timeout)
+			res.MeasuredAt = time.Now()
+			results[i] = res
+		}(i, o)
+	}
+	wg.Wait()
+
+	m.latencies.mutex.Lock()
+	if m.latencies.byAddr == nil {
+		m.latencies.byAddr = make(map[string]DCLatency)
+	}
+	for _, res := range results {
+		m.latencies.byAddr[res.Addr] = res
+	}
+	m.latencies.mutex.Unlock()
+	return results
+}
+
+func measureConnTime(m *MTProto, addr string, timeout time.Duration) (time.Duration, error) {
+	type dialRes struct {
+		rtt time.Duration
+		err error
+	}
+	resChan := make(chan dialRes, 1)
+	go func() {
+		stt := time.Now()
+		conn, err := m.connDialer.Dial("tcp", addr)
+		rtt := time.Since(stt)
+		if err == nil {
+			conn.Close()
+		}
+		resChan <- dialRes{rtt, err}
+	}()
+	select {
+	case res := <-resChan:
+		if res.err != nil {
+			return 0, res.err
+		}
+		return res.rtt, nil
+	case <-time.After(timeout):
+		return 0, fmt.Errorf("connection to %s timed out", addr)
+	}
+}
+
+// DCLatencies returns last measured latencies sorted by DC ID and RTT.
+func (m *MTProto) DCLatencies() []DCLatency {
+	m.latencies.mutex.Lock()
+	res := make([]DCLatency, 0, len(m.latencies.byAddr))
+	for _, l := range m.latencies.byAddr {
+		res = append(res, l)
+	}
+	m.latencies.mutex.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].DCID != res[j].DCID {
+			return res[i].DCID < res[j].DCID
+		}
+		return res[i].RTT < res[j].RTT
+	})
+	return res
+}
+
+// DCAddrFastest returns DC address with the lowest measured latency.
+// If preferMedia is set, media-only addresses are preferred (if they are reachable).
+// Falls back to DCAddr if there are no successful measurements for the DC.
+func (m *MTProto) DCAddrFastest(dcID int32, preferMedia bool) (string, bool) {
+	m.latencies.mutex.Lock()
+	var best *DCLatency
+	for _, l := range m.latencies.byAddr {
+		l := l
+		if l.DCID != dcID || l.Err != nil {
+			continue
+		}
+		if best == nil || isFasterDCAddr(l, *best, preferMedia) {
+			best = &l
+		}
+	}
+	m.latencies.mutex.Unlock()
+
+	if best != nil {
+		return best.Addr, true
+	}
+	return m.DCAddr(dcID, false)
+}
+
+func isFasterDCAddr(a, b DCLatency, preferMedia bool) bool {
+	if preferMedia && a.MediaOnly != b.MediaOnly {
+		return a.MediaOnly
+	}
+	return a.RTT < b.RTT
+}
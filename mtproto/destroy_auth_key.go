@@ -0,0 +1,93 @@
+package mtproto
+
+import (
+	"context"
+	"time"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// max time to wait for destroy_auth_key result
+const destroyAuthKeyTimeout = 10 * time.Second
+
+var ErrDestroyAuthKeyFailed = merry.Sentinel("failed to destroy auth key")
+
+func isDestroyAuthKeyReq(msg TL) bool {
+	_, ok := msg.(TL_destroyAuthKey)
+	return ok
+}
+
+// DestroyAuthKey asks server to destroy permanent auth key of the session (e.g. if it may be compromised),
+// then disconnects and clears the session: auth key is removed from the session store,
+// new one will be generated on next connection (and the account will have to log in again).
+//
+// destroy_auth_key destroys the key the message is encrypted with, so with temporary auth keys
+// (see SetTempAuthKeyTTL) it is sent via separate connection encrypted with the permanent key.
+// https://core.telegram.org/mtproto/auth_key#destroying-an-auth-key
+func (m *MTProto) DestroyAuthKey() error {
+	// preventing automatic reconnection (server closes the connection after destroying the key)
+	if err := m.reconnSemaphore.Acquire(context.Background(), 1); err != nil {
+		return merry.Wrap(err)
+	}
+	defer m.reconnSemaphore.Release(1)
+
+	m.mutex.Lock()
+	hasTempKey := m.tempKey != nil
+	m.mutex.Unlock()
+	if hasTempKey {
+		permConn, err := m.newConnectionExt(m.session.DCID, m.session.Addr, 0)
+		if err != nil {
+			return merry.Prepend(err, "connecting with permanent auth key")
+		}
+		if err := permConn.reconnSemaphore.Acquire(context.Background(), 1); err != nil {
+			return merry.Wrap(err)
+		}
+		err = permConn.destroyConnAuthKey()
+		// its session can not be destroyed with destroyed key, so just closing the connection
+		if closeErr := permConn.disconnect(true); closeErr != nil {
+			m.log.Error(closeErr, "failed to close permanent auth key connection")
+		}
+		permConn.reconnSemaphore.Release(1)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+	} else if err := m.destroyConnAuthKey(); err != nil {
+		return merry.Wrap(err)
+	}
+
+	if err := m.closeMigrateConns(); err != nil {
+		m.log.Error(err, "failed to close connections to other DCs")
+	}
+	if err := m.disconnect(true); err != nil {
+		return merry.Wrap(err)
+	}
+	m.session.AuthKey = nil
+	m.session.AuthKeyHash = nil
+	m.session.ServerSalt = 0
+	m.encryptionReady = false
+	m.dropTempAuthKey()
+	m.dropFutureSalts()
+	return merry.Wrap(m.sessionStore.Save(m.session))
+}
+
+// destroyConnAuthKey sends destroy_auth_key via this connection and waits for the result.
+// Automatic reconnection should be prevented by the caller.
+func (m *MTProto) destroyConnAuthKey() error {
+	resp := make(chan TL, 1)
+	m.enqueue(newPacket(TL_destroyAuthKey{}, resp))
+	var res TL
+	select {
+	case res = <-resp:
+	case <-time.After(destroyAuthKeyTimeout):
+		return merry.Wrap(ErrNoResponse, merry.AppendMessage("destroy_auth_key"))
+	}
+	switch res.(type) {
+	case TL_destroyAuthKeyOK, TL_destroyAuthKeyNone:
+	case TL_destroyAuthKeyFail:
+		return merry.Wrap(ErrDestroyAuthKeyFailed)
+	default:
+		return WrongRespError(res)
+	}
+	m.log.Info("auth key destroyed: %T", res)
+	return nil
+}
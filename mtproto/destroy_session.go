@@ -0,0 +1,50 @@
+package mtproto
+
+import (
+	"context"
+	"time"
+)
+
+// max time to wait for destroy_session result
+const destroySessionTimeout = 10 * time.Second
+
+// destroyPrevSession asks server to forget the session closed by Disconnect (pending responses,
+// acks, updates state), so it is not kept until timeout. Should be called after connection routines start:
+// destroy_session is meant for other sessions of the same auth key, so it is sent from the new session.
+// https://core.telegram.org/mtproto/service_messages#request-to-destroy-session
+func (m *MTProto) destroyPrevSession(ctx context.Context) {
+	m.mutex.Lock()
+	sessionID := m.prevSessionID
+	m.prevSessionID = 0
+	m.mutex.Unlock()
+	if sessionID == 0 {
+		return
+	}
+
+	resp := make(chan TL, 1)
+	packet := newPacket(TL_destroySession{SessionID: sessionID}, resp)
+	m.enqueue(packet)
+	select {
+	case res := <-resp:
+		switch res.(type) {
+		case TL_destroySessionOK, TL_destroySessionNone:
+			m.log.Debug("previous session destroyed: %T", res)
+		default:
+			m.log.Warn("unexpected response to destroy_session: %T", res)
+		}
+	case <-time.After(destroySessionTimeout):
+		m.log.Warn("no response to destroy_session")
+		m.cancelPacket(packet)
+	case <-ctx.Done():
+		m.cancelPacket(packet)
+	}
+}
+
+// handleDestroySessionResult passes destroy_session_ok/none to the request (it is received
+// as a separate message, not as rpc_result).
+func (m *MTProto) handleDestroySessionResult(sessionID int64, res TL) {
+	m.respAndClearMatchingPacket(func(msg TL) bool {
+		req, ok := msg.(TL_destroySession)
+		return ok && req.SessionID == sessionID
+	}, res)
+}
@@ -0,0 +1,66 @@
+package mtproto
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ansel1/merry/v2"
+)
+
+var ErrBadDHParams = merry.Sentinel("bad DH parameters")
+
+// primes that have already passed the (slow) safe prime check
+var checkedDHPrimes sync.Map
+
+// checkDHParams checks that dh_prime is a 2048-bit safe prime and g is a generator
+// of a subgroup of prime order (p-1)/2.
+// https://core.telegram.org/mtproto/auth_key#presenting-proof-of-work-server-authentication
+func checkDHParams(g int32, dhPrime *big.Int) error {
+	if dhPrime.BitLen() != 2048 {
+		return merry.Wrap(ErrBadDHParams, merry.AppendMessagef("dh_prime is %d bits long", dhPrime.BitLen()))
+	}
+
+	var ok bool
+	mod := func(m int64) int64 { return new(big.Int).Mod(dhPrime, big.NewInt(m)).Int64() }
+	switch g {
+	case 2:
+		ok = mod(8) == 7
+	case 3:
+		ok = mod(3) == 2
+	case 4:
+		ok = true
+	case 5:
+		r := mod(5)
+		ok = r == 1 || r == 4
+	case 6:
+		r := mod(24)
+		ok = r == 19 || r == 23
+	case 7:
+		r := mod(7)
+		ok = r == 3 || r == 5 || r == 6
+	}
+	if !ok {
+		return merry.Wrap(ErrBadDHParams, merry.AppendMessagef("g=%d is not a valid generator", g))
+	}
+
+	key := dhPrime.String()
+	if _, ok := checkedDHPrimes.Load(key); ok {
+		return nil
+	}
+	halfPrime := new(big.Int).Rsh(dhPrime, 1) // (p-1)/2 since p is odd
+	if !dhPrime.ProbablyPrime(20) || !halfPrime.ProbablyPrime(20) {
+		return merry.Wrap(ErrBadDHParams, merry.AppendMessage("dh_prime is not a safe prime"))
+	}
+	checkedDHPrimes.Store(key, struct{}{})
+	return nil
+}
+
+// checkDHValue checks that g_a (or g_b) is in range [2^(2048-64), p-2^(2048-64)].
+func checkDHValue(value, dhPrime *big.Int) error {
+	margin := new(big.Int).Lsh(big.NewInt(1), 2048-64)
+	upper := new(big.Int).Sub(dhPrime, margin)
+	if value.Cmp(margin) < 0 || value.Cmp(upper) > 0 {
+		return merry.Wrap(ErrBadDHParams, merry.AppendMessage("DH value is out of safe range"))
+	}
+	return nil
+}
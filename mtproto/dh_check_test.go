@@ -0,0 +1,39 @@
+package mtproto
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// dh_prime that is currently sent by Telegram servers
+const testDHPrime = "c71caeb9c6b1c9048e6c522f70f13f73980d40238e3e21c14934d037563d930f48198a0aa7c14058229493d22530f4dbfa336f6e0ac925139543aed44cce7c3720fd51f69458705ac68cd4fe6b6b13abdc9746512969328454f18faf8c595f642477fe96bb2a941d5bcd1d4ac8cc49880708fa9b378e3c4f3a9060bee67cf9a4a4a695811051907e162753b56b0f6b410dba74d8a84b2a14b3144e0ef1284754fd17ed950d5965b4b9dd46582db1178d169c6bc465b0d6ff9ca3928fef5b9ae4e418fc15e83ebea0f87fa9ff5eed70050ded2849f47bf959d956850ce929851f0d8115f635b105ee2e4e15d04b2454bf6f4fadf034b10403119cd8e3b92fcc5b"
+
+func TestCheckDHParams(t *testing.T) {
+	p, _ := new(big.Int).SetString(testDHPrime, 16)
+	if err := checkDHParams(3, p); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDHParams(2, p); !errors.Is(err, ErrBadDHParams) {
+		t.Errorf("g=2 should be rejected, got %v", err)
+	}
+	notPrime := new(big.Int).Add(p, big.NewInt(6)) // same remainder mod 3
+	if err := checkDHParams(3, notPrime); !errors.Is(err, ErrBadDHParams) {
+		t.Errorf("not a prime should be rejected, got %v", err)
+	}
+
+	if err := checkDHValue(big.NewInt(2), p); !errors.Is(err, ErrBadDHParams) {
+		t.Errorf("small g_a should be rejected, got %v", err)
+	}
+	if err := checkDHValue(new(big.Int).Sub(p, big.NewInt(2)), p); !errors.Is(err, ErrBadDHParams) {
+		t.Errorf("large g_a should be rejected, got %v", err)
+	}
+
+	_, gb, _, err := makeGAB(3, new(big.Int).Rsh(p, 1), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkDHValue(gb, p) != nil {
+		t.Errorf("g_b is out of range")
+	}
+}
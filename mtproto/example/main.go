@@ -2,12 +2,14 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"math/rand"
 	"os"
 
 	"github.com/3bl3gamer/tgclient/mtproto"
 	"github.com/ansel1/merry/v2"
+	"github.com/fatih/color"
 )
 
 func main() {
@@ -57,7 +59,7 @@ func start(appID int32, appHash string) error {
 	}
 	log.Println("Seems authed.")
 
-	if err := m.GetContacts(); err != nil {
+	if err := printContacts(m); err != nil {
 		return merry.Wrap(err)
 	}
 
@@ -138,3 +140,29 @@ func start(appID int32, appHash string) error {
 	<-chan bool(nil)
 	return nil
 }
+
+// printContacts prints account contacts as a table.
+func printContacts(m *mtproto.MTProto) error {
+	contacts, err := m.GetContacts()
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	// writing to stderr because otherwise this output (stdout)
+	// may mess up with logs output (which is sent to stderr) on Windows
+	color.New(color.FgYellow, color.Bold).Fprintf(
+		color.Error,
+		"%10s    %10s    %-30s    %-20s\n",
+		"id", "mutual", "name", "username",
+	)
+	for _, c := range contacts {
+		fmt.Fprintf(
+			color.Error,
+			"%10d    %10t    %-30s    %-20s\n",
+			c.UserID,
+			c.Mutual,
+			fmt.Sprintf("%s %s", mtproto.DerefOr(c.User.FirstName, ""), mtproto.DerefOr(c.User.LastName, "")),
+			mtproto.DerefOr(c.User.Username, "---"),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package mtproto
+
+import (
+	"time"
+)
+
+// FloodWaitPolicy makes MTProto transparently resend requests that failed with FLOOD_WAIT_X
+// (or FLOOD_PREMIUM_WAIT_X) after waiting X seconds. Waiting request is not sent again
+// if it was cancelled (see SendSyncCtx).
+type FloodWaitPolicy struct {
+	// Errors with longer waits are returned to the caller as is.
+	MaxWait time.Duration
+	// Max number of resends for one request, no limit if zero.
+	MaxRetries int
+	// (optional) Called (in separate goroutine) before each wait.
+	OnWait func(msg TL, wait time.Duration, attempt int)
+}
+
+// SetFloodWaitPolicy enables (or disables if policy is nil) automatic FLOOD_WAIT handling.
+func (m *MTProto) SetFloodWaitPolicy(policy *FloodWaitPolicy) {
+	m.mutex.Lock()
+	m.floodWaitPolicy = policy
+	m.mutex.Unlock()
+}
+
+// scheduleFloodWaitResend returns true if request msgID will be resent later,
+// so its response should not be passed to the caller.
+func (m *MTProto) scheduleFloodWaitResend(msgID int64, res TL) bool {
+	wait, ok := IsFloodError(res)
+	if !ok {
+		return false
+	}
+
+	m.mutex.Lock()
+	policy := m.floodWaitPolicy
+	m.mutex.Unlock()
+	if policy == nil || wait > policy.MaxWait {
+		return false
+	}
+	packet, ok := m.msgsByID.removeIf(msgID, func(p *packetToSend) bool {
+		return p.resp != nil && (policy.MaxRetries <= 0 || p.floodRetries < policy.MaxRetries)
+	})
+	if !ok {
+		return false
+	}
+	m.mutex.Lock()
+	packet.floodRetries++
+	// resent message must have new ID
+	packet.msgID = 0
+	packet.seqNo = 0
+	attempt := packet.floodRetries
+	m.mutex.Unlock()
+
+	m.log.Warn("got flood-wait for %T, resending in %s, attempt #%d", packet.msg, wait, attempt)
+	if policy.OnWait != nil {
+		go policy.OnWait(packet.msg, wait, attempt)
+	}
+	time.AfterFunc(wait, func() {
+		m.enqueue(packet)
+	})
+	return true
+}
@@ -0,0 +1,43 @@
+package mtproto
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	pingInterval = 60 * time.Second
+	// server closes connection if there is no next ping during this delay (seconds)
+	pingDisconnectDelay = 75
+	// connection is considered dead if there is no pong during this time after ping
+	pongTimeout = 20 * time.Second
+)
+
+// pingRoutine sends ping_delay_disconnect every pingInterval and triggers
+// reconnection if pong does not arrive in time (instead of waiting for TCP error,
+// which may never come on a silently dropped connection).
+func (m *MTProto) pingRoutine(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pingInterval):
+		}
+
+		pingID := rand.Int63()
+		m.enqueue(newPacket(TL_pingDelayDisconnect{PingID: pingID, DisconnectDelay: pingDisconnectDelay}, nil))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pongTimeout):
+		}
+		if atomic.LoadInt64(&m.lastPongID) != pingID {
+			m.log.Warn("no pong for %s, connection seems dead", pongTimeout)
+			go m.reconnectLogged()
+			return
+		}
+	}
+}
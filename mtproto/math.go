@@ -2,6 +2,7 @@ package mtproto
 
 import (
 	"crypto/aes"
+	cryptoRand "crypto/rand"
 	"crypto/rsa"
 	sha1lib "crypto/sha1"
 	"crypto/sha256"
@@ -53,17 +54,13 @@ func bigIntPaddedBytes(num *big.Int, size int) []byte {
 	return buf
 }
 
-func doRSAencrypt(em []byte) []byte {
+func doRSAencrypt(em []byte, key *rsa.PublicKey) []byte {
 	z := make([]byte, 255)
 	copy(z, em)
 
 	c := new(big.Int)
-	c.Exp(new(big.Int).SetBytes(z), big.NewInt(int64(telegramPublicKey.E)), telegramPublicKey.N)
-
-	res := make([]byte, 256)
-	copy(res, c.Bytes())
-
-	return res
+	c.Exp(new(big.Int).SetBytes(z), big.NewInt(int64(key.E)), key.N)
+	return bigIntPaddedBytes(c, 256)
 }
 
 func splitPQ(pq *big.Int) (p1, p2 *big.Int) {
@@ -145,17 +142,56 @@ func splitPQ(pq *big.Int) (p1, p2 *big.Int) {
 	return
 }
 
-func makeGAB(g int32, g_a, dh_prime *big.Int) (b, g_b, g_ab *big.Int) {
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+// makeGAB checks server DH parameters and generates client part of the key.
+func makeGAB(g int32, g_a, dh_prime *big.Int) (b, g_b, g_ab *big.Int, err error) {
+	if err := checkDHParams(g, dh_prime); err != nil {
+		return nil, nil, nil, merry.Wrap(err)
+	}
+	if err := checkDHValue(g_a, dh_prime); err != nil {
+		return nil, nil, nil, merry.Wrap(err, merry.AppendMessage("g_a"))
+	}
+
 	rndmax := big.NewInt(0).SetBit(big.NewInt(0), 2048, 1)
-	b = big.NewInt(0).Rand(rnd, rndmax)
-	g_b = big.NewInt(0).Exp(big.NewInt(int64(g)), b, dh_prime)
+	for {
+		b, err = cryptoRand.Int(cryptoRand.Reader, rndmax)
+		if err != nil {
+			return nil, nil, nil, merry.Wrap(err)
+		}
+		g_b = big.NewInt(0).Exp(big.NewInt(int64(g)), b, dh_prime)
+		// the chance is negligible, but g_b must be checked too
+		if checkDHValue(g_b, dh_prime) == nil {
+			break
+		}
+	}
 	g_ab = big.NewInt(0).Exp(g_a, b, dh_prime)
+	return b, g_b, g_ab, nil
+}
 
-	return
+// generateAES derives AES key and IV from msg_key (MTProto 2.0).
+// https://core.telegram.org/mtproto/description#defining-aes-key-and-initialization-vector
+func generateAES(msgKey, authKey []byte, decode bool) ([]byte, []byte) {
+	x := 0
+	if decode {
+		x = 8
+	}
+	sha256a := sha256some(msgKey, authKey[x:x+36])
+	sha256b := sha256some(authKey[40+x:40+x+36], msgKey)
+
+	aesKey := make([]byte, 0, 32)
+	aesKey = append(aesKey, sha256a[0:8]...)
+	aesKey = append(aesKey, sha256b[8:24]...)
+	aesKey = append(aesKey, sha256a[24:32]...)
+
+	aesIV := make([]byte, 0, 32)
+	aesIV = append(aesIV, sha256b[0:8]...)
+	aesIV = append(aesIV, sha256a[8:24]...)
+	aesIV = append(aesIV, sha256b[24:32]...)
+
+	return aesKey, aesIV
 }
 
-func generateAES(msg_key, auth_key []byte, decode bool) ([]byte, []byte) {
+// generateAESv1 derives AES key and IV from msg_key (MTProto 1.0), used only for binding temporary auth keys.
+func generateAESv1(msg_key, auth_key []byte, decode bool) ([]byte, []byte) {
 	var x int
 	if decode {
 		x = 8
@@ -199,7 +235,21 @@ func generateAES(msg_key, auth_key []byte, decode bool) ([]byte, []byte) {
 	return aes_key, aes_iv
 }
 
+// generateMsgKey returns middle 128 bits of SHA256 of auth key part and plaintext (including padding).
+func generateMsgKey(authKey, plaintext []byte, decode bool) []byte {
+	x := 0
+	if decode {
+		x = 8
+	}
+	return sha256some(authKey[88+x:88+x+32], plaintext)[8:24]
+}
+
 func doAES256IGEencrypt(data, key, iv []byte) ([]byte, error) {
+	return doAES256IGEencryptTo(nil, data, key, iv)
+}
+
+// doAES256IGEencryptTo is like doAES256IGEencrypt but writes result to dst (if it has enough capacity).
+func doAES256IGEencryptTo(dst, data, key, iv []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -216,7 +266,11 @@ func doAES256IGEencrypt(data, key, iv []byte) ([]byte, error) {
 	y := make([]byte, aes.BlockSize)
 	copy(x, iv[:aes.BlockSize])
 	copy(y, iv[aes.BlockSize:])
-	encrypted := make([]byte, len(data))
+	encrypted := dst[:0]
+	if cap(encrypted) < len(data) {
+		encrypted = make([]byte, len(data))
+	}
+	encrypted = encrypted[:len(data)]
 
 	i := 0
 	for i < len(data) {
@@ -232,6 +286,11 @@ func doAES256IGEencrypt(data, key, iv []byte) ([]byte, error) {
 }
 
 func doAES256IGEdecrypt(data, key, iv []byte) ([]byte, error) {
+	return doAES256IGEdecryptTo(nil, data, key, iv)
+}
+
+// doAES256IGEdecryptTo is like doAES256IGEdecrypt but writes result to dst (if it has enough capacity).
+func doAES256IGEdecryptTo(dst, data, key, iv []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -248,7 +307,11 @@ func doAES256IGEdecrypt(data, key, iv []byte) ([]byte, error) {
 	y := make([]byte, aes.BlockSize)
 	copy(x, iv[:aes.BlockSize])
 	copy(y, iv[aes.BlockSize:])
-	decrypted := make([]byte, len(data))
+	decrypted := dst[:0]
+	if cap(decrypted) < len(data) {
+		decrypted = make([]byte, len(data))
+	}
+	decrypted = decrypted[:len(data)]
 
 	i := 0
 	for i < len(data) {
@@ -264,6 +327,30 @@ func doAES256IGEdecrypt(data, key, iv []byte) ([]byte, error) {
 
 }
 
+// calc_password_hash
+func calcPasswordHash(clientSalt, serverSalt []byte, password string) []byte {
+	buf := sha256some(clientSalt, []byte(password), clientSalt)
+	buf = sha256some(serverSalt, buf, serverSalt)
+	hash := pbkdf2.Key(buf, clientSalt, 100000, 64, sha512.New)
+	return sha256some(serverSalt, hash, serverSalt)
+}
+
+// calcNewPasswordHash returns g^x mod p (SRP verifier) for account.passwordInputSettings.NewPasswordHash.
+// https://core.telegram.org/api/srp#setting-a-new-2fa-password
+func calcNewPasswordHash(
+	algo TL_passwordKDFAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow,
+	password string,
+) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, merry.New("password is empty")
+	}
+	gNum := new(big.Int).SetInt64(int64(algo.G))
+	pNum := new(big.Int).SetBytes(algo.P)
+	xNum := new(big.Int).SetBytes(calcPasswordHash(algo.Salt1, algo.Salt2, password))
+	vNum := new(big.Int).Exp(gNum, xNum, pNum)
+	return bigIntPaddedBytes(vNum, 256), nil
+}
+
 func calcInputCheckPasswordSRP(
 	algo TL_passwordKDFAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow,
 	accPassword TL_account_password,
@@ -308,13 +395,7 @@ func calcInputCheckPasswordSRP(
 		return nil, merry.Errorf("expected SrpB < P, got: SrpB = %s, P = %s", BNum, pNum)
 	}
 
-	// calc_password_hash
-	buf := sha256some(clientSalt, []byte(password), clientSalt)
-	buf = sha256some(serverSalt, buf, serverSalt)
-	hash := pbkdf2.Key(buf, clientSalt, 100000, 64, sha512.New)
-	xBuf := sha256some(serverSalt, hash, serverSalt)
-	xNum := new(big.Int).SetBytes(xBuf)
-	// /calc_password_hash
+	xNum := new(big.Int).SetBytes(calcPasswordHash(clientSalt, serverSalt, password))
 
 	aBuf := make([]byte, 2048/8)
 	_, err := randFunc(aBuf)
@@ -0,0 +1,45 @@
+package mtproto
+
+import (
+	"errors"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// server closes connection if it receives a larger message
+const maxMessageSize = 1024 * 1024
+
+var ErrMessageTooLarge = merry.Sentinel("message is too large")
+
+// MessageTooLargeErrMessage is a message of TL_rpcError that is returned (by client itself)
+// instead of sending request which exceeds server message size limit.
+const MessageTooLargeErrMessage = "CLIENT_MESSAGE_TOO_LARGE"
+
+// IsMessageTooLarge checks whether request was not sent because of its size.
+func IsMessageTooLarge(tlOrErr any) bool {
+	if err, ok := tlOrErr.(error); ok && errors.Is(err, ErrMessageTooLarge) {
+		return true
+	}
+	if val, ok := unwrapUnexpectedTypeErrValue(tlOrErr); ok {
+		tlOrErr = val
+	}
+	err, ok := tlOrErr.(TL_rpcError)
+	return ok && err.ErrorMessage == MessageTooLargeErrMessage
+}
+
+// rejectTooLarge returns true if encoded message exceeds server limit. Such packet is not sent,
+// waiting caller receives TL_rpcError (see IsMessageTooLarge).
+func (m *MTProto) rejectTooLarge(packet *packetToSend, obj []byte) bool {
+	if len(obj) <= maxMessageSize {
+		return false
+	}
+	m.log.Warn("not sending %T: it is too large (%d bytes, max %d)", packet.msg, len(obj), maxMessageSize)
+	m.mutex.Lock()
+	if packet.resp != nil {
+		packet.resp <- TL_rpcError{ErrorCode: TL_ErrBadRequest, ErrorMessage: MessageTooLargeErrMessage}
+		close(packet.resp)
+		packet.resp = nil
+	}
+	m.mutex.Unlock()
+	return true
+}
@@ -0,0 +1,131 @@
+package mtproto
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Invoker performs request and returns its response.
+// Response may be nil if ctx is done before the response is received.
+type Invoker func(ctx context.Context, msg TLReq) TL
+
+// Middleware wraps request sending, for example:
+//
+//	m.Use(func(next mtproto.Invoker) mtproto.Invoker {
+//		return func(ctx context.Context, msg mtproto.TLReq) mtproto.TL {
+//			stt := time.Now()
+//			res := next(ctx, msg)
+//			log.Printf("%T -> %T in %s", msg, res, time.Since(stt))
+//			return res
+//		}
+//	})
+type Middleware func(next Invoker) Invoker
+
+// Use adds middlewares to the chain used by Send, SendSync, SendCtx and SendSyncCtx.
+// Middlewares are called in order they are added (first added is outermost).
+// Service messages (pings, acks) and requests made during connection bypass the chain.
+//
+// Send runs middlewares asynchronously but still queues requests in call order:
+// a request passed further by middlewares waits until all previously sent ones are queued
+// (or answered by middlewares without sending). So a middleware should not block
+// on a response of a request sent with Send after the current one.
+func (m *MTProto) Use(middlewares ...Middleware) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.middlewares = append(m.middlewares, middlewares...)
+	invoker := Invoker(m.invokeDirect)
+	for i := len(m.middlewares) - 1; i >= 0; i-- {
+		invoker = m.middlewares[i](invoker)
+	}
+	m.invoker = invoker
+}
+
+func (m *MTProto) invoke(ctx context.Context, msg TLReq) TL {
+	m.mutex.Lock()
+	invoker := m.invoker
+	m.mutex.Unlock()
+	if invoker == nil {
+		return m.invokeDirect(ctx, msg)
+	}
+	return invoker(ctx, msg)
+}
+
+// orderedRequest keeps Send order when requests pass through middlewares.
+// The first call to the end of the middleware chain with its context queues
+// the request after all previous ordered requests are queued (or dropped by middlewares).
+type orderedRequest struct {
+	prev    chan struct{} // closed when previous request is queued or dropped
+	queued  chan struct{} // closed when this request is queued or dropped
+	claimed int32         // accessed atomically
+}
+
+type orderedRequestKey struct{}
+
+// newOrderedRequestUnlocked must be called in Send order, with m.mutex locked.
+func (m *MTProto) newOrderedRequestUnlocked() *orderedRequest {
+	prev := m.lastOrderedReq
+	if prev == nil {
+		prev = make(chan struct{})
+		close(prev)
+	}
+	req := &orderedRequest{prev: prev, queued: make(chan struct{})}
+	m.lastOrderedReq = req.queued
+	return req
+}
+
+// claim returns true for the first caller only.
+func (r *orderedRequest) claim() bool {
+	return atomic.CompareAndSwapInt32(&r.claimed, 0, 1)
+}
+
+// release lets next requests to be queued without waiting for this one.
+func (r *orderedRequest) release() {
+	go func() {
+		<-r.prev
+		close(r.queued)
+	}()
+}
+
+// invokeOrdered calls middlewares for request created by Send. If they do not pass
+// any request further (e.g. return cached response), nothing is sent and the next requests are released.
+func (m *MTProto) invokeOrdered(invoker Invoker, req *orderedRequest, msg TLReq) TL {
+	res := invoker(context.WithValue(context.Background(), orderedRequestKey{}, req), msg)
+	if req.claim() {
+		req.release()
+	}
+	return res
+}
+
+func (m *MTProto) invokeDirect(ctx context.Context, msg TLReq) TL {
+	resp := make(chan TL, 1)
+	packet := newPacket(m.prepareRequest(msg), resp)
+
+	if req, ok := ctx.Value(orderedRequestKey{}).(*orderedRequest); ok && req.claim() {
+		select {
+		case <-req.prev:
+		case <-ctx.Done():
+			req.release()
+			return nil
+		}
+		m.extSendQueue <- packet
+		close(req.queued)
+		return m.waitResponse(ctx, packet, resp)
+	}
+
+	select {
+	case m.extSendQueue <- packet:
+	case <-ctx.Done():
+		return nil
+	}
+	return m.waitResponse(ctx, packet, resp)
+}
+
+func (m *MTProto) waitResponse(ctx context.Context, packet *packetToSend, resp chan TL) TL {
+	select {
+	case res := <-resp:
+		return res
+	case <-ctx.Done():
+		m.cancelPacket(packet)
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package mtproto
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// migrateConns are connections to other DCs, used to perform requests
+// that failed with FILE_MIGRATE_X or STATS_MIGRATE_X.
+type migrateConns struct {
+	mutex sync.Mutex
+	byDC  map[int32]*MTProto
+}
+
+// handleMigrateError returns true if request msgID failed with *_MIGRATE_X error
+// and will be retried on DC X, so its response should not be passed to the caller.
+//
+// USER_MIGRATE, PHONE_MIGRATE and NETWORK_MIGRATE switch the whole connection to the new DC
+// (with authorization export), FILE_MIGRATE and STATS_MIGRATE make the request
+// to be performed on a separate connection to that DC.
+func (m *MTProto) handleMigrateError(msgID int64, res TL) bool {
+	if !m.autoMigrate {
+		return false
+	}
+	rpcErr, ok := AsRPCError(res)
+	if !ok {
+		return false
+	}
+	dcID, ok := rpcErr.MigrateDC()
+	if !ok {
+		return false
+	}
+
+	packet, ok := m.msgsByID.removeIf(msgID, func(p *packetToSend) bool { return p.resp != nil })
+	if !ok {
+		return false
+	}
+	m.mutex.Lock()
+	// resent message must have new ID
+	packet.msgID = 0
+	packet.seqNo = 0
+	m.mutex.Unlock()
+
+	m.log.Info("got %s for %T, retrying on DC %d", rpcErr.FullMessage(), packet.msg, dcID)
+	if strings.HasPrefix(rpcErr.Message, "FILE_") || strings.HasPrefix(rpcErr.Message, "STATS_") {
+		go m.sendViaOtherDC(dcID, packet, res)
+	} else {
+		go m.migrateAndResend(dcID, packet, res)
+	}
+	return true
+}
+
+func (m *MTProto) migrateAndResend(dcID int32, packet *packetToSend, origRes TL) {
+	// waiting for possible reconnection to finish, it may also be switching DC
+	if err := m.reconnSemaphore.Acquire(context.Background(), 1); err != nil {
+		m.log.Error(err, "failed to wait for reconnection")
+		m.respToPacket(packet, origRes)
+		return
+	}
+	defer m.reconnSemaphore.Release(1)
+
+	if m.session.DCID != dcID {
+		if err := m.reconnect(dcID, true); err != nil {
+			m.log.Error(err, "failed to migrate to DC %d", dcID)
+			m.respToPacket(packet, origRes)
+			return
+		}
+	}
+	m.enqueue(packet)
+}
+
+func (m *MTProto) sendViaOtherDC(dcID int32, packet *packetToSend, origRes TL) {
+	req, ok := packet.msg.(TLReq)
+	if !ok {
+		m.respToPacket(packet, origRes)
+		return
+	}
+	m.mutex.Lock()
+	cancelled := packet.cancelled
+	m.mutex.Unlock()
+	if cancelled {
+		return
+	}
+
+	conn, err := m.migrateConn(dcID)
+	if err != nil {
+		m.log.Error(err, "failed to connect to DC %d", dcID)
+		m.respToPacket(packet, origRes)
+		return
+	}
+	m.respToPacket(packet, conn.SendSync(req))
+}
+
+func (m *MTProto) migrateConn(dcID int32) (*MTProto, error) {
+	m.migrateConns.mutex.Lock()
+	defer m.migrateConns.mutex.Unlock()
+
+	if conn, ok := m.migrateConns.byDC[dcID]; ok {
+		return conn, nil
+	}
+	conn, err := m.NewConnection(dcID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if m.migrateConns.byDC == nil {
+		m.migrateConns.byDC = make(map[int32]*MTProto)
+	}
+	m.migrateConns.byDC[dcID] = conn
+	return conn, nil
+}
+
+func (m *MTProto) closeMigrateConns() error {
+	m.migrateConns.mutex.Lock()
+	defer m.migrateConns.mutex.Unlock()
+
+	var err error
+	for dcID, conn := range m.migrateConns.byDC {
+		if e := conn.Disconnect(); e != nil {
+			err = e
+		}
+		delete(m.migrateConns.byDC, dcID)
+	}
+	return merry.Wrap(err)
+}
+
+// respToPacket passes response to the packet (that is not in msgsByID anymore)
+// if it is still waiting for it.
+func (m *MTProto) respToPacket(packet *packetToSend, res TL) {
+	m.mutex.Lock()
+	if packet.resp != nil {
+		packet.resp <- res
+		close(packet.resp)
+		packet.resp = nil
+	}
+	m.mutex.Unlock()
+}
@@ -0,0 +1,73 @@
+package mtproto
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// number of last received msg_ids kept to detect replays
+	inMsgIDsWindowSize = 512
+	// server messages should not be older or newer (by server time) than this
+	inMsgMaxAge    = 300 * time.Second
+	inMsgMaxFuture = 30 * time.Second
+)
+
+// msgIDWindow keeps last received msg_ids sorted in ascending order.
+type msgIDWindow struct {
+	ids []int64
+}
+
+// add returns false if msgID was already received or if it is lower than all
+// stored IDs (so it can not be checked), otherwise remembers it.
+// https://core.telegram.org/mtproto/security_guidelines#checking-msg-id
+func (w *msgIDWindow) add(msgID int64) bool {
+	i := sort.Search(len(w.ids), func(i int) bool { return w.ids[i] >= msgID })
+	if i < len(w.ids) && w.ids[i] == msgID {
+		return false
+	}
+	if i == 0 && len(w.ids) >= inMsgIDsWindowSize {
+		return false
+	}
+	w.ids = append(w.ids, 0)
+	copy(w.ids[i+1:], w.ids[i:])
+	w.ids[i] = msgID
+	if len(w.ids) > inMsgIDsWindowSize {
+		w.ids = w.ids[1:]
+	}
+	return true
+}
+
+// checkInMsgID returns false if received message should be ignored:
+// if it is a replay or if its time is too far from the server time.
+func (m *MTProto) checkInMsgID(msgID int64, msg TL) bool {
+	switch msg.(type) {
+	case TL_badMsgNotification, TL_badServerSalt, TL_msgContainer:
+		// they are used to fix client time, so they may have "wrong" time
+		// (and container messages are checked one by one)
+	default:
+		serverNow := time.Now().Add(m.TimeOffset())
+		msgTime := time.Unix(msgID>>32, 0)
+		if msgTime.Before(serverNow.Add(-inMsgMaxAge)) || msgTime.After(serverNow.Add(inMsgMaxFuture)) {
+			m.log.Warn("ignoring message #%d %T: its time %s is too far from server time %s", msgID, msg, msgTime, serverNow)
+			return false
+		}
+	}
+	if !m.inMsgIDs.add(msgID) {
+		m.log.Warn("ignoring message #%d %T: already received", msgID, msg)
+		return false
+	}
+	return true
+}
+
+// processIncoming is like process, but ignores replayed and outdated messages.
+// Ignored messages are still acknowledged (server may be resending them due to lost ack).
+func (m *MTProto) processIncoming(msgID int64, seqNo int32, msg TL, mayPassToHandler bool) {
+	if !m.checkInMsgID(msgID, msg) {
+		if (seqNo & 1) == 1 {
+			m.scheduleAck(msgID)
+		}
+		return
+	}
+	m.process(msgID, seqNo, msg, mayPassToHandler)
+}
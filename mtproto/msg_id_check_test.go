@@ -0,0 +1,43 @@
+package mtproto
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMsgIDWindow(t *testing.T) {
+	w := msgIDWindow{}
+	for i := int64(1); i <= inMsgIDsWindowSize; i++ {
+		if !w.add(i * 4) {
+			t.Fatalf("msg_id %d should be accepted", i*4)
+		}
+	}
+	if w.add(8) {
+		t.Errorf("duplicate msg_id should be rejected")
+	}
+	if w.add(2) {
+		t.Errorf("msg_id lower than all stored should be rejected")
+	}
+	if !w.add(10) || len(w.ids) != inMsgIDsWindowSize || w.ids[0] != 8 {
+		t.Errorf("new msg_id should replace the lowest one: %v", w.ids[:3])
+	}
+}
+
+func TestCheckInMsgID(t *testing.T) {
+	m := &MTProto{mutex: &sync.Mutex{}, log: Logger{Hnd: NoopLogHandler{}}}
+	now := time.Now().Unix() << 32
+	if !m.checkInMsgID(now|1, TL_pong{}) {
+		t.Errorf("message should be accepted")
+	}
+	if m.checkInMsgID(now|1, TL_pong{}) {
+		t.Errorf("replay should be rejected")
+	}
+	old := (time.Now().Unix() - 3600) << 32
+	if m.checkInMsgID(old|1, TL_pong{}) {
+		t.Errorf("old message should be rejected")
+	}
+	if !m.checkInMsgID(old|5, TL_badMsgNotification{}) {
+		t.Errorf("bad msg notification should be accepted regardless of time")
+	}
+}
@@ -0,0 +1,93 @@
+package mtproto
+
+import "time"
+
+// messages not acknowledged by server during this interval are checked with msgs_state_req
+const ackTimeout = 10 * time.Second
+
+// checkUnacked returns true if packet is still waiting for ack after ackTimeout,
+// so its state should be requested (with msgs_state_req). Check is then repeated after ackTimeout.
+// Messages not received by server are resent (see handleMsgsStateInfo).
+func (m *MTProto) checkUnacked(entry pendingWheelEntry) bool {
+	unacked := false
+	m.msgsByID.update(entry.msgID, func(packet *packetToSend) bool {
+		unacked = packet == entry.packet && packet.needAck
+		return false
+	})
+	if unacked {
+		m.pendingChecks.schedule(ackTimeout, entry)
+	}
+	return unacked
+}
+
+func (m *MTProto) requestMsgsState(ids []int64) {
+	m.log.Debug("requesting state of %d unacknowledged message(s)", len(ids))
+	resp := make(chan TL, 1)
+	m.enqueue(newPacket(TL_msgsStateReq{MsgIDs: ids}, resp))
+
+	var res TL
+	select {
+	case res = <-resp:
+	case <-time.After(ackTimeout):
+		m.log.Warn("no response to msgs_state_req")
+		return
+	}
+	switch info := res.(type) {
+	case TL_msgsStateInfo:
+		m.handleMsgsStateInfo(ids, info.Info)
+	case TL_msgsAllInfo:
+		// already handled by handleMsgsAllInfo
+	default:
+		m.log.Warn("unexpected response to msgs_state_req: %T", res)
+	}
+}
+
+// handleMsgsAllInfo handles msgs_all_info which server may send voluntarily or instead
+// of msgs_state_info. It contains its own list of message IDs, so it is not bound to the request,
+// but pending msgs_state_req for the same (or some of the same) messages is considered answered.
+func (m *MTProto) handleMsgsAllInfo(data TL_msgsAllInfo) {
+	m.handleMsgsStateInfo(data.MsgIDs, data.Info)
+
+	known := make(map[int64]bool, len(data.MsgIDs))
+	for _, id := range data.MsgIDs {
+		known[id] = true
+	}
+	var answered []int64
+	m.msgsByID.each(func(id int64, packet *packetToSend) bool {
+		if req, ok := packet.msg.(TL_msgsStateReq); ok {
+			for _, reqID := range req.MsgIDs {
+				if known[reqID] {
+					answered = append(answered, id)
+					break
+				}
+			}
+		}
+		return false
+	})
+	for _, id := range answered {
+		m.respAndClearPacketData(id, data)
+	}
+}
+
+// handleMsgsStateInfo resends messages that were not received by server
+// and stops waiting for ack of the received ones. States has one byte per message,
+// see https://core.telegram.org/mtproto/service_messages_about_messages#request-for-message-status
+func (m *MTProto) handleMsgsStateInfo(ids []int64, states string) {
+	if len(states) != len(ids) {
+		m.log.Warn("msgs_state_info: expected %d states, got %d", len(ids), len(states))
+		return
+	}
+	for i, id := range ids {
+		switch states[i] & 7 {
+		case 1, 2, 3: // not received, msg_id too low or too high
+			if !m.resendWithNewMsgID(id) {
+				m.log.Warn("message #%d was not received by server and will not be resent", id)
+			}
+		case 4: // received
+			m.msgsByID.update(id, func(packet *packetToSend) bool {
+				packet.needAck = false
+				return packet.resp == nil
+			})
+		}
+	}
+}
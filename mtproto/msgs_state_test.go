@@ -0,0 +1,53 @@
+package mtproto
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMsgsStateInfoResend(t *testing.T) {
+	m := &MTProto{
+		mutex:     &sync.Mutex{},
+		msgsByID:  newPendingPackets(),
+		sendQueue: make(chan *packetToSend, 2),
+		log:       Logger{Hnd: NoopLogHandler{}},
+	}
+	lost := &packetToSend{msgID: 100, msg: TL_help_getConfig{}, resp: make(chan TL, 1), needAck: true}
+	received := &packetToSend{msgID: 101, msg: TL_help_getConfig{}, needAck: true}
+	m.msgsByID.add(lost)
+	m.msgsByID.add(received)
+
+	m.handleMsgsStateInfo([]int64{100, 101}, string([]byte{1, 4}))
+
+	if resent := <-m.sendQueue; resent != lost || lost.msgID != 0 {
+		t.Fatalf("lost packet was not resent with new ID")
+	}
+	if len(m.sendQueue) != 0 {
+		t.Fatalf("received packet should not be resent")
+	}
+	if m.msgsByID.len() != 0 {
+		t.Fatalf("expected no pending packets, got %d", m.msgsByID.len())
+	}
+}
+
+func TestMsgsAllInfo(t *testing.T) {
+	m := &MTProto{
+		mutex:     &sync.Mutex{},
+		msgsByID:  newPendingPackets(),
+		sendQueue: make(chan *packetToSend, 1),
+		log:       Logger{Hnd: NoopLogHandler{}},
+	}
+	lost := &packetToSend{msgID: 100, msg: TL_help_getConfig{}, resp: make(chan TL, 1), needAck: true}
+	stateResp := make(chan TL, 1)
+	m.msgsByID.add(lost)
+	m.msgsByID.add(&packetToSend{msgID: 200, msg: TL_msgsStateReq{MsgIDs: []int64{100}}, resp: stateResp})
+
+	m.process(300, 0, TL_msgsAllInfo{MsgIDs: []int64{100}, Info: string([]byte{1})}, true)
+
+	if resent := <-m.sendQueue; resent != lost {
+		t.Fatalf("lost packet was not resent")
+	}
+	if _, ok := (<-stateResp).(TL_msgsAllInfo); !ok {
+		t.Errorf("msgs_state_req should be answered")
+	}
+}
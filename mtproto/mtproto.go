@@ -1,7 +1,7 @@
 package mtproto
 
 import (
-	cryptoRand "crypto/rand"
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -10,10 +10,10 @@ import (
 	"path/filepath"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ansel1/merry/v2"
-	"github.com/fatih/color"
 	"golang.org/x/net/proxy"
 	"golang.org/x/sync/semaphore"
 )
@@ -21,8 +21,6 @@ import (
 //go:generate go run scheme/generate_tl_schema.go 192 scheme/tl-schema-192.tl tl_schema.go
 //go:generate gofmt -w tl_schema.go
 
-const ROUTINES_COUNT = 5
-
 type SessionInfo struct {
 	DCID        int32  `json:"dc_id"`
 	AuthKey     []byte `json:"auth_key"`
@@ -48,7 +46,9 @@ type MTProto struct {
 	session      *SessionInfo
 	appCfg       *AppConfig
 	connDialer   proxy.Dialer
+	connStrategy ConnStrategy
 	conn         net.Conn
+	transport    Transport
 	log          Logger
 
 	// Two queues here.
@@ -60,25 +60,65 @@ type MTProto struct {
 	// network probles for example) messages back to internal queue and retry later.
 	extSendQueue chan *packetToSend //external
 	sendQueue    chan *packetToSend //internal
-
-	routinesStop chan struct{}
+	// internal lanes with higher and lower priority, see send_queue.go
+	serviceSendQueue chan *packetToSend
+	bulkSendQueue    chan *packetToSend
+	// limits number of external packets in internal queue (buffer size is same as extSendQueue)
+	queueSlots chan struct{}
+
+	stopRoutines context.CancelFunc // stops routines of the current connection, see startRoutine
+	routinesCtx  context.Context    // context of the current connection routines
 	routinesWG   sync.WaitGroup
 
 	mutex            *sync.Mutex
 	connectSemaphore *semaphore.Weighted
 	reconnSemaphore  *semaphore.Weighted
 
-	encryptionReady    bool
-	lastOutMsgID       int64
-	lastOutSeqNo       int32
-	msgsByID           map[int64]*packetToSend
-	handleEvent        func(TL)
-	handleReconnection func() error
+	encryptionReady      bool
+	lastOutMsgID         int64
+	lastOutSeqNo         int32
+	msgsByID             *pendingPackets   // see pending_packets.go
+	pendingChecks        *pendingWheel     // see pending_wheel.go
+	containerMsgs        map[int64][]int64 // sent container ID -> inner message IDs
+	pendingAcks          []int64           // received message IDs waiting to be acknowledged, see acks.go
+	ackTimer             *time.Timer
+	futureSalts          []TL_futureSalt // see salts.go
+	futureSaltsRequested bool
+	tempAuthKeyTTL       time.Duration
+	tempKey              *tempAuthKey // see temp_auth_key.go
+	inMsgIDs             msgIDWindow  // last received msg_ids, see msg_id_check.go
+	readBuf              []byte       // reused by read(), it is not called concurrently
+	decryptBuf           []byte       // same
+	serverKeys           []ServerPublicKey
+	handleEvent          func(TL) // guarded by mutex
+	events               chan TL  // events are passed to handleEvent by eventsWorkers goroutines
+	eventsWorkers        int
+	eventsStop           chan struct{} // stops events workers (guarded by mutex), nil if they are not running
+	dropEvents           bool          // see MTParams.DropEventsOnOverflow
+	handleReconnection   func() error
+
+	handleAuthKeyUnregistered func() error
+	reauthInProgress          bool
+	handleAuthKeyDuplicated   func()
+	handleFatalAuthError      func(error)
+	fatalAuthErr              error
 
 	lastInMsgTimeOffsetSec int64
 	outMsgIDTimeOffsetSec  int64
-
-	dcOptions []TL_dcOption
+	lastPongID             int64 // accessed atomically, see pingRoutine
+	rpcTimeout             time.Duration
+	floodWaitPolicy        *FloodWaitPolicy
+	autoMigrate            bool
+	withoutUpdates         bool
+	migrateConns           migrateConns
+	middlewares            []Middleware
+	invoker                Invoker
+	lastOrderedReq         chan struct{} // see orderedRequest
+	prevSessionID          int64         // session closed by Disconnect, see destroyPrevSession
+
+	dcOptions   []TL_dcOption
+	webfileDCID int32
+	latencies   dcLatencies
 }
 
 type packetReceived struct {
@@ -94,6 +134,13 @@ type packetToSend struct {
 	resp    chan TL
 	needAck bool
 	sentAt  time.Time
+	// msg_id the expiration and ack checks are scheduled for, see schedulePendingChecks
+	checksMsgID int64
+	// set (under mutex) when waiting for the response was abandoned, see SendCtx
+	cancelled      bool
+	floodRetries   int
+	resends        int
+	holdsQueueSlot bool
 }
 
 func newPacket(msg TL, resp chan TL) *packetToSend {
@@ -106,11 +153,51 @@ type MTParams struct {
 	AppHash    string
 	AppConfig  *AppConfig
 	ConnDialer proxy.Dialer
-	SessStore  SessionStore
-	Session    *SessionInfo
-	TimeOffset time.Duration
+	// ConnStrategy defines how connection is opened, SingleConnStrategy (abridged transport) by default.
+	// RacingConnStrategy may improve connection time on unstable or filtered networks.
+	ConnStrategy ConnStrategy
+	SessStore    SessionStore
+	Session      *SessionInfo
+	TimeOffset   time.Duration
+	// SendQueueSize is a number of requests that can be queued without blocking Send/SendSync.
+	// Also limits number of requests waiting for sending in internal queue. DefaultSendQueueSize if zero.
+	SendQueueSize int
+	// InternalQueueSize is capacity of internal queues (used for service messages and resending
+	// requests after reconnection). Should be greater than SendQueueSize. DefaultInternalQueueSize if zero.
+	InternalQueueSize int
+	// RPCTimeout is max time to wait for the response, DefaultRPCTimeout if zero, no limit if negative.
+	// After timeout request receives TL_rpcError (see IsRPCTimeout) and is forgotten.
+	RPCTimeout time.Duration
+	// FloodWaitPolicy enables automatic FLOOD_WAIT handling, see SetFloodWaitPolicy.
+	FloodWaitPolicy *FloodWaitPolicy
+	// NoAutoMigrate disables automatic *_MIGRATE_X errors handling (DC switch and request retry).
+	NoAutoMigrate bool
+	// WithoutUpdates wraps all requests in invokeWithoutUpdates, so this connection
+	// will not receive updates. Useful for worker-only clients. See also WithoutUpdates().
+	WithoutUpdates bool
+	// EventsQueueSize is a number of received events waiting for the events handler, DefaultEventsQueueSize if zero.
+	// If the queue is full, reading waits for the handler (see DropEventsOnOverflow).
+	EventsQueueSize int
+	// DropEventsOnOverflow makes reading never wait for the events handler: if the events queue is full,
+	// new events are dropped (with a warning). Missed updates with pts/qts/seq may be recovered
+	// later with updates.getDifference, other ones (statuses, typings, etc.) are lost.
+	DropEventsOnOverflow bool
+	// EventsWorkers is a number of goroutines calling events handler, DefaultEventsWorkers if zero. See SetEventsWorkers.
+	EventsWorkers int
+	// ServerPublicKeys are used during auth key exchange in addition to DefaultServerPublicKeys.
+	ServerPublicKeys []ServerPublicKey
+	// TempAuthKeyTTL enables perfect forward secrecy with temporary auth keys of this lifetime, see SetTempAuthKeyTTL.
+	TempAuthKeyTTL time.Duration
 }
 
+const (
+	DefaultRPCTimeout        = 5 * time.Minute
+	DefaultSendQueueSize     = 64
+	DefaultInternalQueueSize = 1024
+	DefaultEventsQueueSize   = 1024
+	DefaultEventsWorkers     = 1
+)
+
 func NewMTProto(appID int32, appHash string) *MTProto {
 	return NewMTProtoExt(MTParams{AppID: appID, AppHash: appHash})
 }
@@ -144,6 +231,30 @@ func NewMTProtoExt(params MTParams) *MTProto {
 		params.ConnDialer = &net.Dialer{}
 	}
 
+	if params.ConnStrategy == nil {
+		params.ConnStrategy = SingleConnStrategy{}
+	}
+
+	if params.SendQueueSize <= 0 {
+		params.SendQueueSize = DefaultSendQueueSize
+	}
+	if params.InternalQueueSize <= 0 {
+		params.InternalQueueSize = DefaultInternalQueueSize
+	}
+	if params.InternalQueueSize < params.SendQueueSize {
+		params.InternalQueueSize = params.SendQueueSize
+	}
+
+	if params.RPCTimeout == 0 {
+		params.RPCTimeout = DefaultRPCTimeout
+	}
+	if params.EventsQueueSize <= 0 {
+		params.EventsQueueSize = DefaultEventsQueueSize
+	}
+	if params.EventsWorkers <= 0 {
+		params.EventsWorkers = DefaultEventsWorkers
+	}
+
 	if params.SessStore == nil {
 		var exPath string
 		ex, err := os.Executable()
@@ -160,21 +271,37 @@ func NewMTProtoExt(params MTParams) *MTProto {
 		sessionStore: params.SessStore,
 		session:      params.Session,
 		connDialer:   params.ConnDialer,
+		connStrategy: params.ConnStrategy,
 		appCfg:       params.AppConfig,
 		log:          Logger{params.LogHandler},
 
-		extSendQueue: make(chan *packetToSend, 64),
-		sendQueue:    make(chan *packetToSend, 1024),
-		routinesStop: make(chan struct{}, ROUTINES_COUNT),
+		extSendQueue: make(chan *packetToSend, params.SendQueueSize),
+		sendQueue:    make(chan *packetToSend, params.InternalQueueSize),
 
-		msgsByID: make(map[int64]*packetToSend),
-		mutex:    &sync.Mutex{},
+		serviceSendQueue: make(chan *packetToSend, params.InternalQueueSize),
+		bulkSendQueue:    make(chan *packetToSend, params.InternalQueueSize),
+		queueSlots:       make(chan struct{}, params.SendQueueSize),
+		events:           make(chan TL, params.EventsQueueSize),
+		eventsWorkers:    params.EventsWorkers,
+		dropEvents:       params.DropEventsOnOverflow,
+
+		msgsByID:      newPendingPackets(),
+		pendingChecks: newPendingWheel(pendingWheelTick, pendingWheelSlots),
+		containerMsgs: make(map[int64][]int64),
+		mutex:         &sync.Mutex{},
 
 		connectSemaphore: semaphore.NewWeighted(1),
 		reconnSemaphore:  semaphore.NewWeighted(1),
 
 		outMsgIDTimeOffsetSec: int64(params.TimeOffset / time.Second),
+		rpcTimeout:            params.RPCTimeout,
+		floodWaitPolicy:       params.FloodWaitPolicy,
+		autoMigrate:           !params.NoAutoMigrate,
+		withoutUpdates:        params.WithoutUpdates,
+		tempAuthKeyTTL:        params.TempAuthKeyTTL,
+		serverKeys:            DefaultServerPublicKeys(),
 	}
+	m.AddServerPublicKeys(params.ServerPublicKeys...)
 	return m
 }
 
@@ -228,14 +355,128 @@ func (m *MTProto) DCAddr(dcID int32, ipv6 bool) (string, bool) {
 	return "", false
 }
 
+// WebfileDCID returns DC for downloading web files (upload.getWebFile), received from the config on connection.
+func (m *MTProto) WebfileDCID() int32 {
+	return m.webfileDCID
+}
+
+// SetEventsHandler sets handler for updates received from server.
+// Handler is called from separate goroutines (see SetEventsWorkers), so reading is not blocked by it.
+// Workers are stopped by Disconnect and started again on next connection.
 func (m *MTProto) SetEventsHandler(handler func(TL)) {
+	m.mutex.Lock()
 	m.handleEvent = handler
+	m.mutex.Unlock()
+	m.startEventsWorkers()
+}
+
+func (m *MTProto) eventsHandler() func(TL) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.handleEvent
+}
+
+// startEventsWorkers starts events workers if handler is set and they are not running yet.
+func (m *MTProto) startEventsWorkers() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.handleEvent == nil || m.eventsStop != nil {
+		return
+	}
+	m.eventsStop = make(chan struct{})
+	for i := 0; i < m.eventsWorkers; i++ {
+		go m.eventsRoutine(m.eventsStop)
+	}
+}
+
+// stopEventsWorkers stops events workers (without waiting for handlers), queued events are kept.
+func (m *MTProto) stopEventsWorkers() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.eventsStop != nil {
+		close(m.eventsStop)
+		m.eventsStop = nil
+	}
+}
+
+// SetEventsWorkers sets number of goroutines calling events handler (DefaultEventsWorkers by default).
+// With single worker events are handled one by one in order of receiving, with more workers
+// they may be handled concurrently and out of order. Should be called before SetEventsHandler.
+func (m *MTProto) SetEventsWorkers(count int) {
+	if count <= 0 {
+		count = DefaultEventsWorkers
+	}
+	m.eventsWorkers = count
+}
+
+func (m *MTProto) eventsRoutine(stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-m.events:
+			if handler := m.eventsHandler(); handler != nil {
+				handler(event)
+			}
+		}
+	}
+}
+
+// pushEvent passes event to events workers. Should be called only from readRoutine:
+// if the queue is full it waits (until the connection is closed) or drops the event, see DropEventsOnOverflow.
+func (m *MTProto) pushEvent(event TL) {
+	select {
+	case m.events <- event:
+		return
+	default:
+	}
+	if m.dropEvents {
+		m.log.Warn("events queue is full (handler is too slow?), dropping %T", event)
+		return
+	}
+	m.log.Warn("events queue is full (handler is too slow?), waiting")
+	select {
+	case m.events <- event:
+	case <-m.routinesCtx.Done():
+		m.log.Warn("connection closed while waiting for events queue, dropping %T", event)
+	}
 }
 
 func (m *MTProto) SetReconnectionHandler(handler func() error) {
 	m.handleReconnection = handler
 }
 
+// SetAuthKeyUnregisteredHandler sets handler that is called (in separate goroutine)
+// when some request fails with AUTH_KEY_UNREGISTERED (session was terminated or
+// authorization was not completed). Handler may re-authorize (for example with AuthEx).
+// While it is running, subsequent AUTH_KEY_UNREGISTERED errors do not trigger it again.
+// Requests itself still receive the error, use IsAuthKeyUnregistered to check for it.
+func (m *MTProto) SetAuthKeyUnregisteredHandler(handler func() error) {
+	m.handleAuthKeyUnregistered = handler
+}
+
+// SetAuthKeyDuplicatedHandler sets handler that is called (in separate goroutine)
+// after AUTH_KEY_DUPLICATED was received and the auth key was regenerated.
+// New key is not authorized, so the handler usually should re-authorize.
+func (m *MTProto) SetAuthKeyDuplicatedHandler(handler func()) {
+	m.handleAuthKeyDuplicated = handler
+}
+
+// SetFatalAuthErrorHandler sets OnFatalAuthError hook: it is called (in separate goroutine)
+// once when some request fails with SESSION_REVOKED, SESSION_EXPIRED or USER_DEACTIVATED
+// (err is ErrSessionRevoked, ErrSessionExpired or ErrUserDeactivated).
+// After that automatic reconnection is stopped, session can not be used anymore.
+func (m *MTProto) SetFatalAuthErrorHandler(handler func(err error)) {
+	m.handleFatalAuthError = handler
+}
+
+// FatalAuthError returns fatal auth error (see SetFatalAuthErrorHandler) if it was received.
+func (m *MTProto) FatalAuthError() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.fatalAuthErr
+}
+
 func (m *MTProto) initConection() error {
 	m.lastOutMsgID = 0
 	m.lastInMsgTimeOffsetSec = 0
@@ -243,11 +484,7 @@ func (m *MTProto) initConection() error {
 
 	m.log.Info("connecting to DC %d (%s)...", m.session.DCID, m.session.Addr)
 	var err error
-	m.conn, err = m.connDialer.Dial("tcp", m.session.Addr)
-	if err != nil {
-		return merry.Wrap(err)
-	}
-	_, err = m.conn.Write([]byte{0xef})
+	m.conn, m.transport, err = m.connStrategy.Connect(m.connDialer, m.session.DCID, m.session.Addr, m.log)
 	if err != nil {
 		return merry.Wrap(err)
 	}
@@ -262,6 +499,9 @@ func (m *MTProto) initConection() error {
 		}
 		m.encryptionReady = true
 	}
+	if err := m.prepareTempAuthKey(); err != nil {
+		return merry.Wrap(err)
+	}
 
 	// getting connection configs
 	m.log.Debug("connecting: getting config...")
@@ -284,6 +524,7 @@ func (m *MTProto) initConection() error {
 	if cfg, ok := x.(TL_config); ok {
 		m.session.DCID = cfg.ThisDC
 		m.dcOptions = cfg.DCOptions
+		m.webfileDCID = cfg.WebfileDCID
 	} else {
 		return WrongRespError(x)
 	}
@@ -305,7 +546,7 @@ func (m *MTProto) Connect() error {
 
 		if IsWrongClientTimeError(err) {
 			m.log.Info("client time seems inaccurate, applying correction")
-			m.outMsgIDTimeOffsetSec = m.lastInMsgTimeOffsetSec
+			atomic.StoreInt64(&m.outMsgIDTimeOffsetSec, m.lastInMsgTimeOffsetSec)
 		} else {
 			m.log.Error(err, "failed to connect")
 		}
@@ -318,12 +559,16 @@ func (m *MTProto) Connect() error {
 
 	// starting goroutines
 	m.log.Debug("connecting: starting routines...")
-	m.routinesWG.Add(ROUTINES_COUNT)
-	go m.sendRoutine()
-	go m.readRoutine()
-	go m.queueTransferRoutine() // straintg messages transfer from external to internal queue
-	go m.pingRoutine()          // starting keepalive pinging
-	go m.debugRoutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	m.stopRoutines = cancel
+	m.routinesCtx = ctx
+	m.startRoutine(ctx, "sendRoutine", m.sendRoutine)
+	m.startRoutine(ctx, "readRoutine", m.readRoutine)
+	m.startRoutine(ctx, "queueTransferRoutine", m.queueTransferRoutine) // messages transfer from external to internal queue
+	m.startRoutine(ctx, "pingRoutine", m.pingRoutine)                   // keepalive pinging
+	m.startRoutine(ctx, "maintenanceRoutine", m.maintenanceRoutine)
+	m.startEventsWorkers() // if they were stopped by Disconnect
+	go m.destroyPrevSession(ctx)
 
 	m.log.Info("connected to DC %d (%s)...", m.session.DCID, m.session.Addr)
 	return nil
@@ -333,10 +578,24 @@ func (m *MTProto) Reconnect() error {
 	return m.reconnect(0, true)
 }
 
+// Disconnect closes connection (and connections to other DCs). Next connection will use
+// a new session, the current one will be destroyed from it (see destroyPrevSession).
 func (m *MTProto) Disconnect() error {
+	newSession := m.conn != nil && m.encryptionReady
+	if err := m.closeMigrateConns(); err != nil {
+		m.log.Error(err, "failed to close connections to other DCs")
+	}
+	m.stopEventsWorkers()
 	if err := m.disconnect(true); err != nil {
 		return merry.Wrap(err)
 	}
+	if newSession {
+		m.mutex.Lock()
+		m.prevSessionID = m.session.sessionId
+		m.session.sessionId = rand.Int63()
+		m.lastOutSeqNo = 0
+		m.mutex.Unlock()
+	}
 	m.log.Info("disconnected.")
 	return nil
 }
@@ -344,11 +603,12 @@ func (m *MTProto) Disconnect() error {
 func (m *MTProto) disconnect(clearPendingMsgs bool) error {
 	// stopping routines
 	m.log.Debug("stopping routines...")
-	for i := 0; i < ROUTINES_COUNT; i++ {
-		m.routinesStop <- struct{}{}
+	if m.stopRoutines != nil {
+		m.stopRoutines()
+		m.stopRoutines = nil
 	}
 
-	// closing connection, readRoutine will then fail to read() and will handle stop signal
+	// closing connection, readRoutine will then fail to read() and will notice cancelled context
 	if m.conn != nil {
 		if err := m.conn.Close(); err != nil && !IsClosedConnErr(err) {
 			return merry.Wrap(err)
@@ -359,22 +619,11 @@ func (m *MTProto) disconnect(clearPendingMsgs bool) error {
 	m.log.Debug("waiting for routines...")
 	m.routinesWG.Wait()
 	m.log.Debug("done stopping routines...")
-
-	// removing unused stop signals (if any)
-	for empty := false; !empty; {
-		select {
-		case <-m.routinesStop:
-		default:
-			empty = true
-		}
-	}
+	m.dropPendingAcks()
 
 	if clearPendingMsgs {
-		m.mutex.Lock()
-		for id := range m.msgsByID {
-			delete(m.msgsByID, id)
-		}
-		m.mutex.Unlock()
+		m.msgsByID.clear()
+		m.pendingChecks.clear()
 	}
 
 	return nil
@@ -389,6 +638,10 @@ func (m *MTProto) reconnectLogged() {
 	defer func() { m.reconnSemaphore.Release(1) }()
 
 	for {
+		if err := m.FatalAuthError(); err != nil {
+			m.log.Error(err, "not reconnecting")
+			return
+		}
 		err := m.reconnect(0, true)
 		if err == nil {
 			return
@@ -403,25 +656,33 @@ func (m *MTProto) reconnectLogged() {
 func (m *MTProto) reconnect(newDcID int32, mayPassToHandler bool) error {
 	m.log.Info("reconnecting: DC %d -> %d", m.session.DCID, newDcID)
 
+	// exporting authorization (if any) while still connected to the old DC
+	var exportedAuth *TL_auth_exportedAuthorization
+	if newDcID != 0 && newDcID != m.session.DCID {
+		var err error
+		exportedAuth, err = m.exportAuthorization(newDcID)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+	}
+
 	if err := m.disconnect(false); err != nil {
 		return merry.Wrap(err)
 	}
 
 	// saving IDs of messages from msgsByID[],
 	// some of them may not have been sent, so we'll resend them after reconnection
-	pendingIDs := make([]int64, 0, len(m.msgsByID))
-	m.mutex.Lock()
-	for id := range m.msgsByID {
+	var pendingIDs []int64
+	m.msgsByID.each(func(id int64, _ *packetToSend) bool {
 		pendingIDs = append(pendingIDs, id)
-	}
-	m.mutex.Unlock()
+		return false
+	})
 	m.log.Debug("found %d pending packet(s)", len(pendingIDs))
 
 	if newDcID != 0 {
 		// renewing connection
 		if newDcID != m.session.DCID {
-			m.encryptionReady = false //TODO: export auth here (if authed)
-			//https://github.com/sochix/TLSharp/blob/0940d3d982e9c22adac96b6c81a435403802899a/TLSharp.Core/TelegramClient.cs#L84
+			m.encryptionReady = false // new DC, new auth key
 		}
 		newDcAddr, ok := m.DCAddr(newDcID, false)
 		if !ok {
@@ -435,6 +696,14 @@ func (m *MTProto) reconnect(newDcID int32, mayPassToHandler bool) error {
 		return merry.Wrap(err)
 	}
 
+	// pending messages will likely require authorization, so importing it first
+	if exportedAuth != nil {
+		if err := m.importAuthorization(*exportedAuth); err != nil {
+			return merry.Wrap(err)
+		}
+		m.log.Info("authorization imported to DC %d", m.session.DCID)
+	}
+
 	// Checking pending messages.
 	// 1) some of them may have been answered, so they will not be in msgsByID[]
 	// 2) some of them may have been received by TG, but response has not reached us yet
@@ -443,15 +712,13 @@ func (m *MTProto) reconnect(newDcID int32, mayPassToHandler bool) error {
 	// are preserved, TG will ignore doubles from (2). And (3) will finally reach TG.
 	if len(pendingIDs) > 0 {
 		var packets []*packetToSend
-		m.mutex.Lock()
 		for _, id := range pendingIDs {
-			packet, ok := m.msgsByID[id]
-			if ok {
+			if packet, ok := m.msgsByID.get(id); ok {
 				packets = append(packets, packet)
 			}
 		}
-		m.pushPendingPacketsUnlocked(packets)
-		m.mutex.Unlock()
+		// without holding any locks: send queue may be full, sendRoutine needs mutex to empty it
+		m.pushPendingPackets(packets)
 	}
 
 	m.log.Info("reconnected to DC %d (%s)", m.session.DCID, m.session.Addr)
@@ -466,25 +733,57 @@ func (m *MTProto) reconnect(newDcID int32, mayPassToHandler bool) error {
 }
 
 func (m *MTProto) NewConnection(dcID int32) (*MTProto, error) {
+	addr, ok := m.DCAddr(dcID, false)
+	if !ok {
+		m.log.Debug("known DC options: %#v", m.dcOptions)
+		return nil, merry.Errorf("unable find address for DC #%d", dcID)
+	}
+	return m.newConnection(dcID, addr)
+}
+
+// NewMediaConnection is like NewConnection but connects to the fastest
+// (preferably media-only) DC address measured by ProbeDCLatencies.
+func (m *MTProto) NewMediaConnection(dcID int32) (*MTProto, error) {
+	addr, ok := m.DCAddrFastest(dcID, true)
+	if !ok {
+		m.log.Debug("known DC options: %#v", m.dcOptions)
+		return nil, merry.Errorf("unable find address for DC #%d", dcID)
+	}
+	return m.newConnection(dcID, addr)
+}
+
+func (m *MTProto) newConnection(dcID int32, addr string) (*MTProto, error) {
+	return m.newConnectionExt(dcID, addr, m.tempAuthKeyTTL)
+}
+
+// newConnectionExt is like newConnection but with custom temporary auth keys TTL (zero disables them).
+func (m *MTProto) newConnectionExt(dcID int32, addr string, tempAuthKeyTTL time.Duration) (*MTProto, error) {
 	session := m.CopySession()
-	m.log.Info("making new connection to DC %d (current: %d)", dcID, session.DCID)
+	m.log.Info("making new connection to DC %d (%s, current: %d)", dcID, addr, session.DCID)
 	isOnSameDC := session.DCID == dcID
 	encrIsReady := isOnSameDC
 	session.DCID = dcID
-	var ok bool
-	session.Addr, ok = m.DCAddr(dcID, false)
-	if !ok {
-		fmt.Printf("%#v\n", m.dcOptions)
-		return nil, merry.Errorf("unable find address for DC #%d", dcID)
-	}
+	session.Addr = addr
 
 	newMT := NewMTProtoExt(MTParams{
-		AppConfig:  m.appCfg,
-		SessStore:  &SessNoopStore{},
-		Session:    session,
-		LogHandler: m.log.Hnd,
-		ConnDialer: m.connDialer,
-		TimeOffset: time.Duration(m.outMsgIDTimeOffsetSec) * time.Second,
+		AppConfig:         m.appCfg,
+		SessStore:         &SessNoopStore{},
+		Session:           session,
+		LogHandler:        m.log.Hnd,
+		ConnDialer:        m.connDialer,
+		ConnStrategy:      m.connStrategy,
+		TimeOffset:        m.TimeOffset(),
+		RPCTimeout:        m.rpcTimeout,
+		FloodWaitPolicy:   m.floodWaitPolicy,
+		TempAuthKeyTTL:    tempAuthKeyTTL,
+		ServerPublicKeys:  m.ServerPublicKeys(),
+		SendQueueSize:     cap(m.extSendQueue),
+		InternalQueueSize: cap(m.sendQueue),
+		// connections to other DCs are used for specific requests (like file parts),
+		// callers handle migration themselves
+		NoAutoMigrate: true,
+		// they also should not consume updates (which are not handled anyway)
+		WithoutUpdates: true,
 	})
 	if err := newMT.InitSession(encrIsReady); err != nil {
 		return nil, merry.Wrap(err)
@@ -494,75 +793,211 @@ func (m *MTProto) NewConnection(dcID int32) (*MTProto, error) {
 	}
 
 	if !isOnSameDC {
-		res := m.SendSync(TL_auth_exportAuthorization{DCID: dcID})
-		exported, ok := res.(TL_auth_exportedAuthorization)
-		if !ok {
-			return nil, merry.New(UnexpectedTL("auth export", res))
+		exported, err := m.exportAuthorization(dcID)
+		if err != nil {
+			return nil, merry.Wrap(err)
 		}
-		res = newMT.SendSync(TL_auth_importAuthorization(exported))
-		if _, ok := res.(TL_auth_authorization); !ok {
-			return nil, merry.New(UnexpectedTL("auth import", res))
+		if exported == nil {
+			return nil, merry.New("can not export authorization: current connection is not authorized")
+		}
+		if err := newMT.importAuthorization(*exported); err != nil {
+			return nil, merry.Wrap(err)
 		}
 	}
 	return newMT, nil
 }
 
+// exportAuthorization exports current authorization for DC dcID.
+// Returns nil (without error) if current connection is not authorized.
+func (m *MTProto) exportAuthorization(dcID int32) (*TL_auth_exportedAuthorization, error) {
+	res := m.SendSync(TL_auth_exportAuthorization{DCID: dcID})
+	if IsErrorType(res, TL_ErrUnauthorized) {
+		m.log.Debug("not exporting authorization to DC %d: not authorized", dcID)
+		return nil, nil
+	}
+	exported, ok := res.(TL_auth_exportedAuthorization)
+	if !ok {
+		return nil, merry.New(UnexpectedTL("auth export", res))
+	}
+	return &exported, nil
+}
+
+func (m *MTProto) importAuthorization(exported TL_auth_exportedAuthorization) error {
+	res := m.SendSync(TL_auth_importAuthorization(exported))
+	if _, ok := res.(TL_auth_authorization); !ok {
+		return merry.New(UnexpectedTL("auth import", res))
+	}
+	return nil
+}
+
+// prepareRequest applies connection-wide request wrappers.
+func (m *MTProto) prepareRequest(msg TLReq) TLReq {
+	if m.withoutUpdates {
+		return WithoutUpdates(msg)
+	}
+	return msg
+}
+
 func (m *MTProto) Send(msg TLReq) chan TL {
-	resp := make(chan TL, 1)
-	m.extSendQueue <- newPacket(msg, resp)
-	return resp
+	m.mutex.Lock()
+	invoker := m.invoker
+	if invoker == nil {
+		m.mutex.Unlock()
+		// queueing synchronously to preserve requests order
+		resp := make(chan TL, 1)
+		m.extSendQueue <- newPacket(m.prepareRequest(msg), resp)
+		return resp
+	}
+	req := m.newOrderedRequestUnlocked()
+	m.mutex.Unlock()
+
+	res := make(chan TL, 1)
+	go func() {
+		defer close(res)
+		if r := m.invokeOrdered(invoker, req, msg); r != nil {
+			res <- r
+		}
+	}()
+	return res
 }
 
 func (m *MTProto) SendSync(msg TLReq) TL {
+	return m.invoke(context.Background(), msg)
+}
+
+// SendCtx is like Send but abandons the request when ctx is done:
+// it is removed from pending requests (or will not be sent at all if it is still queued)
+// and response channel is closed without value.
+func (m *MTProto) SendCtx(ctx context.Context, msg TLReq) chan TL {
 	resp := make(chan TL, 1)
-	m.extSendQueue <- newPacket(msg, resp)
-	return <-resp
+	go func() {
+		defer close(resp)
+		if res, err := m.SendSyncCtx(ctx, msg); err == nil {
+			resp <- res
+		}
+	}()
+	return resp
+}
+
+// SendSyncCtx is like SendSync but returns ctx.Err() if ctx is done before the response is received.
+func (m *MTProto) SendSyncCtx(ctx context.Context, msg TLReq) (TL, error) {
+	res := m.invoke(ctx, msg)
+	if res == nil && ctx.Err() != nil {
+		return nil, merry.Wrap(ctx.Err())
+	}
+	return res, nil
+}
+
+var ErrNoResponse = merry.Sentinel("request was dropped without response")
+
+// Invoke is like SendSyncCtx but also returns errors for failed requests:
+// RPC errors (including RPC timeout, see IsRPCTimeout) and bad message notifications
+// are returned as WrongRespError (use AsRPCError, IsFloodError, etc. to inspect them),
+// requests dropped without response (for example on disconnect) return ErrNoResponse,
+// requests exceeding server message size limit return ErrMessageTooLarge.
+func (m *MTProto) Invoke(ctx context.Context, msg TLReq) (TL, error) {
+	res, err := m.SendSyncCtx(ctx, msg)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	switch res.(type) {
+	case nil:
+		return nil, merry.Wrap(ErrNoResponse)
+	case TL_rpcError, TL_badMsgNotification:
+		if IsMessageTooLarge(res) {
+			return nil, merry.Wrap(ErrMessageTooLarge, merry.AppendMessagef("%T", msg))
+		}
+		return nil, WrongRespError(res)
+	}
+	return res, nil
+}
+
+// SendAs sends request and returns response of expected type T.
+// Any other response (including TL_rpcError) is returned as WrongRespError.
+//
+//	cfg, err := mtproto.SendAs[mtproto.TL_config](m, mtproto.TL_help_getConfig{})
+func SendAs[T TL](m *MTProto, msg TLReq) (T, error) {
+	return castResp[T](m.SendSync(msg))
+}
+
+// SendAsCtx is SendAs with context, see SendSyncCtx.
+func SendAsCtx[T TL](ctx context.Context, m *MTProto, msg TLReq) (T, error) {
+	res, err := m.SendSyncCtx(ctx, msg)
+	if err != nil {
+		var zero T
+		return zero, merry.Wrap(err)
+	}
+	return castResp[T](res)
+}
+
+func castResp[T TL](res TL) (T, error) {
+	resT, ok := res.(T)
+	if !ok {
+		return resT, merry.WrapSkipping(UnexpectedTypeError{Value: res}, 2)
+	}
+	return resT, nil
 }
 
 func (m *MTProto) SendSyncRetry(
 	msg TLReq, failRetryInterval time.Duration,
 	floodNumShortRetries int, floodMaxWait time.Duration,
 ) TL {
+	res, _ := m.SendSyncRetryCtx(context.Background(), msg, failRetryInterval, floodNumShortRetries, floodMaxWait)
+	return res
+}
+
+// SendSyncRetryCtx is like SendSyncRetry but returns ctx.Err() if ctx is done
+// before the response is received (including while waiting before the next retry).
+func (m *MTProto) SendSyncRetryCtx(
+	ctx context.Context, msg TLReq, failRetryInterval time.Duration,
+	floodNumShortRetries int, floodMaxWait time.Duration,
+) (TL, error) {
 	retryNum := -1
 	for {
 		retryNum += 1
-		res := m.SendSync(msg)
+		res, err := m.SendSyncCtx(ctx, msg)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
 
+		var wait time.Duration
 		if IsError(res, "RPC_CALL_FAIL") {
 			m.log.Warn("got RPC error, retrying in %s", failRetryInterval)
-			time.Sleep(failRetryInterval)
-			continue
-		}
-
-		// TL_rpc_error{ErrorCode:-503, ErrorMessage:"Timeout"}
-		// UPD: seems the message was checnged to "Timedout". Not sure if old one is absolete or not. Checking both just in case.
-		if IsError(res, "Timeout") || IsError(res, "Timedout") {
+			wait = failRetryInterval
+		} else if IsError(res, "Timeout") || IsError(res, "Timedout") {
+			// TL_rpc_error{ErrorCode:-503, ErrorMessage:"Timeout"}
+			// UPD: seems the message was checnged to "Timedout". Not sure if old one is absolete or not. Checking both just in case.
 			m.log.Warn("got RPC timeout, retrying in %s", failRetryInterval)
-			time.Sleep(failRetryInterval)
-			continue
-		}
-
-		if floodWait, ok := IsFloodError(res); ok {
+			wait = failRetryInterval
+		} else if floodWait, ok := IsFloodError(res); ok {
 			if retryNum < floodNumShortRetries {
 				floodWait = failRetryInterval
 			}
 			if floodWait > floodMaxWait {
-				return res
+				return res, nil
 			}
 			m.log.Warn("got flood-wait, retrying in %s, retry #%d of %d short",
 				floodWait, retryNum, floodNumShortRetries)
-			time.Sleep(floodWait)
-			continue
+			wait = floodWait
+		} else {
+			return res, nil
 		}
 
-		return res
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, merry.Wrap(ctx.Err())
+		}
 	}
 }
 
 // Must be called only when sendRoutine and recvRoutine are stopped!
 func (m *MTProto) sendAndReadDirect(msg TLReq) (TL, error) {
-	resp := make(chan TL, 1)
-	outPacket := newPacket(msg, resp)
+	return m.sendPacketAndReadDirect(newPacket(msg, make(chan TL, 1)))
+}
+
+func (m *MTProto) sendPacketAndReadDirect(outPacket *packetToSend) (TL, error) {
+	resp := outPacket.resp
 	err := m.send(outPacket)
 	if err != nil {
 		return nil, merry.Wrap(err)
@@ -578,7 +1013,14 @@ func (m *MTProto) sendAndReadDirect(msg TLReq) (TL, error) {
 			case <-stopSend:
 				close(stopSendDone)
 				return
+			case x := <-m.serviceSendQueue:
+				m.log.Debug("direct send: sending: %#v", x)
+				if err := m.send(x); err != nil {
+					sendErr <- err
+					return
+				}
 			case x := <-m.sendQueue:
+				m.releaseQueueSlot(x)
 				m.log.Debug("direct send: sending: %#v", x)
 				if err := m.send(x); err != nil {
 					sendErr <- err
@@ -600,7 +1042,7 @@ func (m *MTProto) sendAndReadDirect(msg TLReq) (TL, error) {
 			m.clearPacketData(outPacket.msgID)
 			return nil, merry.Wrap(err)
 		}
-		m.process(inPacket.msgID, inPacket.seqNo, inPacket.msg, false)
+		m.processIncoming(inPacket.msgID, inPacket.seqNo, inPacket.msg, false)
 		select {
 		case res := <-resp:
 			return res, nil
@@ -613,396 +1055,363 @@ func (m *MTProto) sendAndReadDirect(msg TLReq) (TL, error) {
 	}
 }
 
-type AuthDataProvider interface {
-	PhoneNumber() (string, error)
-	Code() (string, error)
-	Password() (string, error)
-}
-
-type ScanfAuthDataProvider struct{}
-
-func (ap ScanfAuthDataProvider) PhoneNumber() (string, error) {
-	var phonenumber string
-	fmt.Print("Enter phone number: ")
-	// Explictly reading intil "\n".
-	// Otherwise on Windows (where Enter produces two characters "\r\n") the "\n"
-	// will not be read by current Scanf, and next Scanf will read empty string.
-	// https://github.com/golang/go/issues/23562#issuecomment-1006666338
-	fmt.Scanf("%s\n", &phonenumber)
-	return phonenumber, nil
-}
-
-func (ap ScanfAuthDataProvider) Code() (string, error) {
-	var code string
-	fmt.Print("Enter code: ")
-	fmt.Scanf("%s\n", &code)
-	return code, nil
-}
-
-func (ap ScanfAuthDataProvider) Password() (string, error) {
-	var passwd string
-	fmt.Print("Enter password: ")
-	fmt.Scanf("%s\n", &passwd)
-	return passwd, nil
-}
-
-func (m *MTProto) Auth(authData AuthDataProvider) error {
-	phonenumber, err := authData.PhoneNumber()
-	if err != nil {
-		return merry.Wrap(err)
-	}
-
-	var authSentCode TL_auth_sentCode
-	flag := true
-	for flag {
-		x := m.SendSync(TL_auth_sendCode{
-			PhoneNumber: phonenumber,
-			APIID:       m.appCfg.AppID,
-			APIHash:     m.appCfg.AppHash,
-			Settings:    TL_codeSettings{CurrentNumber: true},
-		})
-		switch x := x.(type) {
-		case TL_auth_sentCode:
-			authSentCode = x
-			flag = false
-		case TL_rpcError:
-			if x.ErrorCode != TL_ErrSeeOther {
-				return WrongRespError(x)
-			}
-			var newDc int32
-			n, _ := fmt.Sscanf(x.ErrorMessage, "PHONE_MIGRATE_%d", &newDc)
-			if n != 1 {
-				n, _ := fmt.Sscanf(x.ErrorMessage, "NETWORK_MIGRATE_%d", &newDc)
-				if n != 1 {
-					n, _ := fmt.Sscanf(x.ErrorMessage, "USER_MIGRATE_%d", &newDc)
-					if n != 1 {
-						return merry.Errorf("RPC error_string:%s", x.ErrorMessage)
-					}
-				}
-			}
-
-			if err := m.reconnect(newDc, false); err != nil {
-				return merry.Wrap(err)
-			}
-			//TODO: save session here?
-		default:
-			return WrongRespError(x)
-		}
-	}
-
-	code, err := authData.Code()
-	if err != nil {
-		return merry.Wrap(err)
-	}
-
-	//if authSentCode.Phone_registered
-	x := m.SendSync(TL_auth_signIn{
-		PhoneNumber:       phonenumber,
-		PhoneCodeHash:     authSentCode.PhoneCodeHash,
-		PhoneCode:         Ref(code),
-		EmailVerification: nil,
-	})
-	if IsError(x, "SESSION_PASSWORD_NEEDED") {
-		x = m.SendSync(TL_account_getPassword{})
-		accPasswd, ok := x.(TL_account_password)
-		if !ok {
-			return WrongRespError(x)
-		}
-
-		passwd, err := authData.Password()
-		if err != nil {
-			return merry.Wrap(err)
-		}
-
-		algo, ok := accPasswd.CurrentAlgo.(TL_passwordKDFAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow)
-		if !ok {
-			return merry.Errorf("unknown password algo %T, application update is maybe needed to log in",
-				accPasswd.CurrentAlgo)
-		}
-		passwdSRP, err := calcInputCheckPasswordSRP(algo, accPasswd, passwd, cryptoRand.Read, m.log.Debug)
-		if err != nil {
-			return merry.Wrap(err)
-		}
-		x = m.SendSync(TL_auth_checkPassword{passwdSRP})
-		if _, ok := x.(TL_rpcError); ok {
-			return WrongRespError(x)
-		}
-	}
-	auth, ok := x.(TL_auth_authorization)
-	if !ok {
-		return merry.Errorf("RPC: %#v", x)
-	}
-	userSelf := auth.User.(TL_user)
-	m.log.Info("Signed in: id %d name <%s %s>\n", userSelf.ID, DerefOr(userSelf.FirstName, ""), DerefOr(userSelf.LastName, ""))
-	return nil
-}
-
-//	func (m *MTProto) popPendingPackets() []*packetToSend {
-//		m.mutex.Lock()
-//		defer m.mutex.Unlock()
-//		return m.popPendingPacketsUnlocked()
-//	}
-//	func (m *MTProto) pushPendingPackets(packets []*packetToSend) {
-//		m.mutex.Lock()
-//		defer m.mutex.Unlock()
-//		m.pushPendingPacketsUnlocked(packets)
-//	}
-
-func (m *MTProto) popPendingPacketsUnlocked() []*packetToSend {
-	packets := make([]*packetToSend, 0, len(m.msgsByID))
-	msgs := make([]TL, 0)
-	for id, packet := range m.msgsByID {
-		delete(m.msgsByID, id)
-		packets = append(packets, packet)
-		msgs = append(msgs, packet.msg)
-	}
-	m.log.Debug("popped %d pending packet(s): %#v", len(packets), msgs)
-	return packets
-}
-func (m *MTProto) pushPendingPacketsUnlocked(packets []*packetToSend) {
+func (m *MTProto) pushPendingPackets(packets []*packetToSend) {
 	for _, packet := range packets {
-		m.sendQueue <- packet
+		m.enqueue(packet)
 	}
 	m.log.Debug("pushed %d pending packet(s)", len(packets))
 }
-func (m *MTProto) resendPendingPackets() {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	packets := m.popPendingPacketsUnlocked()
-	m.pushPendingPacketsUnlocked(packets)
+
+// Contact is an account contact returned by GetContacts.
+type Contact struct {
+	UserID int64
+	User   TL_user // zero value if user was not returned by server
+	Mutual bool
 }
 
-// GetContacts prints account contacts as a table.
-// For demonstration/debuging purposes.
-func (m *MTProto) GetContacts() error {
+// GetContacts returns account contacts (via contacts.getContacts).
+func (m *MTProto) GetContacts() ([]Contact, error) {
 	x := m.SendSync(TL_contacts_getContacts{0})
 	list, ok := x.(TL_contacts_contacts)
 	if !ok {
-		return merry.Errorf("RPC: %#v", x)
+		return nil, WrongRespError(x)
 	}
 
-	contacts := make(map[int64]TL_user)
+	users := make(map[int64]TL_user)
 	for _, v := range list.Users {
 		if v, ok := v.(TL_user); ok {
-			contacts[v.ID] = v
-		}
-	}
-	// writing to stderr because otherwise this output (stdout)
-	// may mess up with logs output (which is sent to stderr) on Windows
-	color.New(color.FgYellow, color.Bold).Fprintf(
-		color.Error,
-		"%10s    %10s    %-30s    %-20s\n",
-		"id", "mutual", "name", "username",
-	)
-	for _, v := range list.Contacts {
-		fmt.Fprintf(
-			color.Error,
-			"%10d    %10t    %-30s    %-20s\n",
-			v.UserID,
-			v.Mutual,
-			fmt.Sprintf("%s %s", DerefOr(contacts[v.UserID].FirstName, ""), DerefOr(contacts[v.UserID].LastName, "")),
-			DerefOr(contacts[v.UserID].Username, "---"),
-		)
+			users[v.ID] = v
+		}
 	}
-
-	return nil
+	contacts := make([]Contact, len(list.Contacts))
+	for i, v := range list.Contacts {
+		contacts[i] = Contact{UserID: v.UserID, User: users[v.UserID], Mutual: v.Mutual}
+	}
+	return contacts, nil
 }
 
-func (m *MTProto) pingRoutine() {
-	defer func() {
-		m.log.Debug("pingRoutine done")
-		m.routinesWG.Done()
+// startRoutine runs connection routine in a separate goroutine. Routine must return when ctx is done,
+// disconnect waits for all routines to finish.
+func (m *MTProto) startRoutine(ctx context.Context, name string, routine func(ctx context.Context)) {
+	m.routinesWG.Add(1)
+	go func() {
+		defer func() {
+			m.log.Debug("%s done", name)
+			m.routinesWG.Done()
+		}()
+		routine(ctx)
 	}()
+}
+
+func (m *MTProto) sendRoutine(ctx context.Context) {
 	for {
-		select {
-		case <-m.routinesStop:
+		x := m.nextPacket(ctx)
+		if x == nil {
+			return
+		}
+		err := m.sendBatch(m.collectBatch(x))
+		if IsClosedConnErr(err) {
+			continue //closed connection, routines should be stopped now
+		}
+		if err != nil {
+			m.log.Error(err, "sending failed")
+			go m.reconnectLogged()
 			return
-		case <-time.After(60 * time.Second):
-			m.extSendQueue <- newPacket(TL_ping{0xCADACADA}, nil)
 		}
 	}
 }
 
-func (m *MTProto) sendRoutine() {
-	defer func() {
-		m.log.Debug("sendRoutine done")
-		m.routinesWG.Done()
-	}()
-	for {
-		select {
-		case <-m.routinesStop:
-			return
-		case x := <-m.sendQueue:
-			err := m.send(x)
-			if IsClosedConnErr(err) {
-				continue //closed connection, should receive stop signal now
-			}
-			if err != nil {
-				m.log.Error(err, "sending failed")
-				go m.reconnectLogged()
-				return
-			}
+// collectBatch returns first packet along with other already queued packets (if any)
+// and pending acks (so they are sent in the same container).
+func (m *MTProto) collectBatch(first *packetToSend) []*packetToSend {
+	packets := []*packetToSend{first}
+	if _, isAck := first.msg.(TL_msgsACK); !isAck {
+		if acks := m.takePendingAcksPacket(); acks != nil {
+			packets = append(packets, acks)
+		}
+	}
+	for len(packets) < containerMaxMessages {
+		x := m.pollPacket()
+		if x == nil {
+			break
 		}
+		packets = append(packets, x)
 	}
+	return packets
 }
 
-func (m *MTProto) readRoutine() {
-	defer func() {
-		m.log.Debug("readRoutine done")
-		m.routinesWG.Done()
-	}()
+func (m *MTProto) readRoutine(ctx context.Context) {
 	for {
-		select {
-		case <-m.routinesStop:
+		if ctx.Err() != nil {
 			return
-		default:
 		}
 
 		inPacket, err := m.read()
 		if IsClosedConnErr(err) {
-			continue //closed connection, should receive stop signal now
+			continue //closed connection, routines should be stopped now
 		}
 		if err != nil {
 			m.log.Error(err, "reading failed")
 			go m.reconnectLogged()
 			return
 		}
-		m.process(inPacket.msgID, inPacket.seqNo, inPacket.msg, true)
+		m.processIncoming(inPacket.msgID, inPacket.seqNo, inPacket.msg, true)
 	}
 }
 
-func (m *MTProto) queueTransferRoutine() {
-	defer func() {
-		m.log.Debug("queueTransferRoutine done")
-		m.routinesWG.Done()
-	}()
+func (m *MTProto) queueTransferRoutine(ctx context.Context) {
 	for {
-		if len(m.sendQueue) < cap(m.extSendQueue) {
-			select {
-			case <-m.routinesStop:
-				return
-			case msg := <-m.extSendQueue:
-				m.sendQueue <- msg
-			}
-		} else {
-			select {
-			case <-m.routinesStop:
-				return
-			default:
-				time.Sleep(10000 * time.Microsecond)
-			}
+		// waiting for free slot in internal queue, it is released when packet is taken for sending
+		select {
+		case <-ctx.Done():
+			return
+		case m.queueSlots <- struct{}{}:
 		}
-	}
-}
-
-// Periodically checks messages in "msgsByID" and warns if they stay there too long
-func (m *MTProto) debugRoutine() {
-	defer func() {
-		m.log.Debug("debugRoutine done")
-		m.routinesWG.Done()
-	}()
-	for {
 		select {
-		case <-m.routinesStop:
+		case <-ctx.Done():
+			<-m.queueSlots
 			return
-		case <-time.After(5 * time.Second):
+		case msg := <-m.extSendQueue:
+			msg.holdsQueueSlot = true
+			m.enqueue(msg)
 		}
+	}
+}
 
-		m.mutex.Lock()
-		count := 0
-		for id, packet := range m.msgsByID {
-			delta := time.Since(packet.sentAt)
-			if delta > 5*time.Second {
-				m.log.Warn("msgsByID: #%d: is here for %ds", id, int64(delta/time.Second))
-			}
-			count++
-		}
-		m.mutex.Unlock()
-		m.log.Debug("msgsByID: %d total", count)
+// cancelPacket stops waiting for the packet response:
+// removes it from msgsByID and closes its response channel (if still open).
+// If the request was already sent, server is asked to drop the answer.
+func (m *MTProto) cancelPacket(packet *packetToSend) {
+	m.mutex.Lock()
+	packet.cancelled = true
+	wasPending := false
+	if packet.msgID != 0 {
+		_, wasPending = m.msgsByID.removeIf(packet.msgID, func(p *packetToSend) bool { return p == packet })
+	}
+	if packet.resp != nil {
+		close(packet.resp)
+		packet.resp = nil
+	}
+	m.mutex.Unlock()
+
+	if wasPending {
+		m.dropAnswer(packet.msgID)
 	}
 }
 
+// Cancel abandons pending request with message ID msgID (response channel is closed without value)
+// and sends rpc_drop_answer, so server may stop processing it.
+// Returns false if there is no such pending request.
+// https://core.telegram.org/mtproto/service_messages#cancellation-of-an-rpc-query
+func (m *MTProto) Cancel(msgID int64) bool {
+	packet, ok := m.msgsByID.get(msgID)
+	if !ok {
+		return false
+	}
+	m.cancelPacket(packet)
+	return true
+}
+
+func (m *MTProto) dropAnswer(msgID int64) {
+	resp := make(chan TL, 1)
+	m.enqueue(newPacket(TL_rpcDropAnswer{ReqMsgID: msgID}, resp))
+	go func() {
+		if res, ok := <-resp; ok {
+			m.log.Debug("answer to #%d dropped: %T", msgID, res)
+		}
+	}()
+}
+
 func (m *MTProto) clearPacketData(msgID int64) {
+	packet, ok := m.msgsByID.remove(msgID)
+	if !ok {
+		return
+	}
 	m.mutex.Lock()
-	packet, ok := m.msgsByID[msgID]
-	if ok {
-		if packet.resp != nil {
-			close(packet.resp)
-		}
-		delete(m.msgsByID, msgID)
+	if packet.resp != nil {
+		close(packet.resp)
+		packet.resp = nil
 	}
 	m.mutex.Unlock()
 }
 func (m *MTProto) respAndClearPacketData(msgID int64, response TL) {
+	packet, ok := m.msgsByID.remove(msgID)
+	if !ok {
+		return
+	}
 	m.mutex.Lock()
-	packet, ok := m.msgsByID[msgID]
-	if ok {
-		if packet.resp == nil {
-			m.log.Warn("second response to message #%d %#v", msgID, packet.msg)
-		} else {
-			packet.resp <- response
-			close(packet.resp)
-			packet.resp = nil
+	if packet.resp != nil {
+		packet.resp <- response
+		close(packet.resp)
+		packet.resp = nil
+	} else if !packet.cancelled {
+		m.log.Warn("second response to message #%d %#v", msgID, packet.msg)
+	}
+	m.mutex.Unlock()
+}
+
+// respAndClearMatchingPacket is like respAndClearPacketData but finds the request by its content,
+// for responses that are received as separate messages (without request msg_id).
+func (m *MTProto) respAndClearMatchingPacket(matches func(msg TL) bool, response TL) {
+	var msgID int64
+	m.msgsByID.each(func(id int64, packet *packetToSend) bool {
+		if msgID == 0 && matches(packet.msg) {
+			msgID = id
+		}
+		return false
+	})
+	if msgID != 0 {
+		m.respAndClearPacketData(msgID, response)
+	}
+}
+
+func (m *MTProto) onAuthKeyUnregistered(reqMsgID int64) {
+	var reqMsg TL
+	if packet, ok := m.msgsByID.get(reqMsgID); ok {
+		reqMsg = packet.msg
+	}
+	m.mutex.Lock()
+	shouldRun := m.handleAuthKeyUnregistered != nil && !m.reauthInProgress
+	if shouldRun {
+		m.reauthInProgress = true
+	}
+	m.mutex.Unlock()
+
+	m.log.Warn("auth key is unregistered (request: %T)", reqMsg)
+	if !shouldRun {
+		return
+	}
+	go func() {
+		if err := m.handleAuthKeyUnregistered(); err != nil {
+			m.log.Error(err, "auth key unregistered handler failed")
 		}
-		delete(m.msgsByID, msgID)
+		m.mutex.Lock()
+		m.reauthInProgress = false
+		m.mutex.Unlock()
+	}()
+}
+
+func (m *MTProto) onFatalAuthError(err error) {
+	m.mutex.Lock()
+	isFirst := m.fatalAuthErr == nil
+	if isFirst {
+		m.fatalAuthErr = err
 	}
 	m.mutex.Unlock()
+
+	if !isFirst {
+		return
+	}
+	m.log.Error(err, "fatal auth error")
+	if m.handleFatalAuthError != nil {
+		go m.handleFatalAuthError(err)
+	}
+}
+
+// regenerateAuthKeyLogged drops current (duplicated) auth key and reconnects with a new one.
+// Server will not send updates to a duplicated key, so it must not be used anymore.
+// https://core.telegram.org/api/errors#406-not-acceptable
+func (m *MTProto) regenerateAuthKeyLogged() {
+	if !m.reconnSemaphore.TryAcquire(1) {
+		m.log.Info("reconnection already in progress, not regenerating auth key")
+		return
+	}
+	defer m.reconnSemaphore.Release(1)
+
+	m.log.Warn("auth key is duplicated, generating new one")
+	for {
+		m.session.AuthKey = nil
+		m.session.AuthKeyHash = nil
+		m.session.ServerSalt = 0
+		m.encryptionReady = false
+		err := m.reconnect(0, false)
+		if err == nil {
+			break
+		}
+		m.log.Error(err, "failed to reconnect with new auth key")
+		m.log.Info("retrying in 5 seconds")
+		time.Sleep(5 * time.Second)
+	}
+
+	if m.handleAuthKeyDuplicated != nil {
+		m.handleAuthKeyDuplicated()
+	}
 }
 
 func (m *MTProto) process(msgId int64, seqNo int32, dataTL TL, mayPassToHandler bool) {
 	switch data := dataTL.(type) {
 	case TL_msgContainer:
 		for _, v := range data.Items {
-			m.process(v.MsgID, v.SeqNo, v.Data, true)
+			m.processIncoming(v.MsgID, v.SeqNo, v.Data, true)
 		}
 
 	case TL_badServerSalt:
-		m.session.ServerSalt = data.NewServerSalt
-		m.SaveSessionLogged()
-		m.resendPendingPackets()
+		m.handleBadServerSalt(data)
 
 	case TL_badMsgNotification:
-		m.respAndClearPacketData(data.BadMsgID, data)
+		m.handleBadMsgNotification(msgId, data)
 
 	case TL_msgsStateInfo:
 		m.respAndClearPacketData(data.ReqMsgID, data)
 
+	case TL_msgsAllInfo:
+		m.handleMsgsAllInfo(data)
+
+	case TL_futureSalts:
+		m.respAndClearPacketData(data.ReqMsgID, data)
+
+	case TL_destroySessionOK:
+		m.handleDestroySessionResult(data.SessionID, data)
+
+	case TL_destroySessionNone:
+		m.handleDestroySessionResult(data.SessionID, data)
+
+	case TL_destroyAuthKeyOK, TL_destroyAuthKeyNone, TL_destroyAuthKeyFail:
+		m.respAndClearMatchingPacket(isDestroyAuthKeyReq, data)
+
 	case TL_newSessionCreated:
 		m.session.ServerSalt = data.ServerSalt
 		m.SaveSessionLogged()
 
 	case TL_ping:
-		m.sendQueue <- newPacket(TL_pong{msgId, data.PingID}, nil)
+		m.enqueue(newPacket(TL_pong{msgId, data.PingID}, nil))
 
 	case TL_pong:
-		// (ignore) TODO
+		atomic.StoreInt64(&m.lastPongID, data.PingID)
 
 	case TL_msgsACK:
-		m.mutex.Lock()
 		for _, id := range data.MsgIDs {
-			packet, ok := m.msgsByID[id]
-			if ok {
+			m.msgsByID.update(id, func(packet *packetToSend) bool {
 				packet.needAck = false
 				// if request is not waiting for response, removing it
-				if m.msgsByID[id].resp == nil { //TODO: packet.resp
-					delete(m.msgsByID, id)
-				}
-			}
+				return packet.resp == nil
+			})
 		}
-		m.mutex.Unlock()
 
 	case TL_rpcResult:
+		if IsAuthKeyUnregistered(data.obj) {
+			m.onAuthKeyUnregistered(data.reqMsgID)
+		}
+		if IsAuthKeyDuplicated(data.obj) {
+			go m.regenerateAuthKeyLogged()
+		}
+		if err := FatalAuthError(data.obj); err != nil {
+			m.onFatalAuthError(err)
+		}
 		m.process(msgId, 0, data.obj, false)
+		if m.scheduleFloodWaitResend(data.reqMsgID, data.obj) || m.handleMigrateError(data.reqMsgID, data.obj) {
+			break
+		}
 		m.respAndClearPacketData(data.reqMsgID, data.obj)
 
 	default:
-		if mayPassToHandler && m.handleEvent != nil {
-			go m.handleEvent(dataTL)
+		if mayPassToHandler && m.eventsHandler() != nil {
+			m.pushEvent(dataTL)
 		}
 	}
 
 	// should acknowledge odd ids
 	if (seqNo & 1) == 1 {
-		m.sendQueue <- newPacket(TL_msgsACK{[]int64{msgId}}, nil)
+		m.scheduleAck(msgId)
 	}
 }
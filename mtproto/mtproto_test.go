@@ -0,0 +1,180 @@
+package mtproto
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventsWorkers(t *testing.T) {
+	m := &MTProto{mutex: &sync.Mutex{}, events: make(chan TL, 8), log: Logger{Hnd: NoopLogHandler{}}}
+	m.SetEventsWorkers(3)
+
+	started := make(chan TL, 8)
+	release := make(chan struct{})
+	m.SetEventsHandler(func(event TL) {
+		started <- event
+		<-release
+	})
+	for i := 0; i < 4; i++ {
+		m.pushEvent(TL_updateConfig{})
+	}
+
+	// three slow events are handled concurrently, the fourth one waits for a free worker
+	for i := 0; i < 3; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d event(s) are being handled", i)
+		}
+	}
+	select {
+	case <-started:
+		t.Fatalf("more events are handled than workers available")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("last event was not handled")
+	}
+}
+
+func TestEventsWorkersStop(t *testing.T) {
+	m := &MTProto{mutex: &sync.Mutex{}, events: make(chan TL, 8), eventsWorkers: 2, log: Logger{Hnd: NoopLogHandler{}}}
+	handled := make(chan TL, 8)
+	m.SetEventsHandler(func(event TL) { handled <- event })
+
+	m.stopEventsWorkers() // like on Disconnect
+	time.Sleep(20 * time.Millisecond)
+	m.pushEvent(TL_updateConfig{})
+	select {
+	case <-handled:
+		t.Fatal("event should not be handled by stopped workers")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	m.startEventsWorkers() // like on next connection
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("queued event was not handled after workers restart")
+	}
+
+	m.SetEventsHandler(nil)
+	m.pushEvent(TL_updateConfig{})
+	time.Sleep(20 * time.Millisecond) // should be skipped without panic
+	m.stopEventsWorkers()
+}
+
+func TestSendOrderWithMiddlewares(t *testing.T) {
+	m := &MTProto{mutex: &sync.Mutex{}, msgsByID: newPendingPackets(), extSendQueue: make(chan *packetToSend, 8)}
+	m.Use(func(next Invoker) Invoker {
+		return func(ctx context.Context, msg TLReq) TL {
+			switch x := msg.(type) {
+			case TL_help_getNearestDC:
+				return TL_nearestDC{} // like a cached response
+			case TL_ping:
+				// earlier requests spend more time in middleware
+				time.Sleep(time.Duration(5-x.PingID) * 5 * time.Millisecond)
+			}
+			return next(ctx, msg)
+		}
+	})
+
+	var resps []chan TL
+	for i := int32(0); i < 5; i++ {
+		resps = append(resps, m.Send(TL_ping{PingID: int64(i)}))
+		if i == 2 {
+			resps = append(resps, m.Send(TL_help_getNearestDC{}))
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		packet := <-m.extSendQueue
+		ping, ok := packet.msg.(TL_ping)
+		if !ok {
+			t.Fatalf("request answered by middleware should not be sent, got %#v", packet.msg)
+		}
+		if ping.PingID != int64(i) {
+			t.Fatalf("wrong requests order: got #%d at position %d", ping.PingID, i)
+		}
+		packet.resp <- TL_pong{PingID: int64(i)}
+	}
+	for i, resp := range resps {
+		res := <-resp
+		if i == 3 {
+			if res != (TL_nearestDC{}) {
+				t.Errorf("expected response from middleware, got %#v", res)
+			}
+			continue
+		}
+		pingID := int64(i)
+		if i > 3 {
+			pingID--
+		}
+		if pong := res.(TL_pong); pong.PingID != pingID {
+			t.Errorf("wrong response #%d: %#v", i, pong)
+		}
+	}
+	if len(m.extSendQueue) != 0 {
+		t.Errorf("expected no more requests in queue, got %d", len(m.extSendQueue))
+	}
+}
+
+func TestSendSyncRetryCtxCancel(t *testing.T) {
+	m := &MTProto{mutex: &sync.Mutex{}, msgsByID: newPendingPackets(), extSendQueue: make(chan *packetToSend, 8), log: Logger{Hnd: NoopLogHandler{}}}
+	calls := 0
+	m.Use(func(next Invoker) Invoker {
+		return func(ctx context.Context, msg TLReq) TL {
+			calls++
+			return TL_rpcError{ErrorCode: 500, ErrorMessage: "RPC_CALL_FAIL"}
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	res, err := m.SendSyncRetryCtx(ctx, TL_ping{}, time.Hour, 0, time.Hour)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %#v %v", res, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("retry wait was not interrupted by context")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestPushEventOverflow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &MTProto{events: make(chan TL, 1), routinesCtx: ctx, log: Logger{Hnd: NoopLogHandler{}}}
+	m.pushEvent(TL_updateConfig{})
+	pushed := make(chan struct{})
+	go func() {
+		m.pushEvent(TL_updatesTooLong{})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("event should wait for free queue slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	<-m.events
+	<-pushed
+	if _, ok := (<-m.events).(TL_updatesTooLong); !ok {
+		t.Errorf("waiting event was not delivered")
+	}
+
+	m.dropEvents = true
+	m.pushEvent(TL_updateConfig{})
+	m.pushEvent(TL_updatesTooLong{}) // dropped without waiting
+	if len(m.events) != 1 {
+		t.Errorf("expected single event in queue, got %d", len(m.events))
+	}
+}
@@ -2,9 +2,11 @@ package mtproto
 
 import (
 	"bytes"
+	"compress/gzip"
 	"crypto/rand"
 	"encoding/binary"
-	"fmt"
+	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/ansel1/merry/v2"
@@ -14,128 +16,351 @@ func (m *MTProto) justSend(msg TLReq) error {
 	return merry.Wrap(m.send(newPacket(msg, nil)))
 }
 
-func (m *MTProto) send(packet *packetToSend) error {
-	if packet.msgID == 0 {
-		packet.msgID = m.generateMessageId()
-	}
-	m.log.Message(false, packet.msg, packet.msgID)
-	obj := packet.msg.encode()
+const (
+	containerMaxMessages = 1020
+	containerMaxSize     = 512 * 1024
+	// requests larger than this are sent as gzip_packed (if it makes them smaller)
+	gzipMinSize = 1024
+	// encrypted messages get up to this number of additional random 16-byte padding blocks
+	maxExtraPaddingBlocks = 16
+	// read and decrypt buffers are reused while they are not larger than this
+	maxReadBufSize = 128 * 1024
+	// batched transport packets are written to connection at once until they reach this size
+	maxCoalescedWriteSize = 1024 * 1024
+)
 
-	x := NewEncodeBuf(256)
+func (m *MTProto) send(packet *packetToSend) error {
+	return merry.Wrap(m.sendTo(m.conn, packet))
+}
 
-	// padding for tcpsize
-	x.Int(0)
+func (m *MTProto) sendTo(w io.Writer, packet *packetToSend) error {
+	if !m.preparePacket(packet) {
+		return nil
+	}
+	obj := m.encodePacket(packet)
+	if m.rejectTooLarge(packet, obj) {
+		return nil
+	}
+	return merry.Wrap(m.sendPrepared(w, packet, obj))
+}
 
+func (m *MTProto) sendPrepared(w io.Writer, packet *packetToSend, obj []byte) error {
+	var buf []byte
 	if m.encryptionReady {
-		packet.needAck = true
-		switch packet.msg.(type) {
-		case TL_ping, TL_msgsACK:
-			packet.needAck = false
-		}
-		z := NewEncodeBuf(256)
-		z.Long(m.session.ServerSalt)
-		z.Long(m.session.sessionId)
-		z.Long(packet.msgID)
-		if packet.seqNo == 0 {
-			if packet.needAck {
-				packet.seqNo = m.lastOutSeqNo | 1
-			} else {
-				packet.seqNo = m.lastOutSeqNo
-			}
-			m.lastOutSeqNo += 2
-		}
-		z.Int(packet.seqNo)
-		z.Int(int32(len(obj)))
-		z.Bytes(obj)
-
-		msgKey := sha1(z.buf)[4:20]
-		aesKey, aesIV := generateAES(msgKey, m.session.AuthKey, false)
-
-		y := make([]byte, len(z.buf)+((16-(len(obj)%16))&15))
-		copy(y, z.buf)
-		encryptedData, err := doAES256IGEencrypt(y, aesKey, aesIV)
+		m.assignSeqNo(packet)
+		var err error
+		buf, err = m.encrypt(packet.msgID, packet.seqNo, obj)
 		if err != nil {
 			return merry.Wrap(err)
 		}
-
-		x.Bytes(m.session.AuthKeyHash)
-		x.Bytes(msgKey)
-		x.Bytes(encryptedData)
-
-		if packet.resp != nil || packet.needAck {
-			m.mutex.Lock()
-			m.msgsByID[packet.msgID] = packet
-			m.mutex.Unlock()
-		}
+		m.registerPacket(packet)
 	} else {
+		x := newPooledEncodeBuf(20 + len(obj))
 		x.Long(0)
 		x.Long(packet.msgID)
 		x.Int(int32(len(obj)))
 		x.Bytes(obj)
+		buf = x.buf
 	}
+	defer putBuf(buf)
+
+	if err := m.transport.WritePacket(w, buf); err != nil {
+		return merry.Wrap(err)
+	}
+	return nil
+}
 
-	// minus padding
-	size := len(x.buf)/4 - 1
+// writeCoalescer collects transport packets and writes them to connection at once,
+// so a batch of packets usually takes a single syscall.
+type writeCoalescer struct {
+	conn io.Writer
+	buf  *bytes.Buffer
+}
 
-	if size < 127 {
-		x.buf[3] = byte(size)
-		x.buf = x.buf[3:]
-	} else {
-		binary.LittleEndian.PutUint32(x.buf, uint32(size<<8|127))
+func newWriteCoalescer(conn io.Writer) *writeCoalescer {
+	return &writeCoalescer{conn: conn, buf: bytes.NewBuffer(getBuf(0))}
+}
+
+func (w *writeCoalescer) Write(p []byte) (int, error) {
+	n, _ := w.buf.Write(p)
+	if w.buf.Len() >= maxCoalescedWriteSize {
+		return n, w.flush()
 	}
-	if _, err := m.conn.Write(x.buf); err != nil {
+	return n, nil
+}
+
+func (w *writeCoalescer) flush() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.conn.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return merry.Wrap(err)
+}
+
+func (w *writeCoalescer) release() {
+	putBuf(w.buf.Bytes())
+	w.buf = nil
+}
+
+// sendBatch sends multiple packets in msg_container(s) respecting container size limits.
+// All resulting transport packets are written to connection at once (see writeCoalescer).
+// https://core.telegram.org/mtproto/service_messages#containers
+func (m *MTProto) sendBatch(packets []*packetToSend) error {
+	if len(packets) == 1 {
+		return merry.Wrap(m.send(packets[0]))
+	}
+	w := newWriteCoalescer(m.conn)
+	defer w.release()
+	if err := m.sendBatchTo(w, packets); err != nil {
 		return merry.Wrap(err)
 	}
+	return merry.Wrap(w.flush())
+}
 
-	packet.sentAt = time.Now()
+func (m *MTProto) sendBatchTo(w io.Writer, packets []*packetToSend) error {
+	if !m.encryptionReady {
+		for _, packet := range packets {
+			if err := m.sendTo(w, packet); err != nil {
+				return merry.Wrap(err)
+			}
+		}
+		return nil
+	}
+
+	var group []*packetToSend
+	var groupObjs [][]byte
+	groupSize := 0
+	for _, packet := range packets {
+		if !m.preparePacket(packet) {
+			continue
+		}
+		obj := m.encodePacket(packet)
+		if m.rejectTooLarge(packet, obj) {
+			continue
+		}
+		// messages larger than container limit end up alone in their groups (sent without container)
+		if len(group) > 0 && groupSize+16+len(obj) > containerMaxSize {
+			if err := m.sendContainer(w, group, groupObjs); err != nil {
+				return merry.Wrap(err)
+			}
+			group, groupObjs, groupSize = nil, nil, 0
+		}
+		group = append(group, packet)
+		groupObjs = append(groupObjs, obj)
+		groupSize += 16 + len(obj)
+	}
+	if len(group) > 0 {
+		return merry.Wrap(m.sendContainer(w, group, groupObjs))
+	}
 	return nil
 }
 
+func (m *MTProto) sendContainer(w io.Writer, packets []*packetToSend, objs [][]byte) error {
+	if len(packets) == 1 {
+		return merry.Wrap(m.sendPrepared(w, packets[0], objs[0]))
+	}
+
+	size := 8
+	for _, obj := range objs {
+		size += 16 + len(obj)
+	}
+	x := newPooledEncodeBuf(size)
+	defer x.release()
+	x.UInt(CRC_msg_container)
+	x.Int(int32(len(packets)))
+	ids := make([]int64, len(packets))
+	for i, packet := range packets {
+		m.assignSeqNo(packet)
+		x.Long(packet.msgID)
+		x.Int(packet.seqNo)
+		x.Int(int32(len(objs[i])))
+		x.Bytes(objs[i])
+		ids[i] = packet.msgID
+	}
+
+	m.mutex.Lock()
+	containerID := m.generateMessageId()
+	m.containerMsgs[containerID] = ids
+	containerSeqNo := m.lastOutSeqNo // container is not content-related, seqno is not incremented
+	m.mutex.Unlock()
+	m.log.Debug("sending container #%d with %d message(s)", containerID, len(packets))
+
+	buf, err := m.encrypt(containerID, containerSeqNo, x.buf)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer putBuf(buf)
+	for _, packet := range packets {
+		m.registerPacket(packet)
+	}
+
+	if err := m.transport.WritePacket(w, buf); err != nil {
+		return merry.Wrap(err)
+	}
+	return nil
+}
+
+func (m *MTProto) encodePacket(packet *packetToSend) []byte {
+	obj := packet.msg.encode()
+	if !m.encryptionReady || len(obj) < gzipMinSize {
+		return obj
+	}
+	switch packet.msg.(type) {
+	case TL_upload_saveFilePart, TL_upload_saveBigFilePart:
+		return obj // file data is usually already compressed
+	}
+	return gzipPackIfSmaller(obj)
+}
+
+// gzipPackIfSmaller wraps obj in gzip_packed if the result is smaller.
+// https://core.telegram.org/mtproto/serialize#gzip-packed
+func gzipPackIfSmaller(obj []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(obj); err != nil {
+		return obj
+	}
+	if err := gz.Close(); err != nil {
+		return obj
+	}
+	if buf.Len()+8 >= len(obj) {
+		return obj
+	}
+	x := NewEncodeBuf(buf.Len() + 8)
+	x.UInt(CRC_gzip_packed)
+	x.StringBytes(buf.Bytes())
+	return x.buf
+}
+
+// preparePacket assigns message ID (if not assigned yet).
+// Returns false if packet was cancelled and should not be sent.
+func (m *MTProto) preparePacket(packet *packetToSend) bool {
+	m.mutex.Lock()
+	cancelled := packet.cancelled
+	if packet.msgID == 0 && !cancelled {
+		packet.msgID = m.generateMessageId()
+	}
+	m.mutex.Unlock()
+	if cancelled {
+		m.log.Debug("not sending cancelled %T", packet.msg)
+		return false
+	}
+	m.log.Message(false, packet.msg, packet.msgID)
+	return true
+}
+
+// isContentRelated checks if message requires acknowledgment (and so increments seq_no).
+// https://core.telegram.org/mtproto/description#message-sequence-number-msg-seqno
+func isContentRelated(msg TL) bool {
+	switch msg.(type) {
+	case TL_msgsACK, TL_msgContainer, TL_httpWait, TL_msgsStateInfo, TL_msgsAllInfo:
+		return false
+	}
+	return true
+}
+
+// assignSeqNo sets seq_no: twice the number of content-related messages sent before,
+// plus one if the message itself is content-related.
+func (m *MTProto) assignSeqNo(packet *packetToSend) {
+	isContent := isContentRelated(packet.msg)
+	packet.needAck = isContent
+	switch packet.msg.(type) {
+	case TL_ping, TL_pingDelayDisconnect:
+		// pong is the acknowledgment
+		packet.needAck = false
+	}
+	if packet.seqNo == 0 {
+		m.mutex.Lock()
+		if isContent {
+			packet.seqNo = m.lastOutSeqNo | 1
+			m.lastOutSeqNo += 2
+		} else {
+			packet.seqNo = m.lastOutSeqNo
+		}
+		m.mutex.Unlock()
+	}
+}
+
+// registerPacket adds packet to msgsByID if it is waiting for response or ack.
+func (m *MTProto) registerPacket(packet *packetToSend) {
+	if packet.resp != nil || packet.needAck {
+		m.mutex.Lock()
+		if !packet.cancelled {
+			packet.sentAt = time.Now()
+			m.msgsByID.add(packet)
+			m.schedulePendingChecks(packet)
+		}
+		m.mutex.Unlock()
+	}
+}
+
+// encrypt returns encrypted message in a pooled buffer, it should be released with putBuf after sending.
+func (m *MTProto) encrypt(msgID int64, seqNo int32, obj []byte) ([]byte, error) {
+	// with space for max padding, so appending it will not reallocate the buffer
+	z := newPooledEncodeBuf(32 + len(obj) + 12 + maxExtraPaddingBlocks*16)
+	defer z.release()
+	z.Long(m.session.ServerSalt)
+	z.Long(m.session.sessionId)
+	z.Long(msgID)
+	z.Int(seqNo)
+	z.Int(int32(len(obj)))
+	z.Bytes(obj)
+
+	// random padding of 12..1024 bytes, total length must be divisible by 16
+	var extraBlocks [1]byte
+	if _, err := rand.Read(extraBlocks[:]); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	paddingLen := 12 + int(extraBlocks[0]%maxExtraPaddingBlocks)*16
+	paddingLen += (16 - (len(z.buf)+paddingLen)%16) & 15
+	plaintext := z.buf[:len(z.buf)+paddingLen]
+	if _, err := rand.Read(plaintext[len(z.buf):]); err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	authKey, authKeyHash := m.activeAuthKey()
+	msgKey := generateMsgKey(authKey, plaintext, false)
+	aesKey, aesIV := generateAES(msgKey, authKey, false)
+	// encrypting right into the output buffer, after auth_key_id and msg_key
+	x := getBuf(24 + len(plaintext))
+	x = append(x, authKeyHash...)
+	x = append(x, msgKey...)
+	if _, err := doAES256IGEencryptTo(x[24:], plaintext, aesKey, aesIV); err != nil {
+		putBuf(x)
+		return nil, merry.Wrap(err)
+	}
+	return x[:24+len(plaintext)], nil
+}
+
 func (m *MTProto) read() (*packetReceived, error) {
-	var err error
-	var n int
-	var size int
 	var packet packetReceived
 
-	err = m.conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+	err := m.conn.SetReadDeadline(time.Now().Add(90 * time.Second))
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
-	b := make([]byte, 1)
-	_, err = m.conn.Read(b)
+	buf, err := m.readPacket()
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
 
-	if b[0] < 127 {
-		size = int(b[0]) << 2
-	} else {
-		b := make([]byte, 3)
-		_, err = m.conn.Read(b)
-		if err != nil {
-			return nil, merry.Wrap(err)
+	if len(buf) == 4 {
+		code := int32(binary.LittleEndian.Uint32(buf))
+		if code == -404 && m.dropTempAuthKey() {
+			// server may forget temporary key before its expiration
+			m.log.Warn("temporary auth key is not found on server, new one will be created")
 		}
-		size = (int(b[0]) | int(b[1])<<8 | int(b[2])<<16) << 2
+		return nil, merry.Errorf("handshake: server response error: %d", code)
 	}
 
-	left := size
-	buf := make([]byte, size)
-	for left > 0 {
-		n, err = m.conn.Read(buf[size-left:])
-		if err != nil {
-			return nil, merry.Wrap(err)
-		}
-		left -= n
+	if len(buf) < 8 {
+		return nil, merry.Errorf("packet is too short: %d bytes", len(buf))
 	}
 
-	if size == 4 {
-		return nil, merry.Errorf("handshake: server response error: %d", int32(binary.LittleEndian.Uint32(buf)))
-	}
-
-	dbuf := NewDecodeBuf(buf)
-
-	authKeyHash := dbuf.Bytes(8)
-	if binary.LittleEndian.Uint64(authKeyHash) == 0 {
+	if binary.LittleEndian.Uint64(buf) == 0 {
+		dbuf := NewDecodeBuf(buf)
+		_ = dbuf.Long() // auth_key_id
 		packet.msgID = dbuf.Long()
 		packet.seqNo = 0
 		messageLen := dbuf.Int()
@@ -148,14 +373,20 @@ func (m *MTProto) read() (*packetReceived, error) {
 			return nil, merry.Wrap(dbuf.err)
 		}
 	} else {
-		msgKey := dbuf.Bytes(16)
-		encryptedData := dbuf.Bytes(dbuf.size - 24)
-		aesKey, aesIV := generateAES(msgKey, m.session.AuthKey, true)
-		x, err := doAES256IGEdecrypt(encryptedData, aesKey, aesIV)
+		if len(buf) < 24 {
+			return nil, merry.Errorf("encrypted packet is too short: %d bytes", len(buf))
+		}
+		// buf is not reused until the next read, so parts of it are used without copying
+		msgKey := buf[8:24]
+		encryptedData := buf[24:]
+		authKey, _ := m.activeAuthKey()
+		aesKey, aesIV := generateAES(msgKey, authKey, true)
+		x, err := doAES256IGEdecryptTo(m.decryptBuf, encryptedData, aesKey, aesIV)
 		if err != nil {
 			return nil, merry.Wrap(err)
 		}
-		dbuf = NewDecodeBuf(x)
+		m.decryptBuf = keepReadBuf(x)
+		dbuf := NewDecodeBuf(x)
 		_ = dbuf.Long() // salt
 		_ = dbuf.Long() // session_id
 		packet.msgID = dbuf.Long()
@@ -167,24 +398,12 @@ func (m *MTProto) read() (*packetReceived, error) {
 		if int(messageLen) < 0 {
 			return nil, merry.Errorf("handshake: wrong message len: %d (0x%08X)", messageLen, uint32(messageLen))
 		}
-		// DEBUG vvv
-		if dbuf.err != nil {
-			panic(dbuf.err)
-		}
-		if int(messageLen)+32 > len(dbuf.buf) {
-			panic(fmt.Sprintf("AHTUNG!!! %d(%d) + 32 > %d", messageLen, int(messageLen), len(dbuf.buf)))
-		}
-		hash := sha1(dbuf.buf[0 : 32+messageLen])
-		if len(hash) < 20 {
-			panic(fmt.Sprintf("AHTUNG!!! %d < 20", len(hash)))
-		}
-		if !bytes.Equal(hash[4:20], msgKey) {
+		if !bytes.Equal(generateMsgKey(authKey, x, true), msgKey) {
 			return nil, merry.New("Wrong msg_key")
 		}
-		// if !bytes.Equal(sha1(dbuf.buf[0 : 32+messageLen])[4:20], msgKey) {
-		// 	return nil, merry.New("Wrong msg_key")
-		// }
-		// DEBUG ^^^
+		if paddingLen := dbuf.size - 32 - int(messageLen); paddingLen < 12 || paddingLen > 1024 {
+			return nil, merry.Errorf("wrong padding length: %d", paddingLen)
+		}
 
 		packet.msg = m.decodeMessage(dbuf, nil)
 		if dbuf.err != nil {
@@ -203,7 +422,48 @@ func (m *MTProto) read() (*packetReceived, error) {
 	return &packet, nil
 }
 
+// readPacket reads next packet into m.readBuf (if transport supports it) or into a new buffer.
+// Decoded objects do not reference the buffer, so it may be reused for the next packet.
+func (m *MTProto) readPacket() ([]byte, error) {
+	if r, ok := m.transport.(packetBufReader); ok {
+		buf, err := r.ReadPacketTo(m.conn, m.readBuf)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		m.readBuf = keepReadBuf(buf)
+		return buf, nil
+	}
+	buf, err := m.transport.ReadPacket(m.conn)
+	return buf, merry.Wrap(err)
+}
+
+// keepReadBuf returns buffer that should be reused for reading next packet:
+// too large buffers (for example after file part download) are not kept.
+func keepReadBuf(buf []byte) []byte {
+	if cap(buf) > maxReadBufSize {
+		return nil
+	}
+	return buf[:0]
+}
+
 func (m *MTProto) makeAuthKey() error {
+	authKey, serverSalt, err := m.exchangeAuthKey(0)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	m.session.AuthKey = authKey
+	m.session.AuthKeyHash = sha1(authKey)[12:20]
+	m.session.ServerSalt = serverSalt
+	m.dropFutureSalts()
+	// temporary key is bound to the old permanent one
+	m.dropTempAuthKey()
+	return nil
+}
+
+// exchangeAuthKey creates new auth key via unencrypted DH exchange. If expiresIn > 0,
+// a temporary key is created (it is valid for expiresIn seconds), see temp_auth_key.go.
+// Returns the key and initial server salt.
+func (m *MTProto) exchangeAuthKey(expiresIn int32) ([]byte, int64, error) {
 	var x []byte
 	var err error
 	var packet *packetReceived
@@ -211,70 +471,69 @@ func (m *MTProto) makeAuthKey() error {
 	// (send) req_pq
 	nonceFirst, err := generateNonce16()
 	if err != nil {
-		return merry.Wrap(err)
+		return nil, 0, merry.Wrap(err)
 	}
 	err = m.justSend(TL_reqPQ{nonceFirst})
 	if err != nil {
-		return merry.Wrap(err)
+		return nil, 0, merry.Wrap(err)
 	}
 
 	// (parse) resPQ
 	packet, err = m.read()
 	if err != nil {
-		return merry.Wrap(err)
+		return nil, 0, merry.Wrap(err)
 	}
 	res, ok := packet.msg.(TL_resPQ)
 	if !ok {
-		return merry.New("handshake: " + UnexpectedTL("resPQ", packet.msg))
+		return nil, 0, merry.New("handshake: " + UnexpectedTL("resPQ", packet.msg))
 	}
 	if nonceFirst != res.Nonce {
-		return merry.New("handshake: wrong nonce")
+		return nil, 0, merry.New("handshake: wrong nonce")
 	}
-	found := false
-	for _, b := range res.ServerPublicKeyFingerprints {
-		if b == telegramPublicKey_FP {
-			found = true
-			break
-		}
-	}
-	if !found {
-		return merry.New("handshake: no fingerprint")
+	serverKey := findServerPublicKey(m.ServerPublicKeys(), res.ServerPublicKeyFingerprints)
+	if serverKey == nil {
+		return nil, 0, merry.Wrap(ErrNoServerPublicKey, merry.AppendMessagef("%v", res.ServerPublicKeyFingerprints))
 	}
 
 	// (encoding) p_q_inner_data
 	p, q := splitPQ(str2big(res.PQ))
 	nonceSecond, err := generateNonce32()
 	if err != nil {
-		return merry.Wrap(err)
+		return nil, 0, merry.Wrap(err)
 	}
 	nonceServer := res.ServerNonce
-	innerData1 := (TL_pqInnerData{res.PQ, big2str(p), big2str(q), nonceFirst, nonceServer, nonceSecond}).encode()
+	var innerData1 []byte
+	if expiresIn > 0 {
+		innerData1 = (TL_pqInnerDataTempDC{res.PQ, big2str(p), big2str(q), nonceFirst, nonceServer, nonceSecond, m.session.DCID, expiresIn}).encode()
+	} else {
+		innerData1 = (TL_pqInnerData{res.PQ, big2str(p), big2str(q), nonceFirst, nonceServer, nonceSecond}).encode()
+	}
 
 	x = make([]byte, 255)
 	copy(x[0:], sha1(innerData1))
 	copy(x[20:], innerData1)
-	encryptedData1 := doRSAencrypt(x)
+	encryptedData1 := doRSAencrypt(x, serverKey.Key)
 
 	// (send) req_DH_params
-	err = m.justSend(TL_reqDHParams{nonceFirst, nonceServer, big2str(p), big2str(q), telegramPublicKey_FP, string(encryptedData1)})
+	err = m.justSend(TL_reqDHParams{nonceFirst, nonceServer, big2str(p), big2str(q), serverKey.Fingerprint, string(encryptedData1)})
 	if err != nil {
-		return merry.Wrap(err)
+		return nil, 0, merry.Wrap(err)
 	}
 
 	// (parse) server_DH_params_{ok, fail}
 	packet, err = m.read()
 	if err != nil {
-		return merry.Wrap(err)
+		return nil, 0, merry.Wrap(err)
 	}
 	dh, ok := packet.msg.(TL_serverDHParamsOK)
 	if !ok {
-		return merry.New("handshake: " + UnexpectedTL("server_DH_params_ok", packet.msg))
+		return nil, 0, merry.New("handshake: " + UnexpectedTL("server_DH_params_ok", packet.msg))
 	}
 	if nonceFirst != dh.Nonce {
-		return merry.New("handshake: wrong nonce")
+		return nil, 0, merry.New("handshake: wrong nonce")
 	}
 	if nonceServer != dh.ServerNonce {
-		return merry.New("handshake: wrong server_nonce")
+		return nil, 0, merry.New("handshake: wrong server_nonce")
 	}
 	t1 := make([]byte, 48)
 	copy(t1[0:], nonceSecond[:])
@@ -304,39 +563,41 @@ func (m *MTProto) makeAuthKey() error {
 	// (parse-thru) server_DH_inner_data
 	decodedData, err := doAES256IGEdecrypt([]byte(dh.EncryptedAnswer), tmpAESKey, tmpAESIV)
 	if err != nil {
-		return merry.Wrap(err)
+		return nil, 0, merry.Wrap(err)
 	}
 	innerbuf := NewDecodeBuf(decodedData[20:])
 	dhi_TL := innerbuf.Object()
 	if innerbuf.err != nil {
-		return merry.Wrap(innerbuf.err)
+		return nil, 0, merry.Wrap(innerbuf.err)
 	}
 	dhi, ok := dhi_TL.(TL_serverDHInnerData)
 	if !ok {
-		return merry.New("handshake: " + UnexpectedTL("server_DH_inner_data", dhi_TL))
+		return nil, 0, merry.New("handshake: " + UnexpectedTL("server_DH_inner_data", dhi_TL))
 	}
 	if nonceFirst != dhi.Nonce {
-		return merry.New("handshake: wrong nonce")
+		return nil, 0, merry.New("handshake: wrong nonce")
 	}
 	if nonceServer != dhi.ServerNonce {
-		return merry.New("handshake: wrong server_nonce")
+		return nil, 0, merry.New("handshake: wrong server_nonce")
 	}
 
-	_, g_b, g_ab := makeGAB(dhi.G, str2big(dhi.GA), str2big(dhi.DHPrime))
-	m.session.AuthKey = g_ab.Bytes()
-	if m.session.AuthKey[0] == 0 { //TODO: what?
-		m.session.AuthKey = m.session.AuthKey[1:]
+	_, g_b, g_ab, err := makeGAB(dhi.G, str2big(dhi.GA), str2big(dhi.DHPrime))
+	if err != nil {
+		return nil, 0, merry.Wrap(err)
+	}
+	authKey := g_ab.Bytes()
+	if authKey[0] == 0 { //TODO: what?
+		authKey = authKey[1:]
 	}
-	m.session.AuthKeyHash = sha1(m.session.AuthKey)[12:20]
 	t4 := make([]byte, 32+1+8)
 	copy(t4[0:], nonceSecond[:])
 	t4[32] = 1
-	copy(t4[33:], sha1(m.session.AuthKey)[0:8])
+	copy(t4[33:], sha1(authKey)[0:8])
 	nonceHash1 := [16]byte(sha1(t4)[4:20])
 	saltBuf := make([]byte, 8)
 	copy(saltBuf, nonceSecond[:8])
 	xor(saltBuf, nonceServer[:8])
-	m.session.ServerSalt = int64(binary.LittleEndian.Uint64(saltBuf))
+	serverSalt := int64(binary.LittleEndian.Uint64(saltBuf))
 
 	// (encoding) client_DH_inner_data
 	innerData2 := (TL_clientDHInnerData{nonceFirst, nonceServer, 0, big2str(g_b)}).encode()
@@ -345,34 +606,34 @@ func (m *MTProto) makeAuthKey() error {
 	copy(x[20:], innerData2)
 	encryptedData2, err := doAES256IGEencrypt(x, tmpAESKey, tmpAESIV)
 	if err != nil {
-		return merry.Wrap(err)
+		return nil, 0, merry.Wrap(err)
 	}
 
 	// (send) set_client_DH_params
 	err = m.justSend(TL_setClientDHParams{nonceFirst, nonceServer, string(encryptedData2)})
 	if err != nil {
-		return merry.Wrap(err)
+		return nil, 0, merry.Wrap(err)
 	}
 
 	// (parse) dh_gen_{ok, retry, fail}
 	packet, err = m.read()
 	if err != nil {
-		return merry.Wrap(err)
+		return nil, 0, merry.Wrap(err)
 	}
 	dhg, ok := packet.msg.(TL_dhGenOK)
 	if !ok {
-		return merry.New("handshake: " + UnexpectedTL("dh_gen_ok", packet.msg))
+		return nil, 0, merry.New("handshake: " + UnexpectedTL("dh_gen_ok", packet.msg))
 	}
 	if nonceFirst != dhg.Nonce {
-		return merry.New("handshake: wrong nonce")
+		return nil, 0, merry.New("handshake: wrong nonce")
 	}
 	if nonceServer != dhg.ServerNonce {
-		return merry.New("handshake: wrong server_nonce")
+		return nil, 0, merry.New("handshake: wrong server_nonce")
 	}
 	if nonceHash1 != dhg.NewNonceHash1 {
-		return merry.New("handshake: wrong new_nonce_hash1")
+		return nil, 0, merry.New("handshake: wrong new_nonce_hash1")
 	}
-	return nil
+	return authKey, serverSalt, nil
 }
 
 // https://core.telegram.org/mtproto/description#message-identifier-msg-id
@@ -382,7 +643,7 @@ func (m *MTProto) generateMessageId() int64 {
 	// "must approximately equal unixtime*2^32"
 	// "the lower 32 bits ... must present a fractional part of the time point when the message was created"
 	// "Client message identifiers are divisible by 4"
-	id := ((unixnano/nano + m.outMsgIDTimeOffsetSec) << 32) | ((unixnano % nano) & -4)
+	id := ((unixnano/nano + atomic.LoadInt64(&m.outMsgIDTimeOffsetSec)) << 32) | ((unixnano % nano) & -4)
 
 	// "must increase monotonically"
 	// (Windows has a low time resolution, multiple UnixNano() may produce same result)
@@ -0,0 +1,220 @@
+package mtproto
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGzipPackIfSmaller(t *testing.T) {
+	obj := TL_dataJSON{Data: strings.Repeat(`{"key":"value"}`, 200)}
+	packed := gzipPackIfSmaller(obj.encode())
+	if len(packed) >= len(obj.encode()) {
+		t.Fatalf("packed data is not smaller: %d >= %d", len(packed), len(obj.encode()))
+	}
+
+	m := &MTProto{mutex: &sync.Mutex{}, msgsByID: newPendingPackets()}
+	dbuf := NewDecodeBuf(packed)
+	res := m.decodeMessage(dbuf, nil)
+	if dbuf.err != nil {
+		t.Fatal(dbuf.err)
+	}
+	if !reflect.DeepEqual(res, obj) {
+		t.Errorf("unpacked object mismatch: %#v", res)
+	}
+
+	small := TL_dataJSON{Data: "abc"}.encode()
+	if res := gzipPackIfSmaller(small); !reflect.DeepEqual(res, small) {
+		t.Errorf("small object should not be packed")
+	}
+}
+
+func TestAssignSeqNo(t *testing.T) {
+	m := &MTProto{mutex: &sync.Mutex{}}
+	var seqNos []int32
+	for _, msg := range []TL{TL_help_getConfig{}, TL_msgsACK{}, TL_ping{}, TL_msgsACK{}, TL_help_getConfig{}} {
+		packet := newPacket(msg, nil)
+		m.assignSeqNo(packet)
+		seqNos = append(seqNos, packet.seqNo)
+	}
+	// content-related messages get odd numbers and increment the counter, acks do not
+	if expected := []int32{1, 2, 3, 4, 5}; !reflect.DeepEqual(seqNos, expected) {
+		t.Errorf("wrong seq_no sequence: %v, expected %v", seqNos, expected)
+	}
+}
+
+func TestEncryptV2(t *testing.T) {
+	authKey := make([]byte, 256)
+	for i := range authKey {
+		authKey[i] = byte(i)
+	}
+	m := &MTProto{mutex: &sync.Mutex{}, session: &SessionInfo{AuthKey: authKey, AuthKeyHash: sha1(authKey)[12:20]}}
+	obj := []byte("some message body")
+	for i := 0; i < 32; i++ {
+		buf, err := m.encrypt(1, 1, obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgKey := buf[8:24]
+		aesKey, aesIV := generateAES(msgKey, authKey, false)
+		plaintext, err := doAES256IGEdecrypt(buf[24:], aesKey, aesIV)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(generateMsgKey(authKey, plaintext, false), msgKey) {
+			t.Fatalf("wrong msg_key")
+		}
+		if !bytes.Equal(plaintext[32:32+len(obj)], obj) {
+			t.Fatalf("wrong body: %q", plaintext[32:32+len(obj)])
+		}
+		if padding := len(plaintext) - 32 - len(obj); padding < 12 || padding > 1024 {
+			t.Fatalf("wrong padding length: %d", padding)
+		}
+		putBuf(buf)
+	}
+}
+
+func TestRejectTooLarge(t *testing.T) {
+	m := &MTProto{mutex: &sync.Mutex{}, log: Logger{Hnd: NoopLogHandler{}}}
+	resp := make(chan TL, 1)
+	packet := &packetToSend{msg: TL_help_getConfig{}, resp: resp}
+	if m.rejectTooLarge(packet, make([]byte, maxMessageSize)) {
+		t.Fatalf("message of max size should not be rejected")
+	}
+	if !m.rejectTooLarge(packet, make([]byte, maxMessageSize+1)) {
+		t.Fatalf("large message was not rejected")
+	}
+	if res := <-resp; !IsMessageTooLarge(res) {
+		t.Errorf("expected too large error, got %#v", res)
+	}
+}
+
+// writesCountConn counts Write calls
+type writesCountConn struct {
+	net.Conn
+	writes int
+	data   bytes.Buffer
+}
+
+func (c *writesCountConn) Write(b []byte) (int, error) {
+	c.writes++
+	return c.data.Write(b)
+}
+
+func TestSendBatchSingleWrite(t *testing.T) {
+	conn := &writesCountConn{}
+	m := &MTProto{
+		mutex:         &sync.Mutex{},
+		msgsByID:      newPendingPackets(),
+		pendingChecks: newPendingWheel(pendingWheelTick, pendingWheelSlots),
+		conn:          conn,
+		transport:     IntermediateTransport{},
+		log:           Logger{Hnd: NoopLogHandler{}},
+		session:       &SessionInfo{},
+	}
+	packets := []*packetToSend{
+		newPacket(TL_help_getConfig{}, nil),
+		newPacket(TL_help_getNearestDC{}, nil),
+		newPacket(TL_ping{PingID: 1}, nil),
+	}
+	if err := m.sendBatch(packets); err != nil {
+		t.Fatal(err)
+	}
+	if conn.writes != 1 {
+		t.Errorf("expected 1 write, got %d", conn.writes)
+	}
+	for i := range packets {
+		if _, err := (IntermediateTransport{}).ReadPacket(&conn.data); err != nil {
+			t.Fatalf("packet #%d: %s", i, err)
+		}
+	}
+	if conn.data.Len() != 0 {
+		t.Errorf("unexpected %d trailing bytes", conn.data.Len())
+	}
+}
+
+// loopConn returns the same data over and over on reading
+type loopConn struct {
+	net.Conn
+	data []byte
+	pos  int
+}
+
+func (c *loopConn) Read(b []byte) (int, error) {
+	n := copy(b, c.data[c.pos:])
+	c.pos = (c.pos + n) % len(c.data)
+	return n, nil
+}
+
+func (c *loopConn) SetReadDeadline(t time.Time) error { return nil }
+
+// serverPacket encrypts obj like server does and frames it with IntermediateTransport
+func serverPacket(tb testing.TB, authKey, obj []byte) []byte {
+	z := NewEncodeBuf(64 + len(obj))
+	z.Long(0)                         // salt
+	z.Long(0)                         // session_id
+	z.Long(time.Now().Unix()<<32 | 1) // msg_id
+	z.Int(1)
+	z.Int(int32(len(obj)))
+	z.Bytes(obj)
+	z.Bytes(make([]byte, 12+(16-(len(z.buf)+12)%16)%16))
+	msgKey := generateMsgKey(authKey, z.buf, true)
+	aesKey, aesIV := generateAES(msgKey, authKey, true)
+	encrypted, err := doAES256IGEencrypt(z.buf, aesKey, aesIV)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	x := NewEncodeBuf(24 + len(encrypted))
+	x.Bytes(sha1(authKey)[12:20])
+	x.Bytes(msgKey)
+	x.Bytes(encrypted)
+	framed := &bytes.Buffer{}
+	if err := (IntermediateTransport{}).WritePacket(framed, x.buf); err != nil {
+		tb.Fatal(err)
+	}
+	return framed.Bytes()
+}
+
+// BenchmarkReadUpdates measures allocations per incoming packet on a sustained stream:
+// read and decrypt buffers are reused, so only decoded objects should be allocated.
+func BenchmarkReadUpdates(b *testing.B) {
+	authKey := make([]byte, 256)
+	for i := range authKey {
+		authKey[i] = byte(i)
+	}
+	for _, bc := range []struct {
+		name string
+		obj  TL
+	}{
+		{"small", TL_updateShort{Update: TL_updateConfig{}, Date: 1}},
+		// bigger packets (but still fitting reused buffers) make per-packet copies visible in B/op
+		{"large", TL_upload_file{Type: TL_storage_filePartial{}, Bytes: make([]byte, 32*1024)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			data := serverPacket(b, authKey, bc.obj.encode())
+			m := &MTProto{
+				mutex:     &sync.Mutex{},
+				msgsByID:  newPendingPackets(),
+				conn:      &loopConn{data: data},
+				transport: IntermediateTransport{},
+				log:       Logger{Hnd: NoopLogHandler{}},
+				session:   &SessionInfo{AuthKey: authKey, AuthKeyHash: sha1(authKey)[12:20]},
+			}
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				packet, err := m.read()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if reflect.TypeOf(packet.msg) != reflect.TypeOf(bc.obj) {
+					b.Fatalf("unexpected message: %T", packet.msg)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package mtproto
+
+import (
+	cryptoRand "crypto/rand"
+
+	"github.com/ansel1/merry/v2"
+)
+
+type PasswordSettings struct {
+	CurrentPassword string // required if account already has a password
+	NewPassword     string // empty to remove password
+	Hint            string
+	Email           string // optional recovery email, EMAIL_UNCONFIRMED_<len> error is returned if it needs confirmation
+}
+
+// UpdatePassword sets, changes or removes account cloud (2FA) password.
+// https://core.telegram.org/api/srp#setting-a-new-2fa-password
+func (m *MTProto) UpdatePassword(settings PasswordSettings) error {
+	x := m.SendSync(TL_account_getPassword{})
+	accPasswd, ok := x.(TL_account_password)
+	if !ok {
+		return WrongRespError(x)
+	}
+
+	var currentCheck TL = TL_inputCheckPasswordEmpty{}
+	if accPasswd.HasPassword {
+		algo, ok := accPasswd.CurrentAlgo.(TL_passwordKDFAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow)
+		if !ok {
+			return merry.Errorf("unknown current password algo %T, application update is maybe needed",
+				accPasswd.CurrentAlgo)
+		}
+		var err error
+		currentCheck, err = calcInputCheckPasswordSRP(algo, accPasswd, settings.CurrentPassword, cryptoRand.Read, m.log.Debug)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+	}
+
+	var newSettings TL_account_passwordInputSettings
+	if settings.NewPassword == "" {
+		if !accPasswd.HasPassword {
+			return merry.New("account has no password, nothing to remove")
+		}
+		newSettings = TL_account_passwordInputSettings{
+			NewAlgo:         TL_passwordKDFAlgoUnknown{},
+			NewPasswordHash: []byte{},
+			Hint:            Ref(""),
+		}
+	} else {
+		algo, ok := accPasswd.NewAlgo.(TL_passwordKDFAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow)
+		if !ok {
+			return merry.Errorf("unknown new password algo %T, application update is maybe needed",
+				accPasswd.NewAlgo)
+		}
+		// "client must append 32 sufficiently random bytes to the salt1, before using it"
+		salt := make([]byte, len(algo.Salt1)+32)
+		copy(salt, algo.Salt1)
+		if _, err := cryptoRand.Read(salt[len(algo.Salt1):]); err != nil {
+			return merry.Wrap(err)
+		}
+		algo.Salt1 = salt
+
+		hash, err := calcNewPasswordHash(algo, settings.NewPassword)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		newSettings = TL_account_passwordInputSettings{
+			NewAlgo:         algo,
+			NewPasswordHash: hash,
+			Hint:            Ref(settings.Hint),
+		}
+		if settings.Email != "" {
+			newSettings.Email = Ref(settings.Email)
+		}
+	}
+
+	x = m.SendSync(TL_account_updatePasswordSettings{
+		Password:    currentCheck,
+		NewSettings: newSettings,
+	})
+	if _, ok := x.(TL_boolTrue); !ok {
+		return WrongRespError(x)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package mtproto
+
+import "sync"
+
+const pendingShardsCount = 16
+
+// pendingPackets holds sent packets waiting for response or ack (by message ID).
+// It is split into shards with separate locks, so reading, sending and service routines
+// do not contend for the MTProto mutex on every message.
+//
+// Shard lock also guards needAck field of the packets stored in it.
+// Response channel of a stored packet is only touched by the one who removed the packet.
+// Callbacks are called under shard lock: they must not take other locks or block.
+type pendingPackets struct {
+	shards [pendingShardsCount]pendingShard
+}
+
+type pendingShard struct {
+	mutex sync.Mutex
+	byID  map[int64]*packetToSend
+}
+
+func newPendingPackets() *pendingPackets {
+	p := &pendingPackets{}
+	for i := range p.shards {
+		p.shards[i].byID = make(map[int64]*packetToSend)
+	}
+	return p
+}
+
+func (p *pendingPackets) shard(msgID int64) *pendingShard {
+	// client message IDs are divisible by 4
+	return &p.shards[(uint64(msgID)>>2)%pendingShardsCount]
+}
+
+func (p *pendingPackets) get(msgID int64) (*packetToSend, bool) {
+	s := p.shard(msgID)
+	s.mutex.Lock()
+	packet, ok := s.byID[msgID]
+	s.mutex.Unlock()
+	return packet, ok
+}
+
+func (p *pendingPackets) add(packet *packetToSend) {
+	s := p.shard(packet.msgID)
+	s.mutex.Lock()
+	s.byID[packet.msgID] = packet
+	s.mutex.Unlock()
+}
+
+// remove removes and returns packet msgID (if present).
+func (p *pendingPackets) remove(msgID int64) (*packetToSend, bool) {
+	return p.removeIf(msgID, nil)
+}
+
+// removeIf removes and returns packet msgID if it is present and cond (if not nil) returns true for it.
+func (p *pendingPackets) removeIf(msgID int64, cond func(*packetToSend) bool) (*packetToSend, bool) {
+	s := p.shard(msgID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	packet, ok := s.byID[msgID]
+	if !ok || (cond != nil && !cond(packet)) {
+		return nil, false
+	}
+	delete(s.byID, msgID)
+	return packet, true
+}
+
+// update calls f for packet msgID (if present), packet is removed if f returns true.
+// Returns false if there is no such packet.
+func (p *pendingPackets) update(msgID int64, f func(*packetToSend) (remove bool)) bool {
+	s := p.shard(msgID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	packet, ok := s.byID[msgID]
+	if ok && f(packet) {
+		delete(s.byID, msgID)
+	}
+	return ok
+}
+
+// each calls f for every packet (locking one shard at a time), packet is removed if f returns true.
+func (p *pendingPackets) each(f func(msgID int64, packet *packetToSend) (remove bool)) {
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mutex.Lock()
+		for id, packet := range s.byID {
+			if f(id, packet) {
+				delete(s.byID, id)
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+func (p *pendingPackets) len() int {
+	count := 0
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mutex.Lock()
+		count += len(s.byID)
+		s.mutex.Unlock()
+	}
+	return count
+}
+
+func (p *pendingPackets) clear() {
+	p.each(func(int64, *packetToSend) bool { return true })
+}
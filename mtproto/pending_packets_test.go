@@ -0,0 +1,39 @@
+package mtproto
+
+import "testing"
+
+func TestPendingPackets(t *testing.T) {
+	p := newPendingPackets()
+	for id := int64(4); id <= 400; id += 4 {
+		p.add(&packetToSend{msgID: id, resp: make(chan TL, 1)})
+	}
+	if p.len() != 100 {
+		t.Fatalf("expected 100 packets, got %d", p.len())
+	}
+
+	if _, ok := p.removeIf(8, func(packet *packetToSend) bool { return packet.resp == nil }); ok {
+		t.Fatalf("packet should not be removed: condition is false")
+	}
+	if packet, ok := p.remove(8); !ok || packet.msgID != 8 {
+		t.Fatalf("packet was not removed")
+	}
+	if _, ok := p.get(8); ok {
+		t.Fatalf("removed packet is still present")
+	}
+	p.update(12, func(packet *packetToSend) bool {
+		packet.needAck = true
+		return false
+	})
+	if packet, _ := p.get(12); !packet.needAck {
+		t.Fatalf("packet was not updated")
+	}
+
+	p.each(func(id int64, _ *packetToSend) bool { return id > 200 })
+	if p.len() != 49 {
+		t.Fatalf("expected 49 packets, got %d", p.len())
+	}
+	p.clear()
+	if p.len() != 0 {
+		t.Fatalf("expected no packets, got %d", p.len())
+	}
+}
@@ -0,0 +1,184 @@
+package mtproto
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	pendingWheelTick  = time.Second
+	pendingWheelSlots = 64
+	// containers, salts and temporary key are checked with this interval
+	maintenanceInterval = 5 * time.Second
+)
+
+type pendingCheck int
+
+const (
+	checkExpiration pendingCheck = iota // no response during rpcTimeout
+	checkAck                            // no ack during ackTimeout, see msgs_state.go
+)
+
+type pendingWheelEntry struct {
+	packet *packetToSend
+	msgID  int64
+	check  pendingCheck
+	rounds int // full wheel turns left before the entry is due
+}
+
+// pendingWheel is a hashed timer wheel of sent packets checks. Each check is put
+// into the slot it is due in, so stale packets are found without scanning all pending ones.
+type pendingWheel struct {
+	mutex sync.Mutex
+	tick  time.Duration
+	slots [][]pendingWheelEntry
+	pos   int
+}
+
+func newPendingWheel(tick time.Duration, slotsCount int) *pendingWheel {
+	return &pendingWheel{tick: tick, slots: make([][]pendingWheelEntry, slotsCount)}
+}
+
+// schedule adds entry that will be returned by advance after the delay (rounded up to the tick).
+func (w *pendingWheel) schedule(delay time.Duration, entry pendingWheelEntry) {
+	ticks := int((delay + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	w.mutex.Lock()
+	entry.rounds = (ticks - 1) / len(w.slots)
+	slot := (w.pos + ticks) % len(w.slots)
+	w.slots[slot] = append(w.slots[slot], entry)
+	w.mutex.Unlock()
+}
+
+// advance moves the wheel one tick forward and returns entries that are due.
+func (w *pendingWheel) advance() []pendingWheelEntry {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.pos = (w.pos + 1) % len(w.slots)
+	slot := w.slots[w.pos]
+	var due []pendingWheelEntry
+	kept := slot[:0]
+	for _, entry := range slot {
+		if entry.rounds > 0 {
+			entry.rounds--
+			kept = append(kept, entry)
+		} else {
+			due = append(due, entry)
+		}
+	}
+	for i := len(kept); i < len(slot); i++ {
+		slot[i] = pendingWheelEntry{} // not holding removed packets
+	}
+	w.slots[w.pos] = kept
+	return due
+}
+
+func (w *pendingWheel) clear() {
+	w.mutex.Lock()
+	for i := range w.slots {
+		w.slots[i] = nil
+	}
+	w.mutex.Unlock()
+}
+
+// schedulePendingChecks schedules expiration and ack checks for just registered packet.
+// Should be called under mutex. Packets resent with the same msg_id (after reconnection)
+// already have their checks scheduled.
+func (m *MTProto) schedulePendingChecks(packet *packetToSend) {
+	if packet.checksMsgID == packet.msgID {
+		return
+	}
+	packet.checksMsgID = packet.msgID
+	if m.rpcTimeout > 0 {
+		m.pendingChecks.schedule(m.rpcTimeout, pendingWheelEntry{packet: packet, msgID: packet.msgID, check: checkExpiration})
+	}
+	if _, isStateReq := packet.msg.(TL_msgsStateReq); packet.needAck && !isStateReq {
+		m.pendingChecks.schedule(ackTimeout, pendingWheelEntry{packet: packet, msgID: packet.msgID, check: checkAck})
+	}
+}
+
+// maintenanceRoutine runs due pending packets checks and periodic session maintenance.
+func (m *MTProto) maintenanceRoutine(ctx context.Context) {
+	ticker := time.NewTicker(pendingWheelTick)
+	defer ticker.Stop()
+	lastMaintenance := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		m.runPendingChecks(m.pendingChecks.advance())
+
+		if time.Since(lastMaintenance) >= maintenanceInterval {
+			lastMaintenance = time.Now()
+			m.forgetDoneContainers()
+			m.rotateServerSalt()
+			if m.tempAuthKeyExpiring() {
+				m.log.Info("temporary auth key expires soon, reconnecting with new one")
+				go m.reconnectLogged()
+			}
+		}
+	}
+}
+
+func (m *MTProto) runPendingChecks(entries []pendingWheelEntry) {
+	var unackedIDs []int64
+	for _, entry := range entries {
+		switch entry.check {
+		case checkExpiration:
+			m.expirePacket(entry)
+		case checkAck:
+			if m.checkUnacked(entry) {
+				unackedIDs = append(unackedIDs, entry.msgID)
+			}
+		}
+	}
+	if len(unackedIDs) > 0 {
+		go m.requestMsgsState(unackedIDs)
+	}
+}
+
+// expirePacket removes packet that is waiting for response longer than rpcTimeout,
+// waiting request receives RPC timeout error.
+func (m *MTProto) expirePacket(entry pendingWheelEntry) {
+	var remaining time.Duration
+	packet, ok := m.msgsByID.removeIf(entry.msgID, func(p *packetToSend) bool {
+		if p != entry.packet {
+			return false
+		}
+		remaining = m.rpcTimeout - time.Since(p.sentAt)
+		return remaining <= 0
+	})
+	if !ok {
+		if remaining > 0 {
+			// packet was resent with the same ID after reconnection
+			m.pendingChecks.schedule(remaining, entry)
+		}
+		return
+	}
+	m.log.Warn("msgsByID: #%d %T: no response for %s, expiring", packet.msgID, packet.msg, m.rpcTimeout)
+	m.respToPacket(packet, TL_rpcError{ErrorCode: TL_ErrTimeout, ErrorMessage: RPCTimeoutErrMessage})
+}
+
+// forgetDoneContainers forgets sent containers whose messages are all answered.
+func (m *MTProto) forgetDoneContainers() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for containerID, ids := range m.containerMsgs {
+		isDone := true
+		for _, id := range ids {
+			if _, ok := m.msgsByID.get(id); ok {
+				isDone = false
+				break
+			}
+		}
+		if isDone {
+			delete(m.containerMsgs, containerID)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package mtproto
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPendingWheel(t *testing.T) {
+	w := newPendingWheel(time.Second, 4)
+	w.schedule(time.Second, pendingWheelEntry{msgID: 1})
+	w.schedule(3*time.Second, pendingWheelEntry{msgID: 3})
+	w.schedule(9*time.Second, pendingWheelEntry{msgID: 9}) // more than a full turn
+
+	for tick := 1; tick <= 10; tick++ {
+		due := w.advance()
+		var ids []int64
+		for _, entry := range due {
+			ids = append(ids, entry.msgID)
+		}
+		switch tick {
+		case 1, 3, 9:
+			if len(ids) != 1 || ids[0] != int64(tick) {
+				t.Fatalf("tick %d: expected entry #%d, got %v", tick, tick, ids)
+			}
+		default:
+			if len(ids) != 0 {
+				t.Fatalf("tick %d: unexpected entries %v", tick, ids)
+			}
+		}
+	}
+}
+
+func TestPendingPacketExpiration(t *testing.T) {
+	m := &MTProto{
+		mutex:         &sync.Mutex{},
+		msgsByID:      newPendingPackets(),
+		pendingChecks: newPendingWheel(time.Second, 8),
+		rpcTimeout:    2 * time.Second,
+		log:           Logger{Hnd: NoopLogHandler{}},
+	}
+	resp := make(chan TL, 1)
+	packet := &packetToSend{msgID: 100, msg: TL_help_getConfig{}, resp: resp}
+	m.registerPacket(packet)
+
+	m.runPendingChecks(m.pendingChecks.advance())
+	m.runPendingChecks(m.pendingChecks.advance())
+	if _, ok := m.msgsByID.get(100); !ok {
+		t.Fatalf("packet expired too early")
+	}
+
+	// response is still not received after timeout
+	packet.sentAt = time.Now().Add(-3 * time.Second)
+	for i := 0; i < 8; i++ {
+		m.runPendingChecks(m.pendingChecks.advance())
+	}
+	if _, ok := m.msgsByID.get(100); ok {
+		t.Fatalf("packet was not expired")
+	}
+	if res, ok := (<-resp).(TL_rpcError); !ok || !IsRPCTimeout(res) {
+		t.Fatalf("expected RPC timeout, got %#v", res)
+	}
+}
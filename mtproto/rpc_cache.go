@@ -0,0 +1,155 @@
+package mtproto
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRPCCacheTTL        = time.Minute
+	DefaultRPCCacheMaxEntries = 1024
+)
+
+// RPCCache is a middleware caching responses of idempotent requests for some time,
+// so frequently repeated identical requests (like resolving the same username)
+// do not reach the server and do not trigger flood limits.
+//
+// Requests are cached by their type and encoded content, only successful responses are stored.
+// Cached responses are shared between callers and must not be modified.
+//
+//	cache := mtproto.NewRPCCache()
+//	cache.SetTTL(mtproto.TL_help_getAppConfig{}, time.Hour)
+//	m.Use(cache.Middleware())
+type RPCCache struct {
+	mutex      sync.Mutex
+	ttls       map[uint32]time.Duration // by request constructor
+	entries    map[string]rpcCacheEntry // by encoded request
+	maxEntries int
+}
+
+type rpcCacheEntry struct {
+	res       TL
+	expiresAt time.Time
+}
+
+// NewRPCCache returns cache for help.getConfig, users.getUsers and contacts.resolveUsername
+// requests with DefaultRPCCacheTTL. Other requests may be added with SetTTL.
+func NewRPCCache() *RPCCache {
+	c := &RPCCache{
+		ttls:       make(map[uint32]time.Duration),
+		entries:    make(map[string]rpcCacheEntry),
+		maxEntries: DefaultRPCCacheMaxEntries,
+	}
+	c.ttls[CRC_help_getConfig] = DefaultRPCCacheTTL
+	c.ttls[CRC_users_getUsers] = DefaultRPCCacheTTL
+	c.ttls[CRC_contacts_resolveUsername] = DefaultRPCCacheTTL
+	return c
+}
+
+// SetTTL sets how long responses to requests of msg type are cached.
+// Zero ttl disables caching for them (already cached responses are dropped).
+func (c *RPCCache) SetTTL(msg TLReq, ttl time.Duration) {
+	crc := requestCRC(msg.encode())
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if ttl > 0 {
+		c.ttls[crc] = ttl
+		return
+	}
+	delete(c.ttls, crc)
+	for key := range c.entries {
+		if requestCRC([]byte(key)) == crc {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// SetMaxEntries limits number of cached responses (DefaultRPCCacheMaxEntries by default).
+// Responses are not cached while the cache is full of unexpired entries.
+func (c *RPCCache) SetMaxEntries(count int) {
+	c.mutex.Lock()
+	c.maxEntries = count
+	c.mutex.Unlock()
+}
+
+// Invalidate drops cached response for msg (if any).
+func (c *RPCCache) Invalidate(msg TLReq) {
+	key := string(msg.encode())
+	c.mutex.Lock()
+	delete(c.entries, key)
+	c.mutex.Unlock()
+}
+
+// Clear drops all cached responses.
+func (c *RPCCache) Clear() {
+	c.mutex.Lock()
+	c.entries = make(map[string]rpcCacheEntry)
+	c.mutex.Unlock()
+}
+
+// Middleware returns middleware for MTProto.Use.
+func (c *RPCCache) Middleware() Middleware {
+	return func(next Invoker) Invoker {
+		return func(ctx context.Context, msg TLReq) TL {
+			data := msg.encode()
+			c.mutex.Lock()
+			ttl := c.ttls[requestCRC(data)]
+			c.mutex.Unlock()
+			if ttl <= 0 {
+				return next(ctx, msg)
+			}
+
+			key := string(data)
+			if res, ok := c.get(key); ok {
+				return res
+			}
+			res := next(ctx, msg)
+			switch res.(type) {
+			case nil, TL_rpcError, TL_badMsgNotification:
+			default:
+				c.put(key, res, ttl)
+			}
+			return res
+		}
+	}
+}
+
+func (c *RPCCache) get(key string) (TL, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.res, true
+}
+
+func (c *RPCCache) put(key string, res TL, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	if len(c.entries) >= c.maxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			return
+		}
+	}
+	c.entries[key] = rpcCacheEntry{res: res, expiresAt: now.Add(ttl)}
+}
+
+func requestCRC(data []byte) uint32 {
+	if len(data) < 4 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(data)
+}
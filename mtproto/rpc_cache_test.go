@@ -0,0 +1,66 @@
+package mtproto
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRPCCache(t *testing.T) {
+	calls := 0
+	var resp TL
+	invoker := NewRPCCache().Middleware()(func(ctx context.Context, msg TLReq) TL {
+		calls++
+		return resp
+	})
+	ctx := context.Background()
+	send := func(msg TLReq, expectedCalls int) {
+		t.Helper()
+		invoker(ctx, msg)
+		if calls != expectedCalls {
+			t.Fatalf("%#v: expected %d calls, got %d", msg, expectedCalls, calls)
+		}
+	}
+
+	resp = TL_rpcError{ErrorCode: 400, ErrorMessage: "USERNAME_INVALID"}
+	send(TL_contacts_resolveUsername{Username: "a"}, 1)
+	send(TL_contacts_resolveUsername{Username: "a"}, 2) // errors are not cached
+
+	resp = TL_contacts_resolvedPeer{}
+	send(TL_contacts_resolveUsername{Username: "a"}, 3)
+	send(TL_contacts_resolveUsername{Username: "a"}, 3)
+	send(TL_contacts_resolveUsername{Username: "b"}, 4)
+	send(TL_help_getNearestDC{}, 5) // not cached by default
+	send(TL_help_getNearestDC{}, 6)
+}
+
+func TestRPCCacheExpiration(t *testing.T) {
+	cache := NewRPCCache()
+	cache.SetTTL(TL_help_getConfig{}, time.Millisecond)
+	cache.SetMaxEntries(1)
+	calls := 0
+	invoker := cache.Middleware()(func(ctx context.Context, msg TLReq) TL {
+		calls++
+		return TL_config{}
+	})
+	ctx := context.Background()
+
+	invoker(ctx, TL_help_getConfig{})
+	time.Sleep(2 * time.Millisecond)
+	invoker(ctx, TL_help_getConfig{})
+	if calls != 2 {
+		t.Fatalf("expected expired response to be requested again, got %d calls", calls)
+	}
+	// cache is full of unexpired entries
+	invoker(ctx, TL_users_getUsers{})
+	invoker(ctx, TL_users_getUsers{})
+	if calls != 4 {
+		t.Fatalf("expected response not to be cached, got %d calls", calls)
+	}
+	cache.Invalidate(TL_help_getConfig{})
+	invoker(ctx, TL_users_getUsers{})
+	invoker(ctx, TL_users_getUsers{})
+	if calls != 5 {
+		t.Fatalf("expected response to be cached after invalidation, got %d calls", calls)
+	}
+}
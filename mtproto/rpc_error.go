@@ -0,0 +1,80 @@
+package mtproto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RPCError is TL_rpcError as Go error.
+// Numeric suffix (like in FLOOD_WAIT_30 or PHONE_MIGRATE_2) is moved to Argument:
+//
+//	RPCError{Code: 420, Message: "FLOOD_WAIT", Argument: 30, HasArgument: true}
+//
+// It can be matched with errors.Is against a pattern RPCError:
+// zero Code and empty Message match any value. For example:
+//
+//	errors.Is(err, &RPCError{Message: "FLOOD_WAIT"})
+//
+// https://core.telegram.org/api/errors
+type RPCError struct {
+	Code        int32
+	Message     string
+	Argument    int64
+	HasArgument bool
+}
+
+func NewRPCError(tl TL_rpcError) *RPCError {
+	err := &RPCError{Code: tl.ErrorCode, Message: tl.ErrorMessage}
+	if i := strings.LastIndexByte(tl.ErrorMessage, '_'); i > 0 {
+		if arg, parseErr := strconv.ParseInt(tl.ErrorMessage[i+1:], 10, 64); parseErr == nil {
+			err.Message = tl.ErrorMessage[:i]
+			err.Argument = arg
+			err.HasArgument = true
+		}
+	}
+	return err
+}
+
+// AsRPCError extracts RPCError from TL_rpcError, *RPCError or error returned by WrongRespError.
+func AsRPCError(tlOrErr any) (*RPCError, bool) {
+	if val, ok := unwrapUnexpectedTypeErrValue(tlOrErr); ok {
+		tlOrErr = val
+	}
+	switch e := tlOrErr.(type) {
+	case TL_rpcError:
+		return NewRPCError(e), true
+	case *RPCError:
+		return e, true
+	}
+	return nil, false
+}
+
+// FullMessage returns original error message (with argument, if any).
+func (e *RPCError) FullMessage() string {
+	if e.HasArgument {
+		return e.Message + "_" + strconv.FormatInt(e.Argument, 10)
+	}
+	return e.Message
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.FullMessage())
+}
+
+func (e *RPCError) Is(target error) bool {
+	t, ok := target.(*RPCError)
+	if !ok {
+		return false
+	}
+	return (t.Code == 0 || t.Code == e.Code) &&
+		(t.Message == "" || t.Message == e.Message || t.Message == e.FullMessage())
+}
+
+// MigrateDC returns target DC ID for *_MIGRATE_X errors (PHONE_MIGRATE_X, FILE_MIGRATE_X, etc.).
+func (e *RPCError) MigrateDC() (int32, bool) {
+	if e.Code == TL_ErrSeeOther && e.HasArgument && strings.HasSuffix(e.Message, "_MIGRATE") {
+		return int32(e.Argument), true
+	}
+	return 0, false
+}
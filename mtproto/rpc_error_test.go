@@ -0,0 +1,35 @@
+package mtproto
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRPCError(t *testing.T) {
+	err := WrongRespError(TL_rpcError{ErrorCode: 303, ErrorMessage: "PHONE_MIGRATE_4"})
+
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("errors.As failed for %s", err)
+	}
+	if rpcErr.Message != "PHONE_MIGRATE" || rpcErr.Argument != 4 || !rpcErr.HasArgument {
+		t.Errorf("wrong parsed error: %#v", rpcErr)
+	}
+	if dcID, ok := rpcErr.MigrateDC(); !ok || dcID != 4 {
+		t.Errorf("wrong migrate DC: %d %v", dcID, ok)
+	}
+
+	for _, target := range []*RPCError{{Message: "PHONE_MIGRATE"}, {Message: "PHONE_MIGRATE_4"}, {Code: 303}} {
+		if !errors.Is(err, target) {
+			t.Errorf("error should match %#v", target)
+		}
+	}
+	if errors.Is(err, &RPCError{Code: 420, Message: "PHONE_MIGRATE"}) {
+		t.Errorf("error should not match other code")
+	}
+
+	noArg := NewRPCError(TL_rpcError{ErrorCode: 400, ErrorMessage: "PHONE_CODE_INVALID"})
+	if noArg.Message != "PHONE_CODE_INVALID" || noArg.HasArgument {
+		t.Errorf("wrong parsed error: %#v", noArg)
+	}
+}
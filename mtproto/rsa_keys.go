@@ -0,0 +1,92 @@
+package mtproto
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+
+	"github.com/ansel1/merry/v2"
+)
+
+var ErrNoServerPublicKey = merry.Sentinel("none of server public key fingerprints is known")
+
+// ServerPublicKey is a server RSA key used to encrypt data during auth key exchange.
+type ServerPublicKey struct {
+	Key         *rsa.PublicKey
+	Fingerprint int64
+}
+
+// NewServerPublicKey calculates key fingerprint (lower 64 bits of SHA1 of rsa_public_key n:string e:string).
+func NewServerPublicKey(key *rsa.PublicKey) ServerPublicKey {
+	buf := NewEncodeBuf(512)
+	buf.StringBytes(key.N.Bytes())
+	buf.StringBytes(big.NewInt(int64(key.E)).Bytes())
+	hash := sha1(buf.buf)
+	return ServerPublicKey{Key: key, Fingerprint: int64(binary.LittleEndian.Uint64(hash[12:20]))}
+}
+
+// ParseServerPublicKeyPEM parses RSA key in PEM format ("RSA PUBLIC KEY" or "PUBLIC KEY"),
+// as published for test servers or used by self-hosted servers.
+func ParseServerPublicKeyPEM(data []byte) (ServerPublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return ServerPublicKey{}, merry.New("no PEM data found")
+	}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return ServerPublicKey{}, merry.Wrap(err)
+		}
+		return NewServerPublicKey(key), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return ServerPublicKey{}, merry.Wrap(err)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ServerPublicKey{}, merry.Errorf("expected RSA key, got %T", key)
+		}
+		return NewServerPublicKey(rsaKey), nil
+	}
+	return ServerPublicKey{}, merry.Errorf("unexpected PEM block type: %s", block.Type)
+}
+
+// DefaultServerPublicKeys returns built-in Telegram server keys.
+func DefaultServerPublicKeys() []ServerPublicKey {
+	return []ServerPublicKey{{Key: &telegramPublicKey, Fingerprint: telegramPublicKey_FP}}
+}
+
+// AddServerPublicKeys registers additional server keys (e.g. for test or self-hosted servers).
+// Keys with already known fingerprints are ignored. Should be called before the connection.
+func (m *MTProto) AddServerPublicKeys(keys ...ServerPublicKey) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, key := range keys {
+		if findServerPublicKey(m.serverKeys, []int64{key.Fingerprint}) == nil {
+			m.serverKeys = append(m.serverKeys, key)
+		}
+	}
+}
+
+// ServerPublicKeys returns keys that may be used during auth key exchange.
+func (m *MTProto) ServerPublicKeys() []ServerPublicKey {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]ServerPublicKey(nil), m.serverKeys...)
+}
+
+// findServerPublicKey returns first key with one of the fingerprints (as sent in resPQ) or nil.
+func findServerPublicKey(keys []ServerPublicKey, fingerprints []int64) *ServerPublicKey {
+	for _, fp := range fingerprints {
+		for i := range keys {
+			if keys[i].Fingerprint == fp {
+				return &keys[i]
+			}
+		}
+	}
+	return nil
+}
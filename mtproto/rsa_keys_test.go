@@ -0,0 +1,27 @@
+package mtproto
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestServerPublicKeyFingerprint(t *testing.T) {
+	if fp := NewServerPublicKey(&telegramPublicKey).Fingerprint; fp != telegramPublicKey_FP {
+		t.Fatalf("wrong fingerprint: %d, expected %d", fp, int64(telegramPublicKey_FP))
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&telegramPublicKey)})
+	key, err := ParseServerPublicKeyPEM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Fingerprint != telegramPublicKey_FP || key.Key.N.Cmp(telegramPublicKey.N) != 0 {
+		t.Fatalf("wrong parsed key: %#v", key)
+	}
+
+	keys := []ServerPublicKey{{Fingerprint: 1}, key}
+	if found := findServerPublicKey(keys, []int64{2, telegramPublicKey_FP}); found == nil || found.Fingerprint != telegramPublicKey_FP {
+		t.Fatalf("key was not found: %#v", found)
+	}
+}
@@ -0,0 +1,97 @@
+package mtproto
+
+import "time"
+
+const (
+	// number of salts requested with get_future_salts (server returns at most 64)
+	futureSaltsNum = 32
+	// new salts are requested when known ones cover less than this time
+	futureSaltsMinAhead = time.Hour
+	// salt is switched a bit before the current one expires
+	// (server also accepts previous salt for some time after that)
+	saltSwitchAdvance = time.Minute
+	// max time to wait for get_future_salts response
+	futureSaltsTimeout = 30 * time.Second
+)
+
+// rotateServerSalt switches session salt to the one valid for current (server) time
+// and requests more salts when known ones are about to run out. So salt is changed
+// proactively instead of after bad_server_salt and resending pending requests.
+func (m *MTProto) rotateServerSalt() {
+	now := time.Now().Add(m.TimeOffset()).Add(saltSwitchAdvance).Unix()
+
+	m.mutex.Lock()
+	salts := m.futureSalts[:0]
+	for _, salt := range m.futureSalts {
+		if int64(salt.ValidUntil) > now {
+			salts = append(salts, salt)
+		}
+	}
+	m.futureSalts = salts
+	var current *TL_futureSalt
+	var coveredUntil int64
+	for i, salt := range salts {
+		if int64(salt.ValidSince) <= now && (current == nil || salt.ValidUntil > current.ValidUntil) {
+			current = &salts[i]
+		}
+		if int64(salt.ValidUntil) > coveredUntil {
+			coveredUntil = int64(salt.ValidUntil)
+		}
+	}
+	needMore := !m.futureSaltsRequested && coveredUntil-now < int64(futureSaltsMinAhead/time.Second)
+	if needMore {
+		m.futureSaltsRequested = true
+	}
+	m.mutex.Unlock()
+
+	if current != nil && current.Salt != m.session.ServerSalt {
+		m.log.Debug("switching server salt, valid until %s", time.Unix(int64(current.ValidUntil), 0))
+		m.session.ServerSalt = current.Salt
+		m.SaveSessionLogged()
+	}
+	if needMore {
+		go m.requestFutureSalts()
+	}
+}
+
+func (m *MTProto) requestFutureSalts() {
+	defer func() {
+		m.mutex.Lock()
+		m.futureSaltsRequested = false
+		m.mutex.Unlock()
+	}()
+
+	resp := make(chan TL, 1)
+	m.enqueue(newPacket(TL_getFutureSalts{Num: futureSaltsNum}, resp))
+
+	var res TL
+	select {
+	case res = <-resp:
+	case <-time.After(futureSaltsTimeout):
+		m.log.Warn("no response to get_future_salts")
+		return
+	}
+	data, ok := res.(TL_futureSalts)
+	if !ok {
+		m.log.Warn("unexpected response to get_future_salts: %T", res)
+		return
+	}
+	salts := make([]TL_futureSalt, 0, len(data.Salts))
+	for _, s := range data.Salts {
+		if salt, ok := s.(TL_futureSalt); ok {
+			salts = append(salts, salt)
+		}
+	}
+	m.log.Debug("got %d future salt(s)", len(salts))
+
+	m.mutex.Lock()
+	m.futureSalts = salts
+	m.mutex.Unlock()
+}
+
+// dropFutureSalts forgets known salts, they are bound to auth key.
+func (m *MTProto) dropFutureSalts() {
+	m.mutex.Lock()
+	m.futureSalts = nil
+	m.mutex.Unlock()
+}
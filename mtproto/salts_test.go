@@ -0,0 +1,55 @@
+package mtproto
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDecodeFutureSalts(t *testing.T) {
+	buf := make([]byte, 0, 64)
+	buf = binary.LittleEndian.AppendUint32(buf, CRC_futureSalts)
+	buf = binary.LittleEndian.AppendUint64(buf, 123)
+	buf = binary.LittleEndian.AppendUint32(buf, 1000)
+	buf = binary.LittleEndian.AppendUint32(buf, 1)
+	buf = binary.LittleEndian.AppendUint32(buf, 900)
+	buf = binary.LittleEndian.AppendUint32(buf, 2700)
+	buf = binary.LittleEndian.AppendUint64(buf, 42)
+
+	m := &MTProto{mutex: &sync.Mutex{}, log: Logger{Hnd: NoopLogHandler{}}}
+	dbuf := NewDecodeBuf(buf)
+	res, ok := m.decodeMessage(dbuf, nil).(TL_futureSalts)
+	if dbuf.err != nil || !ok {
+		t.Fatalf("failed to decode: %v %#v", dbuf.err, res)
+	}
+	if res.ReqMsgID != 123 || res.Now != 1000 || len(res.Salts) != 1 ||
+		res.Salts[0] != (TL_futureSalt{ValidSince: 900, ValidUntil: 2700, Salt: 42}) {
+		t.Fatalf("wrong future salts: %#v", res)
+	}
+}
+
+func TestRotateServerSalt(t *testing.T) {
+	now := int32(time.Now().Unix())
+	m := &MTProto{
+		mutex:        &sync.Mutex{},
+		session:      &SessionInfo{ServerSalt: 1},
+		sessionStore: &SessNoopStore{},
+		log:          Logger{Hnd: NoopLogHandler{}},
+		futureSalts: []TL_futureSalt{
+			{ValidSince: now - 3600, ValidUntil: now - 1800, Salt: 2},
+			{ValidSince: now - 1800, ValidUntil: now + 1800, Salt: 3},
+			{ValidSince: now + 1800, ValidUntil: now + 7200, Salt: 4},
+		},
+	}
+	m.rotateServerSalt()
+	if m.session.ServerSalt != 3 {
+		t.Errorf("expected salt 3, got %d", m.session.ServerSalt)
+	}
+	if len(m.futureSalts) != 2 {
+		t.Errorf("expired salt was not removed: %#v", m.futureSalts)
+	}
+	if m.futureSaltsRequested {
+		t.Errorf("future salts should not be requested yet")
+	}
+}
@@ -74,6 +74,11 @@ func (c Combinator) structName() string {
 	return "TL_" + normalize(c.id)
 }
 
+// unionInterfaceName returns name of interface implemented by all constructors of typeName.
+func unionInterfaceName(typeName string) string {
+	return "TL_" + normalize(typeName)
+}
+
 func findConstructorIDs(combinators []*Combinator, fieldType string) []string {
 	var constructorIDs []string
 	for _, comb := range combinators {
@@ -84,6 +89,12 @@ func findConstructorIDs(combinators []*Combinator, fieldType string) []string {
 	return constructorIDs
 }
 
+// isSingleConstructor checks if c is the only constructor of its type.
+// Fields of such types have exact Go types and are decoded with decode_into_* functions.
+func isSingleConstructor(combinators []*Combinator, c *Combinator) bool {
+	return !c.isFunction && len(findConstructorIDs(combinators, c.typeName)) == 1
+}
+
 func parseVectorType(typeName string) (string, int, bool) {
 	nesting := 0
 	for strings.HasPrefix(typeName, "Vector<") || strings.HasPrefix(typeName, "vector<") {
@@ -425,6 +436,8 @@ func main() {
 	// constants
 	write(`package mtproto
 import (
+	"reflect"
+
 	"github.com/ansel1/merry/v2"
 )
 `)
@@ -502,6 +515,87 @@ import (
 		write("}\n\n")
 	}
 
+	// union type interfaces: implemented by all constructors of a type (if there are several of them)
+	structNames := make(map[string]bool, len(combinators))
+	for _, c := range combinators {
+		structNames[c.structName()] = true
+	}
+	unionTypes := make(map[string]bool)
+	for _, c := range combinators {
+		if c.isFunction || unionTypes[c.typeName] {
+			continue
+		}
+		constructorIDs := findConstructorIDs(combinators, c.typeName)
+		if len(constructorIDs) < 2 {
+			continue
+		}
+		unionTypes[c.typeName] = true
+		ifaceName := unionInterfaceName(c.typeName)
+		if structNames[ifaceName] {
+			log.Fatalf("interface name %s for type %s conflicts with constructor", ifaceName, c.typeName)
+		}
+		write("// %s is implemented by %s constructors: %s\n", ifaceName, c.typeName, strings.Join(constructorIDs, " | "))
+		write("type %s interface {\n", ifaceName)
+		write("TL\n")
+		write("is%s()\n", ifaceName)
+		write("}\n\n")
+		for _, id := range constructorIDs {
+			write("func (%s) is%s() {}\n", id, ifaceName)
+		}
+		write("\n")
+	}
+
+	// flag bits, raw flags values and Has...() accessors of flagged fields
+	for _, c := range combinators {
+		flagNames := c.flagFieldNames()
+		if len(flagNames) == 0 {
+			continue
+		}
+		fieldNames := make(map[string]bool, len(c.fields))
+		for _, t := range c.fields {
+			if t.typeName != "#" {
+				fieldNames[normalizeFieldName(t.name)] = true
+			}
+		}
+
+		write("const (\n")
+		for _, t := range c.fields {
+			if t.flag != nil {
+				write("%s_%s_%s = 1 << %d\n", c.structName(), normalizeFieldName(t.flag.fieldName), normalizeFieldName(t.name), t.flag.bit)
+			}
+		}
+		write(")\n\n")
+		for _, flagName := range flagNames {
+			write("// %s returns %s value with bits of present fields set (see %s_%s_* constants)\n",
+				normalizeFieldName(flagName), flagName, c.structName(), normalizeFieldName(flagName))
+			if fieldNames[normalizeFieldName(flagName)] {
+				log.Fatalf("method name %s conflicts with field of %s", normalizeFieldName(flagName), c.structName())
+			}
+			write("func (e %s) %s() int32 {\n", c.structName(), normalizeFieldName(flagName))
+			write("var flags int32\n")
+			for _, t := range c.fields {
+				if t.flag != nil && t.flag.fieldName == flagName {
+					write("if %s {flags |= %s_%s_%s}\n", flaggedValueCheck(t.typeName, "e."+normalizeFieldName(t.name)),
+						c.structName(), normalizeFieldName(flagName), normalizeFieldName(t.name))
+				}
+			}
+			write("return flags\n")
+			write("}\n\n")
+		}
+		for _, t := range c.fields {
+			if t.flag != nil {
+				fieldName := normalizeFieldName(t.name)
+				if fieldNames["Has"+fieldName] {
+					// like has_url:flags.3?true next to url:flags.2?string, accessor would conflict with the field
+					log.Printf("WARN: no Has%s() for %s: conflicts with field", fieldName, c.structName())
+					continue
+				}
+				write("func (e %s) Has%s() bool { return %s }\n", c.structName(), fieldName, flaggedValueCheck(t.typeName, "e."+fieldName))
+			}
+		}
+		write("\n")
+	}
+
 	// encode funcs
 	for _, c := range combinators {
 		write("func (e %s) encode() []byte {\n", c.structName())
@@ -582,6 +676,17 @@ import (
 		}
 	}
 
+	// JSON funcs, see tl_json.go
+	for _, c := range combinators {
+		write("func (e %s) MarshalJSON() ([]byte, error) { return marshalTLJSON(%q, e) }\n", c.structName(), c.id)
+		write("func (e *%s) UnmarshalJSON(data []byte) error { return unmarshalTLJSON(data, %q, e) }\n\n", c.structName(), c.id)
+	}
+	write("var tlJSONTypes = map[string]reflect.Type{\n")
+	for _, c := range combinators {
+		write("%q: reflect.TypeOf(%s{}),\n", c.id, c.structName())
+	}
+	write("}\n\n")
+
 	// decode funcs
 	for _, c := range combinators {
 		if c.isFunction {
@@ -599,6 +704,19 @@ import (
 		}
 		write("func decode_body_%s(%s *DecodeBuf) TL {\n", c.structName(), dbufArgName) //TL as return type is intended, see ObjectGenerated comment below
 		write("tl := %s{}\n", c.structName())
+		if isSingleConstructor(combinators, c) {
+			// fields of such types are decoded right into parent structs (and slices), without allocating them as TL
+			if len(c.fields) > 0 {
+				write("decode_into_%s(m, &tl)\n", c.structName())
+			}
+			write("return tl\n")
+			write("}\n\n")
+			if len(c.fields) == 0 {
+				write("func decode_into_%s(_ *DecodeBuf, _ *%s) {}\n\n", c.structName(), c.structName())
+				continue
+			}
+			write("func decode_into_%s(m *DecodeBuf, tl *%s) {\n", c.structName(), c.structName())
+		}
 		for _, t := range c.fields {
 			fieldName := normalizeFieldName(t.name)
 			if t.flag != nil && t.typeName != "true" {
@@ -631,20 +749,21 @@ import (
 				if vecNesting == 1 {
 					read := "m.Vector()"
 					if typ != "TL" {
-						read = fmt.Sprintf("DecodeBuf_GenericVector[%s](m)", typ)
+						read = fmt.Sprintf("decodeVectorInto(m, CRC_%s, %s)", typ[len("TL_"):], "decode_into_"+typ)
 					}
 					write("tl.%s = %s\n", fieldName, read)
 				} else if vecNesting == 2 {
 					write("tl.%s = m.Vector2d()\n", fieldName)
-				} else {
-					read := "m.Object()"
-					if typ != "TL" {
-						read = fmt.Sprintf("decode_%s(m).(%s)", typ, typ)
-					}
-					if len(constructorIDs) == 1 && vecNesting == 0 && t.flag != nil {
-						read = "Ref(" + read + ")"
+				} else if typ != "TL" {
+					dest := "&tl." + fieldName
+					if t.flag != nil {
+						write("tl.%s = new(%s)\n", fieldName, typ)
+						dest = "tl." + fieldName
 					}
-					write("tl.%s = %s\n", fieldName, read)
+					write("m.constructorAssert(CRC_%s)\n", typ[len("TL_"):])
+					write("%s(m, %s)\n", "decode_into_"+typ, dest)
+				} else {
+					write("tl.%s = m.Object()\n", fieldName)
 				}
 			}
 
@@ -652,7 +771,9 @@ import (
 				write("}\n")
 			}
 		}
-		write("return tl\n")
+		if !isSingleConstructor(combinators, c) {
+			write("return tl\n")
+		}
 		write("}\n\n")
 	}
 
@@ -0,0 +1,81 @@
+package mtproto
+
+import "context"
+
+// Outgoing packets are sent from three lanes, in order of priority:
+// service messages (acks, pings, pongs, etc.), interactive requests, bulk requests (file parts).
+// So acks and regular requests are not stuck behind a long file upload/download.
+
+// isServicePacket checks if message is MTProto service message that should be sent ASAP.
+func isServicePacket(msg TL) bool {
+	switch msg.(type) {
+	case TL_msgsACK, TL_ping, TL_pingDelayDisconnect, TL_pong, TL_rpcDropAnswer:
+		return true
+	}
+	return false
+}
+
+// isBulkRequest checks if request is a part of (potentially large) file transfer.
+func isBulkRequest(msg TL) bool {
+	if wrapper, ok := msg.(TL_invokeWithoutUpdates); ok {
+		msg = wrapper.Query
+	}
+	switch msg.(type) {
+	case TL_upload_saveFilePart, TL_upload_saveBigFilePart, TL_upload_getFile, TL_upload_getCDNFile:
+		return true
+	}
+	return false
+}
+
+// enqueue puts packet into internal send queue lane according to its priority.
+func (m *MTProto) enqueue(packet *packetToSend) {
+	switch {
+	case isServicePacket(packet.msg):
+		m.serviceSendQueue <- packet
+	case isBulkRequest(packet.msg):
+		m.bulkSendQueue <- packet
+	default:
+		m.sendQueue <- packet
+	}
+}
+
+// nextPacket waits for the next packet to send (taking lanes priority into account).
+// Returns nil when ctx is done.
+func (m *MTProto) nextPacket(ctx context.Context) *packetToSend {
+	if x := m.pollPacket(); x != nil {
+		return x
+	}
+	select {
+	case <-ctx.Done():
+		return nil
+	case x := <-m.serviceSendQueue:
+		return x
+	case x := <-m.sendQueue:
+		m.releaseQueueSlot(x)
+		return x
+	case x := <-m.bulkSendQueue:
+		m.releaseQueueSlot(x)
+		return x
+	}
+}
+
+// pollPacket returns packet from the highest priority non-empty lane, nil if all lanes are empty.
+func (m *MTProto) pollPacket() *packetToSend {
+	for _, lane := range []chan *packetToSend{m.serviceSendQueue, m.sendQueue, m.bulkSendQueue} {
+		select {
+		case x := <-lane:
+			m.releaseQueueSlot(x)
+			return x
+		default:
+		}
+	}
+	return nil
+}
+
+// releaseQueueSlot allows queueTransferRoutine to move next external packet to internal queue.
+func (m *MTProto) releaseQueueSlot(packet *packetToSend) {
+	if packet.holdsQueueSlot {
+		packet.holdsQueueSlot = false
+		<-m.queueSlots
+	}
+}
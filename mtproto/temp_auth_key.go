@@ -0,0 +1,185 @@
+package mtproto
+
+import (
+	cryptoRand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"time"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// DefaultTempAuthKeyTTL is a recommended lifetime of temporary auth keys, see SetTempAuthKeyTTL.
+const DefaultTempAuthKeyTTL = 24 * time.Hour
+
+// tempAuthKey is a temporary auth key bound to the permanent one (perfect forward secrecy).
+// It is kept only in memory, so a leaked session file can not be used to decrypt previous traffic.
+// https://core.telegram.org/api/pfs
+type tempAuthKey struct {
+	key       []byte
+	keyHash   []byte
+	dcID      int32
+	expiresAt time.Time
+}
+
+// SetTempAuthKeyTTL enables (or disables if ttl is zero) perfect forward secrecy:
+// messages are encrypted with temporary auth keys (bound to the permanent one) which
+// are replaced by new ones before ttl ends. Should be set before the connection.
+func (m *MTProto) SetTempAuthKeyTTL(ttl time.Duration) {
+	m.tempAuthKeyTTL = ttl
+}
+
+// activeAuthKey returns key (and its hash) messages are encrypted with:
+// temporary one if it is in use, permanent otherwise.
+func (m *MTProto) activeAuthKey() ([]byte, []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.tempKey != nil {
+		return m.tempKey.key, m.tempKey.keyHash
+	}
+	return m.session.AuthKey, m.session.AuthKeyHash
+}
+
+// dropTempAuthKey forgets temporary key (new one will be created on next connection).
+// Returns false if there was no key.
+func (m *MTProto) dropTempAuthKey() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	hadKey := m.tempKey != nil
+	m.tempKey = nil
+	return hadKey
+}
+
+// tempAuthKeyExpiring returns true if temporary key is used and should be replaced soon
+// (less than 10% of its lifetime is left).
+func (m *MTProto) tempAuthKeyExpiring() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.tempKey != nil && time.Until(m.tempKey.expiresAt) < m.tempAuthKeyTTL/10
+}
+
+// prepareTempAuthKey creates and binds new temporary key if PFS is enabled
+// and current key is missing, is for other DC or is about to expire.
+// Permanent key must be ready.
+func (m *MTProto) prepareTempAuthKey() error {
+	if m.tempAuthKeyTTL <= 0 {
+		m.dropTempAuthKey()
+		return nil
+	}
+	m.mutex.Lock()
+	isValid := m.tempKey != nil && m.tempKey.dcID == m.session.DCID
+	m.mutex.Unlock()
+	if isValid && !m.tempAuthKeyExpiring() {
+		return nil
+	}
+	m.dropTempAuthKey()
+
+	m.log.Debug("connecting: creating temporary auth key...")
+	expiresIn := int32(m.tempAuthKeyTTL / time.Second)
+	m.encryptionReady = false // DH exchange is not encrypted
+	key, serverSalt, err := m.exchangeAuthKey(expiresIn)
+	m.encryptionReady = true
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	expiresAt := time.Now().Add(m.TimeOffset()).Unix() + int64(expiresIn)
+
+	m.mutex.Lock()
+	m.tempKey = &tempAuthKey{
+		key:       key,
+		keyHash:   sha1(key)[12:20],
+		dcID:      m.session.DCID,
+		expiresAt: time.Now().Add(m.tempAuthKeyTTL),
+	}
+	// new key means new server session
+	m.session.sessionId = rand.Int63()
+	m.lastOutSeqNo = 0
+	m.mutex.Unlock()
+	m.session.ServerSalt = serverSalt
+	m.dropFutureSalts()
+
+	if err := m.bindTempAuthKey(int32(expiresAt)); err != nil {
+		m.dropTempAuthKey()
+		return merry.Wrap(err)
+	}
+	return nil
+}
+
+// bindTempAuthKey binds temporary key to the permanent one with auth.bindTempAuthKey.
+// https://core.telegram.org/method/auth.bindTempAuthKey
+func (m *MTProto) bindTempAuthKey(expiresAt int32) error {
+	_, tempKeyHash := m.activeAuthKey()
+	permKeyID := int64(binary.LittleEndian.Uint64(m.session.AuthKeyHash))
+	nonceBuf := make([]byte, 8)
+	if _, err := cryptoRand.Read(nonceBuf); err != nil {
+		return merry.Wrap(err)
+	}
+	nonce := int64(binary.LittleEndian.Uint64(nonceBuf))
+
+	// binding message must have the same msg_id as the request
+	m.mutex.Lock()
+	msgID := m.generateMessageId()
+	m.mutex.Unlock()
+
+	inner := TL_bindAuthKeyInner{
+		Nonce:         nonce,
+		TempAuthKeyID: int64(binary.LittleEndian.Uint64(tempKeyHash)),
+		PermAuthKeyID: permKeyID,
+		TempSessionID: m.session.sessionId,
+		ExpiresAt:     expiresAt,
+	}
+	encrypted, err := encryptV1(m.session.AuthKey, m.session.AuthKeyHash, msgID, inner.encode())
+	if err != nil {
+		return merry.Wrap(err)
+	}
+
+	packet := newPacket(TL_auth_bindTempAuthKey{
+		PermAuthKeyID:    permKeyID,
+		Nonce:            nonce,
+		ExpiresAt:        expiresAt,
+		EncryptedMessage: encrypted,
+	}, make(chan TL, 1))
+	packet.msgID = msgID
+	res, err := m.sendPacketAndReadDirect(packet)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if _, ok := res.(TL_boolTrue); !ok {
+		return WrongRespError(res)
+	}
+	m.log.Info("temporary auth key is bound, expires at %s", time.Unix(int64(expiresAt), 0))
+	return nil
+}
+
+// encryptV1 encrypts message with MTProto 1.0 scheme (used only for binding message).
+// Random bytes are used instead of salt and session_id, seq_no is 0.
+func encryptV1(authKey, authKeyHash []byte, msgID int64, obj []byte) ([]byte, error) {
+	random := make([]byte, 16)
+	if _, err := cryptoRand.Read(random); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	z := NewEncodeBuf(32 + len(obj))
+	z.Bytes(random)
+	z.Long(msgID)
+	z.Int(0)
+	z.Int(int32(len(obj)))
+	z.Bytes(obj)
+
+	msgKey := sha1(z.buf)[4:20]
+	aesKey, aesIV := generateAESv1(msgKey, authKey, false)
+
+	padding := make([]byte, (16-(len(z.buf)%16))&15)
+	if _, err := cryptoRand.Read(padding); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	encryptedData, err := doAES256IGEencrypt(append(z.buf, padding...), aesKey, aesIV)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	x := NewEncodeBuf(24 + len(encryptedData))
+	x.Bytes(authKeyHash)
+	x.Bytes(msgKey)
+	x.Bytes(encryptedData)
+	return x.buf, nil
+}
@@ -0,0 +1,21 @@
+package mtproto
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// TimeOffset returns correction of the local clock (server time - local time)
+// applied to generated message IDs. It is updated on connection and when server
+// rejects msg_id as too low or too high (bad_msg_notification codes 16 and 17).
+func (m *MTProto) TimeOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.outMsgIDTimeOffsetSec)) * time.Second
+}
+
+// syncTimeFromMsgID updates time offset using server message ID (which contains server unixtime).
+func (m *MTProto) syncTimeFromMsgID(serverMsgID int64) {
+	offset := (serverMsgID >> 32) - time.Now().Unix()
+	if prev := atomic.SwapInt64(&m.outMsgIDTimeOffsetSec, offset); prev != offset {
+		m.log.Info("client time seems inaccurate, time offset changed: %ds -> %ds", prev, offset)
+	}
+}
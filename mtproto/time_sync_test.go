@@ -0,0 +1,40 @@
+package mtproto
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBadMsgTimeResend(t *testing.T) {
+	m := &MTProto{
+		mutex:         &sync.Mutex{},
+		msgsByID:      newPendingPackets(),
+		containerMsgs: map[int64][]int64{},
+		sendQueue:     make(chan *packetToSend, 1),
+		log:           Logger{Hnd: NoopLogHandler{}},
+	}
+	resp := make(chan TL, 1)
+	packet := &packetToSend{msgID: 100, msg: TL_help_getConfig{}, resp: resp}
+	m.msgsByID.add(packet)
+
+	serverMsgID := (time.Now().Unix() + 3600) << 32
+	for i := 0; i < maxResends; i++ {
+		m.process(serverMsgID, 0, TL_badMsgNotification{BadMsgID: packet.msgID, ErrorCode: 16}, true)
+		resent := <-m.sendQueue
+		if resent != packet || packet.msgID != 0 {
+			t.Fatalf("packet was not resent with new ID")
+		}
+		packet.msgID = int64(200 + i)
+		m.msgsByID.add(packet)
+	}
+	if offset := m.TimeOffset(); offset < 3599*time.Second || offset > 3601*time.Second {
+		t.Errorf("wrong time offset: %s", offset)
+	}
+
+	// too many retries, error should be passed to the caller
+	m.process(serverMsgID, 0, TL_badMsgNotification{BadMsgID: packet.msgID, ErrorCode: 16}, true)
+	if res, ok := (<-resp).(TL_badMsgNotification); !ok || res.ErrorCode != 16 {
+		t.Errorf("expected bad msg notification, got %#v", res)
+	}
+}
@@ -15,4 +15,5 @@ const (
 	TL_ErrNotFound     = int32(404)
 	TL_ErrFlood        = int32(420)
 	TL_ErrInterbal     = int32(500)
+	TL_ErrTimeout      = int32(-503)
 )
@@ -6,8 +6,10 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
+	"sync"
 
 	"github.com/ansel1/merry/v2"
 )
@@ -218,11 +220,8 @@ func (m *DecodeBuf) BigInt() *big.Int {
 	if m.err != nil {
 		return nil
 	}
-	y := make([]byte, len(b)+1)
-	y[0] = 0
-	copy(y[1:], b)
-	x := new(big.Int).SetBytes(y)
-	return x
+	// SetBytes copies the bytes (treating them as unsigned), so no intermediate copy is needed
+	return new(big.Int).SetBytes(b)
 }
 
 func (m *DecodeBuf) VectorInt() []int32 {
@@ -322,6 +321,26 @@ func DecodeBuf_GenericVector[T TL](m *DecodeBuf) []T {
 	return x
 }
 
+// decodeVectorInto decodes vector of objects with single possible constructor:
+// items are decoded right into the slice (without allocating each one as TL).
+func decodeVectorInto[T TL](m *DecodeBuf, constructor uint32, decodeInto func(*DecodeBuf, *T)) []T {
+	size := m.vectorHeader("DecodeVector")
+	if m.err != nil {
+		return nil
+	}
+	x := make([]T, size)
+	for i := range x {
+		objStartOffset := m.off
+		m.constructorAssert(constructor)
+		decodeInto(m, &x[i])
+		if m.err != nil {
+			m.pushToErrBufStack(objStartOffset, constructor)
+			return nil
+		}
+	}
+	return x
+}
+
 func (m *DecodeBuf) Vector() []TL {
 	size := m.vectorHeader("DecodeVector")
 	if m.err != nil {
@@ -407,6 +426,11 @@ func (m *DecodeBuf) vectorHeader(errLabel string) int32 {
 		m.err = merry.Errorf("%s: negative size: %d", errLabel, size)
 		return 0
 	}
+	// each item takes at least 4 bytes, so broken size will not cause huge allocation
+	if int(size) > (m.size-m.off)/4 {
+		m.err = notEnoughBytesErr(errLabel, m.off, int(size)*4, m.size)
+		return 0
+	}
 	return size
 }
 
@@ -490,11 +514,23 @@ func (m *MTProto) decodeMessage(dbuf *DecodeBuf, reqMsg TLReq) (r TL) {
 		}
 		r = TL_msgContainer{arr}
 
+	case CRC_futureSalts:
+		// salts:vector<future_salt> is a bare vector of bare objects, so it is decoded here
+		res := TL_futureSalts{ReqMsgID: dbuf.Long(), Now: dbuf.Int()}
+		size := dbuf.Int()
+		if size < 0 {
+			dbuf.err = merry.Errorf("future_salts: negative size: %d", size)
+			return nil
+		}
+		res.Salts = make([]TL, size)
+		for i := int32(0); i < size; i++ {
+			res.Salts[i] = TL_futureSalt{ValidSince: dbuf.Int(), ValidUntil: dbuf.Int(), Salt: dbuf.Long()}
+		}
+		r = res
+
 	case CRC_rpc_result:
 		requestID := dbuf.Long()
-		m.mutex.Lock()
-		packet, ok := m.msgsByID[requestID]
-		m.mutex.Unlock()
+		packet, ok := m.msgsByID.get(requestID)
 		if ok {
 			if req, ok := packet.msg.(TLReq); ok {
 				//r = req.decodeResponse(dbuf)
@@ -510,23 +546,19 @@ func (m *MTProto) decodeMessage(dbuf *DecodeBuf, reqMsg TLReq) (r TL) {
 		r = TL_rpcResult{requestID, r}
 
 	case CRC_gzip_packed:
-		obj := make([]byte, 0, 4096)
-
-		var buf bytes.Buffer
-		_, _ = buf.Write(dbuf.stringBytesNoCopy())
-		gz, _ := gzip.NewReader(&buf)
-
-		b := make([]byte, 4096)
-		for {
-			n, _ := gz.Read(b)
-			obj = append(obj, b[0:n]...)
-			if n <= 0 {
-				break
-			}
+		packed := dbuf.stringBytesNoCopy()
+		if dbuf.err != nil {
+			break
+		}
+		obj, err := gunzip(packed)
+		if err != nil {
+			dbuf.err = merry.Wrap(err, merry.AppendMessage("gzip_packed"))
+			break
 		}
 		d := NewDecodeBuf(obj)
 		r = m.decodeMessage(d, reqMsg)
 		dbuf.err = d.err
+		putBuf(obj) // decoded objects do not reference it
 
 	default:
 		dbuf.SeekBack(4) //returning constructor ID
@@ -542,3 +574,34 @@ func (m *MTProto) decodeMessage(dbuf *DecodeBuf, reqMsg TLReq) (r TL) {
 	}
 	return r
 }
+
+// unpacked gzip_packed objects larger than this are considered broken
+const maxGzipUnpackedSize = 16 * 1024 * 1024
+
+var gzipReaders sync.Pool
+
+// gunzip unpacks data into a pooled buffer (it may be released with putBuf after decoding).
+func gunzip(packed []byte) ([]byte, error) {
+	var gz *gzip.Reader
+	var err error
+	if pooled, ok := gzipReaders.Get().(*gzip.Reader); ok {
+		gz = pooled
+		err = gz.Reset(bytes.NewReader(packed))
+	} else {
+		gz, err = gzip.NewReader(bytes.NewReader(packed))
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	defer gzipReaders.Put(gz)
+
+	buf := bytes.NewBuffer(getBuf(len(packed) * 4))
+	n, err := buf.ReadFrom(io.LimitReader(gz, maxGzipUnpackedSize+1))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if n > maxGzipUnpackedSize {
+		return nil, merry.Errorf("unpacked data is too large: more than %d bytes", maxGzipUnpackedSize)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,118 @@
+package mtproto
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testMessagesResponse() TL_messages_messages {
+	var res TL_messages_messages
+	for i := int32(0); i < 50; i++ {
+		res.Messages = append(res.Messages, TL_message{
+			ID:      i,
+			PeerID:  TL_peerUser{UserID: 1},
+			Date:    1700000000 + i,
+			Message: "some message text",
+			FwdFrom: &TL_messageFwdHeader{FromName: Ref("someone"), Date: 1600000000},
+			Replies: &TL_messageReplies{Replies: 3, RepliesPTS: 10},
+			Reactions: &TL_messageReactions{Results: []TL_reactionCount{
+				{Reaction: TL_reactionEmoji{Emoticon: "👍"}, Count: 5},
+				{Reaction: TL_reactionEmoji{Emoticon: "🔥"}, Count: 2},
+			}},
+		})
+		res.Users = append(res.Users, TL_user{
+			ID:        int64(i),
+			FirstName: Ref("Name"),
+			Usernames: []TL_username{{Username: "first", Active: true}, {Username: "second"}},
+		})
+	}
+	return res
+}
+
+func TestDecodeSingleConstructorFields(t *testing.T) {
+	buf := testMessagesResponse().encode()
+	dbuf := NewDecodeBuf(buf)
+	decoded := dbuf.Object()
+	if dbuf.err != nil {
+		t.Fatal(dbuf.err)
+	}
+	if !bytes.Equal(decoded.encode(), buf) {
+		t.Fatalf("decoded object differs from the original: %#v", decoded)
+	}
+	user := decoded.(TL_messages_messages).Users[0].(TL_user)
+	if len(user.Usernames) != 2 || user.Usernames[1].Username != "second" {
+		t.Fatalf("wrong usernames: %#v", user.Usernames)
+	}
+}
+
+func TestDecodeVectorBrokenSize(t *testing.T) {
+	x := NewEncodeBuf(16)
+	x.UInt(CRC_vector)
+	x.Int(1 << 30)
+	dbuf := NewDecodeBuf(x.buf)
+	if dbuf.Vector() != nil || dbuf.err == nil {
+		t.Fatalf("expected error for broken vector size")
+	}
+}
+
+func BenchmarkDecodeMessages(b *testing.B) {
+	buf := testMessagesResponse().encode()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	for i := 0; i < b.N; i++ {
+		dbuf := NewDecodeBuf(buf)
+		dbuf.Object()
+		if dbuf.err != nil {
+			b.Fatal(dbuf.err)
+		}
+	}
+}
+
+func TestDecodeBrokenGzip(t *testing.T) {
+	obj := TL_dataJSON{Data: strings.Repeat(`{"key":"value"}`, 200)}
+	packed := gzipPackIfSmaller(obj.encode())
+	m := &MTProto{mutex: &sync.Mutex{}, msgsByID: newPendingPackets()}
+
+	// truncated compressed data
+	x := NewEncodeBuf(len(packed))
+	x.UInt(CRC_gzip_packed)
+	x.StringBytes(NewDecodeBuf(packed[4:]).StringBytes()[:30])
+	dbuf := NewDecodeBuf(x.buf)
+	if res := m.decodeMessage(dbuf, nil); res != nil || dbuf.err == nil {
+		t.Fatalf("expected error, got %#v", res)
+	}
+
+	// valid data after the broken one (reusing pooled reader)
+	dbuf = NewDecodeBuf(packed)
+	if res := m.decodeMessage(dbuf, nil); !reflect.DeepEqual(res, obj) {
+		t.Fatalf("wrong unpacked object: %#v (%v)", res, dbuf.err)
+	}
+}
+
+func TestUnionInterfaces(t *testing.T) {
+	var peer TL_InputPeer = TL_inputPeerUser{UserID: 1, AccessHash: 2}
+	obj := NewDecodeBuf(peer.encode()).Object()
+	if _, ok := obj.(TL_InputPeer); !ok {
+		t.Errorf("decoded %T does not implement TL_InputPeer", obj)
+	}
+	if _, ok := obj.(TL_Peer); ok {
+		t.Errorf("decoded %T should not implement TL_Peer", obj)
+	}
+}
+
+func TestFlagsAccessors(t *testing.T) {
+	msg := TL_message{Out: true, ID: 1, PeerID: TL_peerUser{UserID: 1}, TTLPeriod: Ref(int32(60))}
+	if !msg.HasOut() || !msg.HasTTLPeriod() || msg.HasReplyTo() {
+		t.Errorf("wrong Has...() results")
+	}
+	if flags := msg.Flags(); flags != TL_message_Flags_Out|TL_message_Flags_TTLPeriod {
+		t.Errorf("wrong flags: %b", flags)
+	}
+	// flags are encoded right after constructor ID
+	if encoded := NewDecodeBuf(msg.encode()[4:]).Int(); encoded != msg.Flags() {
+		t.Errorf("flags mismatch: encoded %b, got %b", encoded, msg.Flags())
+	}
+}
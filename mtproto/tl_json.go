@@ -0,0 +1,144 @@
+package mtproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// TL objects are marshaled to JSON as objects with exported fields and constructor name in "_" field:
+//
+//	{"_":"peerUser","UserID":123}
+//
+// Fields of TL interface type are marshaled the same way, so any generated object
+// may be restored with UnmarshalTLJSON.
+
+const tlJSONNameField = "_"
+
+var tlInterfaceType = reflect.TypeOf((*TL)(nil)).Elem()
+
+// UnmarshalTLJSON restores TL object of any generated type marshaled with json.Marshal.
+// Returns nil object (without error) for JSON null.
+func UnmarshalTLJSON(data []byte) (TL, error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, nil
+	}
+	var header struct {
+		Name *string `json:"_"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if header.Name == nil {
+		return nil, merry.Errorf("TL object without %q constructor name field", tlJSONNameField)
+	}
+	typ, ok := tlJSONTypes[*header.Name]
+	if !ok {
+		return nil, merry.Errorf("unknown TL constructor name %q", *header.Name)
+	}
+	obj := reflect.New(typ)
+	if err := json.Unmarshal(data, obj.Interface()); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return obj.Elem().Interface().(TL), nil
+}
+
+// marshalTLJSON marshals obj fields one by one after its constructor name (as "_" field).
+func marshalTLJSON(name string, obj any) ([]byte, error) {
+	var buf bytes.Buffer
+	nameJSON, _ := json.Marshal(name)
+	buf.WriteString(`{"` + tlJSONNameField + `":`)
+	buf.Write(nameJSON)
+
+	val := reflect.ValueOf(obj)
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldJSON, err := json.Marshal(val.Field(i).Interface())
+		if err != nil {
+			return nil, merry.Prependf(err, "%s.%s", val.Type().Name(), field.Name)
+		}
+		keyJSON, _ := json.Marshal(field.Name)
+		buf.WriteByte(',')
+		buf.Write(keyJSON)
+		buf.WriteByte(':')
+		buf.Write(fieldJSON)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// unmarshalTLJSON fills fields of obj (pointer to struct) from JSON object,
+// TL interface fields are restored by their "_" constructor names.
+func unmarshalTLJSON(data []byte, name string, obj any) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return merry.Wrap(err)
+	}
+	if rawName, ok := fields[tlJSONNameField]; ok {
+		var gotName string
+		if err := json.Unmarshal(rawName, &gotName); err != nil {
+			return merry.Wrap(err)
+		}
+		if gotName != name {
+			return merry.Errorf("unexpected TL constructor name %q, expected %q", gotName, name)
+		}
+	}
+
+	val := reflect.ValueOf(obj).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		raw, ok := fields[field.Name]
+		if !ok || !field.IsExported() {
+			continue
+		}
+		if err := unmarshalTLJSONValue(raw, val.Field(i)); err != nil {
+			return merry.Prependf(err, "%s.%s", val.Type().Name(), field.Name)
+		}
+	}
+	return nil
+}
+
+func unmarshalTLJSONValue(raw json.RawMessage, val reflect.Value) error {
+	switch {
+	case val.Type() == tlInterfaceType:
+		obj, err := UnmarshalTLJSON(raw)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		if obj != nil {
+			val.Set(reflect.ValueOf(obj))
+		}
+		return nil
+	case val.Kind() == reflect.Slice && containsTLInterface(val.Type()):
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return merry.Wrap(err)
+		}
+		if items == nil {
+			return nil
+		}
+		slice := reflect.MakeSlice(val.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := unmarshalTLJSONValue(item, slice.Index(i)); err != nil {
+				return merry.Wrap(err)
+			}
+		}
+		val.Set(slice)
+		return nil
+	default:
+		return merry.Wrap(json.Unmarshal(raw, val.Addr().Interface()))
+	}
+}
+
+// containsTLInterface returns true for TL, []TL, [][]TL, etc.
+func containsTLInterface(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	return typ == tlInterfaceType
+}
@@ -0,0 +1,63 @@
+package mtproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTLJSONRoundtrip(t *testing.T) {
+	msg := TL_message{
+		Out:      true,
+		ID:       42,
+		FromID:   TL_peerUser{UserID: 1},
+		PeerID:   TL_peerChannel{ChannelID: 2},
+		Date:     1700000000,
+		Message:  "hello",
+		Views:    Ref(int32(10)),
+		Entities: []TL{TL_messageEntityBold{Offset: 0, Length: 5}},
+		ReplyMarkup: TL_replyInlineMarkup{Rows: []TL_keyboardButtonRow{{
+			Buttons: []TL{TL_keyboardButtonCallback{Text: "ok", Data: []byte{1, 2, 3}}},
+		}}},
+		RestrictionReason: []TL_restrictionReason{{Platform: "all", Reason: "r", Text: "t"}},
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `{"_":"message","Out":true,`) {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+
+	obj, err := UnmarshalTLJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(obj.encode(), msg.encode()) {
+		t.Errorf("restored object differs:\n%#v\n%#v", obj, msg)
+	}
+
+	var typed TL_message
+	if err := json.Unmarshal(data, &typed); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(typed.encode(), msg.encode()) {
+		t.Errorf("restored object differs:\n%#v\n%#v", typed, msg)
+	}
+}
+
+func TestTLJSONErrors(t *testing.T) {
+	if obj, err := UnmarshalTLJSON([]byte("null")); obj != nil || err != nil {
+		t.Errorf("expected nil for null, got %#v, %v", obj, err)
+	}
+	for _, data := range []string{`{"ID":1}`, `{"_":"noSuchConstructor"}`, `{"_":"message","ID":"1"}`} {
+		if _, err := UnmarshalTLJSON([]byte(data)); err == nil {
+			t.Errorf("%s: expected error", data)
+		}
+	}
+	var peer TL_peerUser
+	if err := json.Unmarshal([]byte(`{"_":"peerChat","ChatID":1}`), &peer); err == nil {
+		t.Errorf("expected constructor name mismatch error")
+	}
+}
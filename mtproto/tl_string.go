@@ -0,0 +1,118 @@
+package mtproto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// bytes fields longer than this are truncated in TLString output
+const tlStringMaxBytes = 32
+
+// TLString returns indented human-readable dump of TL object with all nested objects, like
+//
+//	TL_message{
+//	  ID: 42
+//	  PeerID: TL_peerUser{
+//	    UserID: 1
+//	  }
+//	  Entities: [
+//	    TL_messageEntityBold{
+//	      Offset: 0
+//	      Length: 5
+//	    }
+//	  ]
+//	}
+//
+// Absent optional fields are omitted, bytes are printed as length and (truncated) hex.
+// Intended for debugging, output format may change.
+func TLString(obj TL) string {
+	var sb strings.Builder
+	writeTLString(&sb, reflect.ValueOf(obj), 0)
+	return sb.String()
+}
+
+func writeTLString(sb *strings.Builder, val reflect.Value, depth int) {
+	if !val.IsValid() {
+		sb.WriteString("nil")
+		return
+	}
+	switch val.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if val.IsNil() {
+			sb.WriteString("nil")
+			return
+		}
+		writeTLString(sb, val.Elem(), depth)
+	case reflect.Struct:
+		sb.WriteString(val.Type().Name())
+		sb.WriteByte('{')
+		hasFields := false
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Type().Field(i)
+			fieldVal := val.Field(i)
+			if !field.IsExported() || isAbsentTLField(fieldVal) {
+				continue
+			}
+			hasFields = true
+			writeTLStringIndent(sb, depth+1)
+			sb.WriteString(field.Name)
+			sb.WriteString(": ")
+			writeTLString(sb, fieldVal, depth+1)
+		}
+		if hasFields {
+			writeTLStringIndent(sb, depth)
+		}
+		sb.WriteByte('}')
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			writeTLStringBytes(sb, val)
+			return
+		}
+		sb.WriteByte('[')
+		for i := 0; i < val.Len(); i++ {
+			writeTLStringIndent(sb, depth+1)
+			writeTLString(sb, val.Index(i), depth+1)
+		}
+		if val.Len() > 0 {
+			writeTLStringIndent(sb, depth)
+		}
+		sb.WriteByte(']')
+	case reflect.String:
+		sb.WriteString(strconv.Quote(val.String()))
+	default:
+		fmt.Fprint(sb, val.Interface())
+	}
+}
+
+func writeTLStringIndent(sb *strings.Builder, depth int) {
+	sb.WriteByte('\n')
+	sb.WriteString(strings.Repeat("  ", depth))
+}
+
+func writeTLStringBytes(sb *strings.Builder, val reflect.Value) {
+	buf := make([]byte, val.Len())
+	reflect.Copy(reflect.ValueOf(buf), val)
+	fmt.Fprintf(sb, "[%d bytes]", len(buf))
+	if len(buf) == 0 {
+		return
+	}
+	sb.WriteByte(' ')
+	if len(buf) > tlStringMaxBytes {
+		sb.WriteString(hex.EncodeToString(buf[:tlStringMaxBytes]))
+		sb.WriteString("...")
+	} else {
+		sb.WriteString(hex.EncodeToString(buf))
+	}
+}
+
+// isAbsentTLField returns true for unset optional fields (nil pointers, interfaces and slices).
+func isAbsentTLField(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Interface, reflect.Pointer, reflect.Slice:
+		return val.IsNil()
+	}
+	return false
+}
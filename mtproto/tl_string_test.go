@@ -0,0 +1,66 @@
+package mtproto
+
+import "testing"
+
+func TestTLString(t *testing.T) {
+	msg := TL_message{
+		ID:       42,
+		PeerID:   TL_peerUser{UserID: 1},
+		Message:  "hi",
+		Views:    Ref(int32(10)),
+		Entities: []TL{TL_messageEntityBold{Offset: 0, Length: 5}},
+		ReplyMarkup: TL_replyInlineMarkup{Rows: []TL_keyboardButtonRow{{
+			Buttons: []TL{TL_keyboardButtonCallback{Text: "ok", Data: make([]byte, 40)}},
+		}}},
+	}
+	expected := `TL_message{
+  Out: false
+  Mentioned: false
+  MediaUnread: false
+  Silent: false
+  Post: false
+  FromScheduled: false
+  Legacy: false
+  EditHide: false
+  Pinned: false
+  Noforwards: false
+  InvertMedia: false
+  Offline: false
+  VideoProcessingPending: false
+  ID: 42
+  PeerID: TL_peerUser{
+    UserID: 1
+  }
+  Date: 0
+  Message: "hi"
+  ReplyMarkup: TL_replyInlineMarkup{
+    Rows: [
+      TL_keyboardButtonRow{
+        Buttons: [
+          TL_keyboardButtonCallback{
+            RequiresPassword: false
+            Text: "ok"
+            Data: [40 bytes] ` + "0000000000000000000000000000000000000000000000000000000000000000..." + `
+          }
+        ]
+      }
+    ]
+  }
+  Entities: [
+    TL_messageEntityBold{
+      Offset: 0
+      Length: 5
+    }
+  ]
+  Views: 10
+}`
+	if s := TLString(msg); s != expected {
+		t.Errorf("unexpected dump:\n%s", s)
+	}
+	if s := TLString(TL_updatesTooLong{}); s != "TL_updatesTooLong{}" {
+		t.Errorf("unexpected dump: %s", s)
+	}
+	if s := TLString(nil); s != "nil" {
+		t.Errorf("unexpected dump: %s", s)
+	}
+}
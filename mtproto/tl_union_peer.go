@@ -0,0 +1,12 @@
+package mtproto
+
+// Peer constructors also implement TL_InputPeer (and TL_peerChannel implements TL_InputChannel),
+// so high-level helpers may accept both peers from received objects (like TL_message.PeerID)
+// and input peers. Such helpers resolve peers to input peers using cached access hashes:
+// peers must not be sent to server in place of input peers as is.
+
+func (TL_peerUser) isTL_InputPeer()    {}
+func (TL_peerChat) isTL_InputPeer()    {}
+func (TL_peerChannel) isTL_InputPeer() {}
+
+func (TL_peerChannel) isTL_InputChannel() {}
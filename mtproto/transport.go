@@ -0,0 +1,244 @@
+package mtproto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// Transport frames MTProto packets in TCP stream.
+// https://core.telegram.org/mtproto/mtproto-transports
+type Transport interface {
+	Name() string
+	// Init sends transport header right after connection is opened.
+	// May return wrapped connection (for example with obfuscation).
+	Init(conn net.Conn) (net.Conn, error)
+	// WritePacket must not retain data: its buffer is reused after the call.
+	WritePacket(w io.Writer, data []byte) error
+	// ReadPacket returns new buffer, it is passed to the buffer pool after decoding.
+	ReadPacket(r io.Reader) ([]byte, error)
+}
+
+// packetBufReader is implemented by transports that can read packet into a reused buffer.
+type packetBufReader interface {
+	ReadPacketTo(r io.Reader, buf []byte) ([]byte, error)
+}
+
+// AbridgedTransport is the default transport: 1 (or 4) byte packet length prefix.
+// https://core.telegram.org/mtproto/mtproto-transports#abridged
+type AbridgedTransport struct{}
+
+func (t AbridgedTransport) Name() string { return "abridged" }
+
+func (t AbridgedTransport) Init(conn net.Conn) (net.Conn, error) {
+	_, err := conn.Write([]byte{0xef})
+	return conn, merry.Wrap(err)
+}
+
+func (t AbridgedTransport) WritePacket(w io.Writer, data []byte) error {
+	size := len(data) / 4
+	var header []byte
+	if size < 127 {
+		header = []byte{byte(size)}
+	} else {
+		header = make([]byte, 4)
+		binary.LittleEndian.PutUint32(header, uint32(size<<8|127))
+	}
+	_, err := w.Write(append(header, data...))
+	return merry.Wrap(err)
+}
+
+func (t AbridgedTransport) ReadPacket(r io.Reader) ([]byte, error) {
+	return t.ReadPacketTo(r, getBuf(0))
+}
+
+// ReadPacketTo is like ReadPacket but reads packet into buf, growing it if needed.
+func (t AbridgedTransport) ReadPacketTo(r io.Reader, buf []byte) ([]byte, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	var size int
+	if b[0] < 127 {
+		size = int(b[0]) << 2
+	} else {
+		if _, err := io.ReadFull(r, b[:3]); err != nil {
+			return nil, merry.Wrap(err)
+		}
+		size = (int(b[0]) | int(b[1])<<8 | int(b[2])<<16) << 2
+	}
+	buf = growBuf(buf, int(size))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return buf, nil
+}
+
+// IntermediateTransport uses 4-byte packet length prefix.
+// https://core.telegram.org/mtproto/mtproto-transports#intermediate
+type IntermediateTransport struct{}
+
+func (t IntermediateTransport) Name() string { return "intermediate" }
+
+func (t IntermediateTransport) Init(conn net.Conn) (net.Conn, error) {
+	_, err := conn.Write([]byte{0xee, 0xee, 0xee, 0xee})
+	return conn, merry.Wrap(err)
+}
+
+func (t IntermediateTransport) WritePacket(w io.Writer, data []byte) error {
+	buf := make([]byte, 4+len(data))
+	binary.LittleEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err := w.Write(buf)
+	return merry.Wrap(err)
+}
+
+func (t IntermediateTransport) ReadPacket(r io.Reader) ([]byte, error) {
+	return t.ReadPacketTo(r, getBuf(0))
+}
+
+// ReadPacketTo is like ReadPacket but reads packet into buf, growing it if needed.
+func (t IntermediateTransport) ReadPacketTo(r io.Reader, buf []byte) ([]byte, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	size := binary.LittleEndian.Uint32(b[:])
+	if size > 16*1024*1024 {
+		return nil, merry.Errorf("intermediate: packet is too large: %d", size)
+	}
+	buf = growBuf(buf, int(size))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return buf, nil
+}
+
+// ObfuscatedTransport wraps abridged or intermediate transport with obfuscation.
+// With Secret it is used to connect to MTProxy.
+// https://core.telegram.org/mtproto/mtproto-transports#transport-obfuscation
+type ObfuscatedTransport struct {
+	Inner  Transport // AbridgedTransport or IntermediateTransport
+	Secret []byte    // (optional) 16-byte MTProxy secret
+	DCID   int16
+}
+
+func (t ObfuscatedTransport) Name() string { return "obfuscated-" + t.Inner.Name() }
+
+func (t ObfuscatedTransport) Init(conn net.Conn) (net.Conn, error) {
+	var tag uint32
+	switch t.Inner.(type) {
+	case AbridgedTransport:
+		tag = 0xefefefef
+	case IntermediateTransport:
+		tag = 0xeeeeeeee
+	default:
+		return nil, merry.Errorf("obfuscation is not supported for %s transport", t.Inner.Name())
+	}
+
+	init := make([]byte, 64)
+	for {
+		if _, err := rand.Read(init); err != nil {
+			return nil, merry.Wrap(err)
+		}
+		first := binary.LittleEndian.Uint32(init)
+		if init[0] != 0xef &&
+			first != 0x44414548 && first != 0x54534f50 && first != 0x20544547 && // HEAD POST GET_
+			first != 0x4954504f && first != 0x02010316 && first != 0xdddddddd && // OPTI, TLS, padded
+			first != 0xeeeeeeee && binary.LittleEndian.Uint32(init[4:]) != 0 {
+			break
+		}
+	}
+	binary.LittleEndian.PutUint32(init[56:], tag)
+	binary.LittleEndian.PutUint16(init[60:], uint16(t.DCID))
+
+	reversed := make([]byte, 48)
+	for i := 0; i < 48; i++ {
+		reversed[i] = init[55-i]
+	}
+
+	encKey, encIV := init[8:40], init[40:56]
+	decKey, decIV := reversed[:32], reversed[32:48]
+	if len(t.Secret) > 0 {
+		encKey = sha256some(encKey, t.Secret)
+		decKey = sha256some(decKey, t.Secret)
+	}
+
+	encStream, err := newCTRStream(encKey, encIV)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	decStream, err := newCTRStream(decKey, decIV)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	encrypted := make([]byte, 64)
+	encStream.XORKeyStream(encrypted, init)
+	copy(encrypted[:56], init[:56])
+	if _, err := conn.Write(encrypted); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return &obfuscatedConn{Conn: conn, enc: encStream, dec: decStream}, nil
+}
+
+func (t ObfuscatedTransport) WritePacket(w io.Writer, data []byte) error {
+	return t.Inner.WritePacket(w, data)
+}
+
+func (t ObfuscatedTransport) ReadPacket(r io.Reader) ([]byte, error) {
+	return t.Inner.ReadPacket(r)
+}
+
+// ReadPacketTo is like ReadPacket but reads packet into buf if Inner transport supports it.
+func (t ObfuscatedTransport) ReadPacketTo(r io.Reader, buf []byte) ([]byte, error) {
+	if inner, ok := t.Inner.(packetBufReader); ok {
+		return inner.ReadPacketTo(r, buf)
+	}
+	return t.Inner.ReadPacket(r)
+}
+
+// ParseMTProxySecret decodes hex-encoded MTProxy secret.
+// Only simple 16-byte secrets are supported ("dd" and "ee" secrets are not).
+func ParseMTProxySecret(secret string) ([]byte, error) {
+	buf, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if len(buf) != 16 {
+		return nil, merry.Errorf("unsupported MTProxy secret: expected 16 bytes, got %d", len(buf))
+	}
+	return buf, nil
+}
+
+func newCTRStream(key, iv []byte) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return cipher.NewCTR(block, iv), nil
+}
+
+type obfuscatedConn struct {
+	net.Conn
+	enc cipher.Stream
+	dec cipher.Stream
+}
+
+func (c *obfuscatedConn) Write(b []byte) (int, error) {
+	buf := make([]byte, len(b))
+	c.enc.XORKeyStream(buf, b)
+	return c.Conn.Write(buf)
+}
+
+func (c *obfuscatedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.dec.XORKeyStream(b[:n], b[:n])
+	return n, err
+}
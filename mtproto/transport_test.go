@@ -0,0 +1,31 @@
+package mtproto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTransportPacketRoundtrip(t *testing.T) {
+	for _, transport := range []Transport{AbridgedTransport{}, IntermediateTransport{}} {
+		for _, size := range []int{4, 4 * 126, 4 * 127, 4 * 1000} {
+			data := make([]byte, size)
+			for i := range data {
+				data[i] = byte(i)
+			}
+			var buf bytes.Buffer
+			if err := transport.WritePacket(&buf, data); err != nil {
+				t.Fatalf("%s: write %d: %s", transport.Name(), size, err)
+			}
+			res, err := transport.ReadPacket(&buf)
+			if err != nil {
+				t.Fatalf("%s: read %d: %s", transport.Name(), size, err)
+			}
+			if !bytes.Equal(res, data) {
+				t.Errorf("%s: packet of size %d mismatch", transport.Name(), size)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("%s: %d bytes left after reading packet of size %d", transport.Name(), buf.Len(), size)
+			}
+		}
+	}
+}
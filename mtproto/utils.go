@@ -51,6 +51,82 @@ func IsFloodError(tlOrErr any) (time.Duration, bool) {
 	return time.Duration(secs) * time.Second, true
 }
 
+const AuthKeyUnregisteredErrMessage = "AUTH_KEY_UNREGISTERED"
+
+// IsAuthKeyUnregistered checks if response (or error returned by WrongRespError)
+// is AUTH_KEY_UNREGISTERED, i.e. the session was terminated and re-authorization is required.
+// See MTProto.SetAuthKeyUnregisteredHandler.
+func IsAuthKeyUnregistered(tlOrErr any) bool {
+	if val, ok := unwrapUnexpectedTypeErrValue(tlOrErr); ok {
+		tlOrErr = val
+	}
+	err, ok := tlOrErr.(TL_rpcError)
+	return ok && err.ErrorMessage == AuthKeyUnregisteredErrMessage
+}
+
+const AuthKeyDuplicatedErrMessage = "AUTH_KEY_DUPLICATED"
+
+// IsAuthKeyDuplicated checks if response (or error returned by WrongRespError) is AUTH_KEY_DUPLICATED.
+// See MTProto.SetAuthKeyDuplicatedHandler.
+func IsAuthKeyDuplicated(tlOrErr any) bool {
+	if val, ok := unwrapUnexpectedTypeErrValue(tlOrErr); ok {
+		tlOrErr = val
+	}
+	err, ok := tlOrErr.(TL_rpcError)
+	return ok && err.ErrorMessage == AuthKeyDuplicatedErrMessage
+}
+
+// RPCTimeoutErrMessage is a message of TL_rpcError that is returned (by client itself)
+// if response was not received in MTParams.RPCTimeout.
+const RPCTimeoutErrMessage = "CLIENT_RPC_TIMEOUT"
+
+func IsRPCTimeout(tlOrErr any) bool {
+	if val, ok := unwrapUnexpectedTypeErrValue(tlOrErr); ok {
+		tlOrErr = val
+	}
+	err, ok := tlOrErr.(TL_rpcError)
+	return ok && err.ErrorMessage == RPCTimeoutErrMessage
+}
+
+// WithoutUpdates wraps request in invokeWithoutUpdates: no updates will be sent
+// to this connection as a result of the request.
+// https://core.telegram.org/method/invokeWithoutUpdates
+func WithoutUpdates(msg TLReq) TLReq {
+	if _, ok := msg.(TL_invokeWithoutUpdates); ok {
+		return msg
+	}
+	return TL_invokeWithoutUpdates{Query: msg}
+}
+
+// Terminal account errors: session can not be used anymore and retrying makes no sense.
+var (
+	ErrSessionRevoked  = merry.Sentinel("session revoked")
+	ErrSessionExpired  = merry.Sentinel("session expired")
+	ErrUserDeactivated = merry.Sentinel("user deactivated")
+)
+
+// FatalAuthError returns ErrSessionRevoked, ErrSessionExpired or ErrUserDeactivated
+// if response (or error returned by WrongRespError) is a corresponding RPC error, nil otherwise.
+// Result may be compared directly or with errors.Is.
+func FatalAuthError(tlOrErr any) error {
+	if val, ok := unwrapUnexpectedTypeErrValue(tlOrErr); ok {
+		tlOrErr = val
+	}
+	err, ok := tlOrErr.(TL_rpcError)
+	if !ok {
+		return nil
+	}
+	switch err.ErrorMessage {
+	case "SESSION_REVOKED":
+		return ErrSessionRevoked
+	case "SESSION_EXPIRED":
+		return ErrSessionExpired
+	case "USER_DEACTIVATED", "USER_DEACTIVATED_BAN":
+		return ErrUserDeactivated
+	}
+	return nil
+}
+
 // https://core.telegram.org/mtproto/service_messages_about_messages#notice-of-ignored-error-message
 func IsWrongClientTimeError(tlOrErr any) bool {
 	if val, ok := unwrapUnexpectedTypeErrValue(tlOrErr); ok {
@@ -97,6 +173,14 @@ func (r UnexpectedTypeError) Error() string {
 	return UnexpectedTL(_type, r.Value)
 }
 
+// Unwrap allows to use errors.As(err, &rpcErr) (with rpcErr *RPCError) for response errors.
+func (r UnexpectedTypeError) Unwrap() error {
+	if tl, ok := r.Value.(TL_rpcError); ok {
+		return NewRPCError(tl)
+	}
+	return nil
+}
+
 func WrongRespError(obj TL) error {
 	return merry.WrapSkipping(UnexpectedTypeError{Value: obj}, 1)
 }
@@ -0,0 +1,151 @@
+package tgclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// max channels.getParticipants limit
+const participantsPageLimit = 200
+
+// ParticipantPeer returns Peer of ChannelParticipant: TL_peerUser for members and admins,
+// TL_peerUser/TL_peerChannel for banned and left ones.
+func ParticipantPeer(participant mtproto.TL) mtproto.TL_Peer {
+	switch p := participant.(type) {
+	case mtproto.TL_channelParticipant:
+		return mtproto.TL_peerUser{UserID: p.UserID}
+	case mtproto.TL_channelParticipantSelf:
+		return mtproto.TL_peerUser{UserID: p.UserID}
+	case mtproto.TL_channelParticipantCreator:
+		return mtproto.TL_peerUser{UserID: p.UserID}
+	case mtproto.TL_channelParticipantAdmin:
+		return mtproto.TL_peerUser{UserID: p.UserID}
+	case mtproto.TL_channelParticipantBanned:
+		peer, _ := p.Peer.(mtproto.TL_Peer)
+		return peer
+	case mtproto.TL_channelParticipantLeft:
+		peer, _ := p.Peer.(mtproto.TL_Peer)
+		return peer
+	}
+	return nil
+}
+
+// ParticipantsIter iterates over channel (supergroup) participants page by page.
+// Participant list may change during iteration, so participants are deduplicated.
+//
+//	iter := tg.IterParticipants(channel, mtproto.TL_channelParticipantsAdmins{})
+//	for iter.Next() {
+//		participant, user := iter.Participant(), iter.User()
+//	}
+//	if err := iter.Err(); err != nil {
+//		...
+//	}
+type ParticipantsIter struct {
+	c       *TGClient
+	channel mtproto.TL_InputChannel
+	filter  mtproto.TL_ChannelParticipantsFilter
+	offset  int32
+	seen    map[mtproto.TL]bool
+	users   map[int64]mtproto.TL_user
+	page    []mtproto.TL
+	cur     mtproto.TL
+	done    bool
+	err     error
+}
+
+// IterParticipants iterates over participants of channel (InputChannel or TL_peerChannel) matching filter:
+// TL_channelParticipantsRecent (default if nil), TL_channelParticipantsAdmins, TL_channelParticipantsBots,
+// TL_channelParticipantsSearch, TL_channelParticipantsBanned, TL_channelParticipantsKicked, etc.
+func (c *TGClient) IterParticipants(channel mtproto.TL_InputChannel, filter mtproto.TL_ChannelParticipantsFilter) *ParticipantsIter {
+	if filter == nil {
+		filter = mtproto.TL_channelParticipantsRecent{}
+	}
+	inputChannel, err := c.toInputChannel(channel)
+	return &ParticipantsIter{
+		c:       c,
+		channel: inputChannel,
+		filter:  filter,
+		seen:    make(map[mtproto.TL]bool),
+		users:   make(map[int64]mtproto.TL_user),
+		err:     err,
+	}
+}
+
+func (it *ParticipantsIter) Next() bool {
+	return it.NextCtx(context.Background())
+}
+
+// NextCtx is Next with context, see SendSyncCtx. Context error is returned by Err.
+func (it *ParticipantsIter) NextCtx(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetchPage(ctx)
+	}
+	it.cur = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// Participant returns current ChannelParticipant.
+func (it *ParticipantsIter) Participant() mtproto.TL {
+	return it.cur
+}
+
+// User returns user of the current participant, nil if participant is not a user (banned channel).
+func (it *ParticipantsIter) User() *mtproto.TL_user {
+	peer, ok := ParticipantPeer(it.cur).(mtproto.TL_peerUser)
+	if !ok {
+		return nil
+	}
+	user, ok := it.users[peer.UserID]
+	if !ok {
+		return nil
+	}
+	return &user
+}
+
+func (it *ParticipantsIter) Err() error {
+	return it.err
+}
+
+func (it *ParticipantsIter) fetchPage(ctx context.Context) {
+	res, err := it.c.SendSyncRetryCtx(ctx, mtproto.TL_channels_getParticipants{
+		Channel: it.channel,
+		Filter:  it.filter,
+		Offset:  it.offset,
+		Limit:   participantsPageLimit,
+	}, time.Second, 0, 30*time.Second)
+	if err != nil {
+		it.err = merry.Wrap(err)
+		return
+	}
+	list, ok := res.(mtproto.TL_channels_channelParticipants)
+	if !ok {
+		it.err = merry.Wrap(mtproto.WrongRespError(res))
+		return
+	}
+	if len(list.Participants) == 0 {
+		it.done = true
+		return
+	}
+	it.offset += int32(len(list.Participants))
+
+	for _, userTL := range list.Users {
+		if user, ok := userTL.(mtproto.TL_user); ok {
+			it.users[user.ID] = user
+		}
+	}
+	for _, participant := range list.Participants {
+		peer := ParticipantPeer(participant)
+		if peer == nil || it.seen[peer] {
+			continue
+		}
+		it.seen[peer] = true
+		it.page = append(it.page, participant)
+	}
+}
@@ -0,0 +1,39 @@
+package tgclient
+
+import (
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// EnablePassword sets cloud (2FA) password for account without one.
+// Email is optional, if set, EMAIL_UNCONFIRMED_<len> error will be returned
+// and password will be enabled after email confirmation.
+func (c *TGClient) EnablePassword(newPassword, hint, email string) error {
+	if newPassword == "" {
+		return merry.New("new password is empty")
+	}
+	return merry.Wrap(c.mt.UpdatePassword(mtproto.PasswordSettings{
+		NewPassword: newPassword,
+		Hint:        hint,
+		Email:       email,
+	}))
+}
+
+// ChangePassword replaces current cloud (2FA) password with a new one.
+func (c *TGClient) ChangePassword(currentPassword, newPassword, hint string) error {
+	if newPassword == "" {
+		return merry.New("new password is empty")
+	}
+	return merry.Wrap(c.mt.UpdatePassword(mtproto.PasswordSettings{
+		CurrentPassword: currentPassword,
+		NewPassword:     newPassword,
+		Hint:            hint,
+	}))
+}
+
+// DisablePassword removes cloud (2FA) password.
+func (c *TGClient) DisablePassword(currentPassword string) error {
+	return merry.Wrap(c.mt.UpdatePassword(mtproto.PasswordSettings{
+		CurrentPassword: currentPassword,
+	}))
+}
@@ -0,0 +1,253 @@
+package tgclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+var ErrAccessHashUnknown = merry.Sentinel("access hash is unknown")
+var ErrNoAccessHashes = merry.Sentinel("no access hashes data")
+
+// cache changes are accumulated during this interval and saved at once
+const accessHashesSaveDelay = 5 * time.Second
+
+// AccessHashes maps user and channel IDs to their access hashes.
+type AccessHashes struct {
+	Users    map[int64]int64
+	Channels map[int64]int64
+}
+
+// AccessHashStore persists PeerCache content. See PeerCache.SetStore.
+type AccessHashStore interface {
+	Save(*AccessHashes) error
+	Load(*AccessHashes) error // should return ErrNoAccessHashes if there is nothing saved yet
+}
+
+// AccessHashFileStore keeps access hashes in a JSON file.
+type AccessHashFileStore struct {
+	FPath string
+}
+
+func (s *AccessHashFileStore) Save(hashes *AccessHashes) error {
+	f, err := os.Create(s.FPath + ".temp")
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(hashes); err != nil {
+		return merry.Wrap(err)
+	}
+	if err := f.Close(); err != nil {
+		return merry.Wrap(err)
+	}
+
+	if err := os.Rename(s.FPath+".temp", s.FPath); err != nil {
+		return merry.Wrap(err)
+	}
+	return nil
+}
+
+func (s *AccessHashFileStore) Load(hashes *AccessHashes) error {
+	f, err := os.Open(s.FPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return merry.Wrap(ErrNoAccessHashes, merry.WithCause(err))
+	}
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(hashes); err != nil {
+		return merry.Wrap(err)
+	}
+	return nil
+}
+
+// PeerCache collects access hashes of users and channels from all updates and responses
+// (their Users and Chats fields), so InputPeer/InputUser/InputChannel may be built just by ID.
+// Hashes from "min" constructors are ignored: they can not be used outside of the message context.
+type PeerCache struct {
+	mutex     sync.RWMutex
+	hashes    AccessHashes
+	usernames map[string]resolvedUsername // lowercased username -> Peer, see ResolvePeer
+	store     AccessHashStore
+	saveTimer *time.Timer
+	log       mtproto.Logger
+}
+
+func newPeerCache(log mtproto.Logger) *PeerCache {
+	return &PeerCache{
+		hashes:    AccessHashes{Users: make(map[int64]int64), Channels: make(map[int64]int64)},
+		usernames: make(map[string]resolvedUsername),
+		log:       log,
+	}
+}
+
+// SetStore sets storage for access hashes and loads previously saved ones (if any).
+func (p *PeerCache) SetStore(store AccessHashStore) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.store = store
+	saved := AccessHashes{}
+	if err := store.Load(&saved); err != nil {
+		if errors.Is(err, ErrNoAccessHashes) {
+			return nil
+		}
+		return merry.Wrap(err)
+	}
+	for id, hash := range saved.Users {
+		p.hashes.Users[id] = hash
+	}
+	for id, hash := range saved.Channels {
+		p.hashes.Channels[id] = hash
+	}
+	return nil
+}
+
+// Save immediately saves access hashes to the store (if it is set).
+func (p *PeerCache) Save() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.saveTimer != nil {
+		p.saveTimer.Stop()
+		p.saveTimer = nil
+	}
+	if p.store == nil {
+		return nil
+	}
+	return merry.Wrap(p.store.Save(&p.hashes))
+}
+
+func (p *PeerCache) scheduleSaveUnlocked() {
+	if p.store == nil || p.saveTimer != nil {
+		return
+	}
+	p.saveTimer = time.AfterFunc(accessHashesSaveDelay, func() {
+		if err := p.Save(); err != nil {
+			p.log.Error(err, "failed to save access hashes")
+		}
+	})
+}
+
+// Remember saves access hashes of users and chats (TL_user, TL_channel, TL_channelForbidden).
+func (p *PeerCache) Remember(objs []mtproto.TL) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	changed := false
+	for _, obj := range objs {
+		switch x := obj.(type) {
+		case mtproto.TL_user:
+			if !x.Min && x.AccessHash != nil && p.hashes.Users[x.ID] != *x.AccessHash {
+				p.hashes.Users[x.ID] = *x.AccessHash
+				changed = true
+			}
+		case mtproto.TL_channel:
+			if !x.Min && x.AccessHash != nil && p.hashes.Channels[x.ID] != *x.AccessHash {
+				p.hashes.Channels[x.ID] = *x.AccessHash
+				changed = true
+			}
+		case mtproto.TL_channelForbidden:
+			if p.hashes.Channels[x.ID] != x.AccessHash {
+				p.hashes.Channels[x.ID] = x.AccessHash
+				changed = true
+			}
+		}
+	}
+	if changed {
+		p.scheduleSaveUnlocked()
+	}
+}
+
+func (p *PeerCache) UserAccessHash(userID int64) (int64, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	hash, ok := p.hashes.Users[userID]
+	return hash, ok
+}
+
+func (p *PeerCache) ChannelAccessHash(channelID int64) (int64, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	hash, ok := p.hashes.Channels[channelID]
+	return hash, ok
+}
+
+// rememberResponse collects access hashes from Users and Chats fields of the response.
+func (p *PeerCache) rememberResponse(res mtproto.TL) {
+	if vector, ok := res.(mtproto.VectorObject); ok {
+		p.Remember(vector)
+		return
+	}
+	for _, name := range []string{"Users", "Chats"} {
+		field := updateField(res, name)
+		if !field.IsValid() {
+			continue
+		}
+		if objs, ok := field.Interface().([]mtproto.TL); ok {
+			p.Remember(objs)
+		}
+	}
+}
+
+func (p *PeerCache) middleware(next mtproto.Invoker) mtproto.Invoker {
+	return func(ctx context.Context, msg mtproto.TLReq) mtproto.TL {
+		res := next(ctx, msg)
+		p.rememberResponse(res)
+		return res
+	}
+}
+
+// PeerCache returns access hashes cache.
+func (c *TGClient) PeerCache() *PeerCache {
+	return c.peers
+}
+
+// Resolve returns InputPeer (TL_inputPeerUser, TL_inputPeerChat or TL_inputPeerChannel)
+// for Peer (TL_peerUser, TL_peerChat or TL_peerChannel) using cached access hash.
+func (c *TGClient) Resolve(peer mtproto.TL_Peer) (mtproto.TL_InputPeer, error) {
+	switch p := peer.(type) {
+	case mtproto.TL_peerUser:
+		hash, ok := c.peers.UserAccessHash(p.UserID)
+		if !ok {
+			return nil, merry.Appendf(ErrAccessHashUnknown, "user %d", p.UserID)
+		}
+		return mtproto.TL_inputPeerUser{UserID: p.UserID, AccessHash: hash}, nil
+	case mtproto.TL_peerChat:
+		return mtproto.TL_inputPeerChat{ChatID: p.ChatID}, nil
+	case mtproto.TL_peerChannel:
+		hash, ok := c.peers.ChannelAccessHash(p.ChannelID)
+		if !ok {
+			return nil, merry.Appendf(ErrAccessHashUnknown, "channel %d", p.ChannelID)
+		}
+		return mtproto.TL_inputPeerChannel{ChannelID: p.ChannelID, AccessHash: hash}, nil
+	}
+	return nil, merry.New(mtproto.UnexpectedTL("peer", peer))
+}
+
+// ResolveUser returns TL_inputUser with cached access hash.
+func (c *TGClient) ResolveUser(userID int64) (mtproto.TL_inputUser, error) {
+	hash, ok := c.peers.UserAccessHash(userID)
+	if !ok {
+		return mtproto.TL_inputUser{}, merry.Appendf(ErrAccessHashUnknown, "user %d", userID)
+	}
+	return mtproto.TL_inputUser{UserID: userID, AccessHash: hash}, nil
+}
+
+// ResolveChannel returns TL_inputChannel with cached access hash.
+func (c *TGClient) ResolveChannel(channelID int64) (mtproto.TL_inputChannel, error) {
+	hash, ok := c.peers.ChannelAccessHash(channelID)
+	if !ok {
+		return mtproto.TL_inputChannel{}, merry.Appendf(ErrAccessHashUnknown, "channel %d", channelID)
+	}
+	return mtproto.TL_inputChannel{ChannelID: channelID, AccessHash: hash}, nil
+}
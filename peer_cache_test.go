@@ -0,0 +1,39 @@
+package tgclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+)
+
+func TestPeerCacheResolve(t *testing.T) {
+	c := &TGClient{peers: newPeerCache(mtproto.Logger{Hnd: mtproto.NoopLogHandler{}})}
+	c.peers.rememberResponse(mtproto.TL_contacts_resolvedPeer{
+		Users: []mtproto.TL{
+			mtproto.TL_user{ID: 1, AccessHash: mtproto.Ref(int64(11))},
+			mtproto.TL_user{ID: 2, AccessHash: mtproto.Ref(int64(22)), Min: true},
+		},
+		Chats: []mtproto.TL{mtproto.TL_channel{ID: 3, AccessHash: mtproto.Ref(int64(33))}},
+	})
+	c.peers.rememberResponse(nil)
+
+	if peer, err := c.Resolve(mtproto.TL_peerUser{UserID: 1}); err != nil || peer != (mtproto.TL_inputPeerUser{UserID: 1, AccessHash: 11}) {
+		t.Errorf("wrong user: %#v %v", peer, err)
+	}
+	if _, err := c.Resolve(mtproto.TL_peerUser{UserID: 2}); !errors.Is(err, ErrAccessHashUnknown) {
+		t.Errorf("min user hash should be ignored, got %v", err)
+	}
+	if channel, err := c.ResolveChannel(3); err != nil || channel.AccessHash != 33 {
+		t.Errorf("wrong channel: %#v %v", channel, err)
+	}
+	if peer, err := c.toInputPeer(mtproto.TL_peerChannel{ChannelID: 3}); err != nil || peer != (mtproto.TL_inputPeerChannel{ChannelID: 3, AccessHash: 33}) {
+		t.Errorf("peer was not resolved: %#v %v", peer, err)
+	}
+	if peer, err := c.toInputPeer(mtproto.TL_inputPeerSelf{}); err != nil || peer != (mtproto.TL_inputPeerSelf{}) {
+		t.Errorf("input peer should be returned as is: %#v %v", peer, err)
+	}
+	if channel, err := c.toInputChannel(mtproto.TL_peerChannel{ChannelID: 3}); err != nil || channel != (mtproto.TL_inputChannel{ChannelID: 3, AccessHash: 33}) {
+		t.Errorf("channel was not resolved: %#v %v", channel, err)
+	}
+}
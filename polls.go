@@ -0,0 +1,149 @@
+package tgclient
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// PollOpts are optional SendPoll parameters.
+type PollOpts struct {
+	MultipleChoice bool
+	PublicVoters   bool
+	Quiz           bool
+	CorrectOptions []int  // indexes of correct answers, required for quiz
+	Solution       string // shown after wrong quiz answer
+	ClosePeriod    int32  // seconds, 5-600
+	Media          SendMediaOpts
+}
+
+// PollAnswerResult is a number of votes for a poll answer.
+type PollAnswerResult struct {
+	Option  []byte
+	Voters  int32
+	Chosen  bool // current user voted for this answer
+	Correct bool // for quizzes
+}
+
+// PollResults is a typed version of TL_updateMessagePoll.
+type PollResults struct {
+	PollID      int64
+	Poll        *mtproto.TL_poll // nil if poll itself was not changed
+	Min         bool             // Chosen and Correct flags are not set and should be taken from the previous results
+	TotalVoters int32
+	Answers     []PollAnswerResult
+}
+
+func newPollResults(upd mtproto.TL_updateMessagePoll) PollResults {
+	res := PollResults{
+		PollID:      upd.PollID,
+		Poll:        upd.Poll,
+		Min:         upd.Results.Min,
+		TotalVoters: mtproto.DerefOr(upd.Results.TotalVoters, 0),
+	}
+	for _, r := range upd.Results.Results {
+		res.Answers = append(res.Answers, PollAnswerResult{Option: r.Option, Voters: r.Voters, Chosen: r.Chosen, Correct: r.Correct})
+	}
+	return res
+}
+
+// OnPollResults subscribes handler to poll results changes.
+func (d *Dispatcher) OnPollResults(handler func(PollResults), filters ...UpdateFilter) {
+	On(d, func(upd mtproto.TL_updateMessagePoll) { handler(newPollResults(upd)) }, filters...)
+}
+
+// OnPollVote subscribes handler to votes in polls created by the bot (bots only).
+func (d *Dispatcher) OnPollVote(handler func(mtproto.TL_updateMessagePollVote), filters ...UpdateFilter) {
+	On(d, handler, filters...)
+}
+
+// PollOption returns option (identifier) of index-th answer of polls sent with SendPoll.
+func PollOption(index int) []byte {
+	return []byte{byte(index)}
+}
+
+// SendPoll sends poll with question and answers to peer (InputPeer or Peer). Opts may be nil.
+func (c *TGClient) SendPoll(peer mtproto.TL_InputPeer, question string, answers []string, opts *PollOpts) (mtproto.TL, error) {
+	return c.SendPollCtx(context.Background(), peer, question, answers, opts)
+}
+
+// SendPollCtx is SendPoll with context, see SendSyncCtx.
+func (c *TGClient) SendPollCtx(ctx context.Context, peer mtproto.TL_InputPeer, question string, answers []string, opts *PollOpts) (mtproto.TL, error) {
+	if opts == nil {
+		opts = &PollOpts{}
+	}
+	poll := mtproto.TL_poll{
+		ID:             rand.Int63(),
+		MultipleChoice: opts.MultipleChoice,
+		PublicVoters:   opts.PublicVoters,
+		Quiz:           opts.Quiz,
+		Question:       mtproto.TL_textWithEntities{Text: question, Entities: []mtproto.TL{}},
+	}
+	for i, answer := range answers {
+		poll.Answers = append(poll.Answers, mtproto.TL_pollAnswer{
+			Text:   mtproto.TL_textWithEntities{Text: answer, Entities: []mtproto.TL{}},
+			Option: PollOption(i),
+		})
+	}
+	if opts.ClosePeriod > 0 {
+		poll.ClosePeriod = &opts.ClosePeriod
+	}
+
+	media := mtproto.TL_inputMediaPoll{Poll: poll}
+	for _, index := range opts.CorrectOptions {
+		if index < 0 || index >= len(answers) {
+			return nil, merry.Errorf("correct option index %d is out of range", index)
+		}
+		media.CorrectAnswers = append(media.CorrectAnswers, PollOption(index))
+	}
+	if opts.Solution != "" {
+		media.Solution = &opts.Solution
+		media.SolutionEntities = []mtproto.TL{}
+	}
+	msg, err := c.sendMedia(ctx, peer, media, &opts.Media)
+	return msg, merry.Wrap(err)
+}
+
+// VotePoll votes for poll answers (see PollOption) in message msgID. Empty options retract the vote.
+// Returns updated poll results.
+func (c *TGClient) VotePoll(peer mtproto.TL_InputPeer, msgID int32, options ...[]byte) (*PollResults, error) {
+	return c.VotePollCtx(context.Background(), peer, msgID, options...)
+}
+
+// VotePollCtx is VotePoll with context, see SendSyncCtx.
+func (c *TGClient) VotePollCtx(ctx context.Context, peer mtproto.TL_InputPeer, msgID int32, options ...[]byte) (*PollResults, error) {
+	inputPeer, err := c.toInputPeer(peer)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if options == nil {
+		options = [][]byte{}
+	}
+	res, err := c.SendSyncCtx(ctx, mtproto.TL_messages_sendVote{Peer: inputPeer, MsgID: msgID, Options: options})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if _, ok := mtproto.AsRPCError(res); ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	c.updates.Process(res)
+
+	var updates []mtproto.TL
+	switch u := res.(type) {
+	case mtproto.TL_updates:
+		updates = u.Updates
+	case mtproto.TL_updatesCombined:
+		updates = u.Updates
+	case mtproto.TL_updateShort:
+		updates = []mtproto.TL{u.Update}
+	}
+	for _, upd := range updates {
+		if pollUpd, ok := upd.(mtproto.TL_updateMessagePoll); ok {
+			results := newPollResults(pollUpd)
+			return &results, nil
+		}
+	}
+	return nil, mtproto.WrongRespError(res)
+}
@@ -0,0 +1,96 @@
+package tgclient
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits transfer speed (token bucket). It is safe for concurrent use,
+// so one limiter may be shared between several transfers to cap their total bandwidth.
+type RateLimiter struct {
+	mutex       sync.Mutex
+	bytesPerSec float64
+	burst       float64
+	tokens      float64
+	lastAt      time.Time
+}
+
+// NewRateLimiter returns limiter allowing bytesPerSec on average.
+// Up to one second worth of bytes may be transferred at once after idle period.
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{
+		bytesPerSec: float64(bytesPerSec),
+		burst:       float64(bytesPerSec),
+		tokens:      float64(bytesPerSec),
+		lastAt:      time.Now(),
+	}
+}
+
+// reserve takes n bytes from the bucket and returns how long caller should wait before using them.
+// Bucket may go negative, so chunks larger than burst are still allowed (with longer wait).
+func (l *RateLimiter) reserve(n int) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.lastAt).Seconds() * l.bytesPerSec
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.lastAt = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.bytesPerSec * float64(time.Second))
+}
+
+// Wait blocks until n bytes may be transferred. Nil limiter does not limit anything.
+func (l *RateLimiter) Wait(n int) {
+	if l == nil || l.bytesPerSec <= 0 {
+		return
+	}
+	if delay := l.reserve(n); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+type rateLimitedWriter struct {
+	w       io.Writer
+	limiter *RateLimiter
+}
+
+// NewRateLimitedWriter wraps w so that data is written not faster than limiter allows.
+// May be used to limit a single download (global limit is set via TGClient.SetTransferRateLimiter).
+func NewRateLimitedWriter(w io.Writer, limiter *RateLimiter) io.Writer {
+	return &rateLimitedWriter{w: w, limiter: limiter}
+}
+
+func (r *rateLimitedWriter) Write(buf []byte) (int, error) {
+	r.limiter.Wait(len(buf))
+	return r.w.Write(buf)
+}
+
+// Flush flushes underlying writer (if it supports flushing), see StreamFile.
+func (r *rateLimitedWriter) Flush() error {
+	return flushWriter(r.w)
+}
+
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+// NewRateLimitedReader wraps r so that data is read not faster than limiter allows.
+// May be used to limit a single upload (see UploadFile).
+func NewRateLimitedReader(r io.Reader, limiter *RateLimiter) io.Reader {
+	return &rateLimitedReader{r: r, limiter: limiter}
+}
+
+func (r *rateLimitedReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	if n > 0 {
+		r.limiter.Wait(n)
+	}
+	return n, err
+}
@@ -0,0 +1,18 @@
+package tgclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	l := NewRateLimiter(1000)
+	if delay := l.reserve(1000); delay != 0 {
+		t.Fatalf("expected no delay for the initial burst, got %s", delay)
+	}
+	if delay := l.reserve(500); delay < 490*time.Millisecond || delay > 500*time.Millisecond {
+		t.Fatalf("expected ~500ms delay, got %s", delay)
+	}
+	var nilLimiter *RateLimiter
+	nilLimiter.Wait(1 << 30) // should not block
+}
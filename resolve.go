@@ -0,0 +1,114 @@
+package tgclient
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// contacts.resolveUsername is heavily flood-limited, so results are cached for this time
+const usernameCacheTTL = time.Hour
+
+var usernameRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{3,31}$`)
+
+type resolvedUsername struct {
+	peer       mtproto.TL_Peer
+	resolvedAt time.Time
+}
+
+func (p *PeerCache) cachedUsername(username string) (mtproto.TL_Peer, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	item, ok := p.usernames[strings.ToLower(username)]
+	if !ok || time.Since(item.resolvedAt) > usernameCacheTTL {
+		return nil, false
+	}
+	return item.peer, true
+}
+
+func (p *PeerCache) rememberUsername(username string, peer mtproto.TL_Peer) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.usernames[strings.ToLower(username)] = resolvedUsername{peer: peer, resolvedAt: time.Now()}
+}
+
+// ParseUsername extracts username from "@username", "username", t.me links
+// ("https://t.me/username", "t.me/username/123", "telegram.me/username")
+// and deep links ("tg://resolve?domain=username").
+func ParseUsername(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	username := strings.TrimPrefix(s, "@")
+	if strings.HasPrefix(s, "tg:") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", merry.Wrap(err)
+		}
+		if u.Host != "resolve" && u.Opaque != "resolve" {
+			return "", merry.Errorf("unsupported deep link: %s", s)
+		}
+		username = u.Query().Get("domain")
+	} else if i := strings.Index(s, "://"); i != -1 || strings.Contains(s, "/") {
+		path := s
+		if i != -1 {
+			path = s[i+3:]
+		}
+		host, rest, _ := strings.Cut(path, "/")
+		host = strings.TrimPrefix(strings.ToLower(host), "www.")
+		if host != "t.me" && host != "telegram.me" && host != "telegram.dog" {
+			return "", merry.Errorf("unsupported link: %s", s)
+		}
+		username, _, _ = strings.Cut(rest, "/")
+		username, _, _ = strings.Cut(username, "?")
+	}
+	if !usernameRe.MatchString(username) {
+		return "", merry.Errorf("invalid username in %q", s)
+	}
+	return username, nil
+}
+
+// ResolvePeer returns InputPeer (TL_inputPeerUser, TL_inputPeerChannel, etc.) by username,
+// t.me link or tg://resolve deep link (see ParseUsername). Results are cached for an hour,
+// FLOOD_WAIT errors up to 30 seconds are waited automatically.
+func (c *TGClient) ResolvePeer(username string) (mtproto.TL_InputPeer, error) {
+	return c.ResolvePeerCtx(context.Background(), username)
+}
+
+// ResolvePeerCtx is ResolvePeer with context, see SendSyncCtx.
+func (c *TGClient) ResolvePeerCtx(ctx context.Context, username string) (mtproto.TL_InputPeer, error) {
+	username, err := ParseUsername(username)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if peer, ok := c.peers.cachedUsername(username); ok {
+		inputPeer, err := c.Resolve(peer)
+		if err == nil {
+			return inputPeer, nil
+		}
+		// access hash may have been missing (for example, hashes store was reset), resolving again
+	}
+
+	res, err := c.SendSyncRetryCtx(ctx, mtproto.TL_contacts_resolveUsername{Username: username}, time.Second, 0, 30*time.Second)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	resolved, ok := res.(mtproto.TL_contacts_resolvedPeer)
+	if !ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	peer, ok := resolved.Peer.(mtproto.TL_Peer)
+	if !ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	// access hashes are remembered by the PeerCache middleware
+	inputPeer, err := c.Resolve(peer)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	c.peers.rememberUsername(username, peer)
+	return inputPeer, nil
+}
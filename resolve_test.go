@@ -0,0 +1,22 @@
+package tgclient
+
+import "testing"
+
+func TestParseUsername(t *testing.T) {
+	for _, s := range []string{
+		"durov", "@durov", " durov ", "t.me/durov", "https://t.me/durov", "https://t.me/durov/123",
+		"http://www.telegram.me/durov?start=1", "tg://resolve?domain=durov", "tg:resolve?domain=durov",
+	} {
+		username, err := ParseUsername(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+		} else if username != "durov" {
+			t.Errorf("%q: expected durov, got %q", s, username)
+		}
+	}
+	for _, s := range []string{"", "@", "a", "1durov", "https://example.com/durov", "tg://join?invite=abc", "du-rov"} {
+		if username, err := ParseUsername(s); err == nil {
+			t.Errorf("%q: expected error, got %q", s, username)
+		}
+	}
+}
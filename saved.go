@@ -0,0 +1,85 @@
+package tgclient
+
+import (
+	"context"
+	"io"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// SavedMessages returns input peer of "Saved Messages" chat.
+func SavedMessages() mtproto.TL_InputPeer {
+	return mtproto.TL_inputPeerSelf{}
+}
+
+// SendToSaved uploads data as a document named name to "Saved Messages"
+// and returns sent message (TL_message).
+func (c *TGClient) SendToSaved(data io.Reader, name string) (mtproto.TL, error) {
+	return c.SendToSavedCtx(context.Background(), data, name)
+}
+
+// SendToSavedCtx is SendToSaved with context, see SendSyncCtx.
+func (c *TGClient) SendToSavedCtx(ctx context.Context, data io.Reader, name string) (mtproto.TL, error) {
+	msg, err := c.SendDocumentCtx(ctx, SavedMessages(), data, -1, name, &SendMediaOpts{MIMEType: "application/octet-stream"})
+	return msg, merry.Wrap(err)
+}
+
+// IterSavedMessages iterates over "Saved Messages".
+//
+// If savedPeer is not nil, only messages forwarded from that peer
+// (i.e. from that saved dialog) are returned.
+// If tags are not empty, only messages tagged with all of that
+// reactions (TL_reactionEmoji, TL_reactionCustomEmoji) are returned.
+func (c *TGClient) IterSavedMessages(savedPeer mtproto.TL_InputPeer, tags ...mtproto.TL) *MessagesIter {
+	savedPeer, err := c.toInputPeer(savedPeer)
+	iter := c.newMessagesIter(func(offsetID, limit int32) (mtproto.TLReq, error) {
+		if len(tags) > 0 {
+			return mtproto.TL_messages_search{
+				Peer:          SavedMessages(),
+				SavedPeerID:   savedPeer,
+				SavedReaction: tags,
+				Filter:        mtproto.TL_inputMessagesFilterEmpty{},
+				OffsetID:      offsetID,
+				Limit:         limit,
+			}, nil
+		}
+		if savedPeer != nil {
+			return mtproto.TL_messages_getSavedHistory{
+				Peer:     savedPeer,
+				OffsetID: offsetID,
+				Limit:    limit,
+			}, nil
+		}
+		return mtproto.TL_messages_getHistory{
+			Peer:     SavedMessages(),
+			OffsetID: offsetID,
+			Limit:    limit,
+		}, nil
+	})
+	iter.err = err
+	return iter
+}
+
+// GetSavedReactionTags returns tags used in "Saved Messages".
+// If savedPeer is not nil, only tags used in that saved dialog are returned.
+func (c *TGClient) GetSavedReactionTags(savedPeer mtproto.TL_InputPeer) ([]mtproto.TL_savedReactionTag, error) {
+	return c.GetSavedReactionTagsCtx(context.Background(), savedPeer)
+}
+
+// GetSavedReactionTagsCtx is GetSavedReactionTags with context, see SendSyncCtx.
+func (c *TGClient) GetSavedReactionTagsCtx(ctx context.Context, savedPeer mtproto.TL_InputPeer) ([]mtproto.TL_savedReactionTag, error) {
+	savedPeer, err := c.toInputPeer(savedPeer)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	res, err := c.SendSyncCtx(ctx, mtproto.TL_messages_getSavedReactionTags{Peer: savedPeer})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	tags, ok := res.(mtproto.TL_messages_savedReactionTags)
+	if !ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	return tags.Tags, nil
+}
@@ -0,0 +1,97 @@
+package tgclient
+
+import (
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// SearchFilter limits message search to some media type.
+type SearchFilter int
+
+const (
+	SearchAll SearchFilter = iota
+	SearchPhotos
+	SearchVideos
+	SearchPhotosAndVideos
+	SearchDocuments
+	SearchLinks
+	SearchGIFs
+	SearchVoice
+	SearchMusic
+	SearchRoundVideos
+	SearchMentions
+	SearchPinned
+)
+
+// TL returns MessagesFilter for the filter.
+func (f SearchFilter) TL() mtproto.TL {
+	switch f {
+	case SearchPhotos:
+		return mtproto.TL_inputMessagesFilterPhotos{}
+	case SearchVideos:
+		return mtproto.TL_inputMessagesFilterVideo{}
+	case SearchPhotosAndVideos:
+		return mtproto.TL_inputMessagesFilterPhotoVideo{}
+	case SearchDocuments:
+		return mtproto.TL_inputMessagesFilterDocument{}
+	case SearchLinks:
+		return mtproto.TL_inputMessagesFilterURL{}
+	case SearchGIFs:
+		return mtproto.TL_inputMessagesFilterGIF{}
+	case SearchVoice:
+		return mtproto.TL_inputMessagesFilterVoice{}
+	case SearchMusic:
+		return mtproto.TL_inputMessagesFilterMusic{}
+	case SearchRoundVideos:
+		return mtproto.TL_inputMessagesFilterRoundVideo{}
+	case SearchMentions:
+		return mtproto.TL_inputMessagesFilterMyMentions{}
+	case SearchPinned:
+		return mtproto.TL_inputMessagesFilterPinned{}
+	default:
+		return mtproto.TL_inputMessagesFilterEmpty{}
+	}
+}
+
+// SearchMessages iterates over messages in peer (InputPeer or Peer) containing query
+// (may be empty to list all messages matching filter), from newest to oldest.
+func (c *TGClient) SearchMessages(peer mtproto.TL_InputPeer, query string, filter SearchFilter) *MessagesIter {
+	inputPeer, err := c.toInputPeer(peer)
+	iter := c.newMessagesIter(func(offsetID, limit int32) (mtproto.TLReq, error) {
+		return mtproto.TL_messages_search{
+			Peer:     inputPeer,
+			Q:        query,
+			Filter:   filter.TL(),
+			OffsetID: offsetID,
+			Limit:    limit,
+		}, nil
+	})
+	iter.err = err
+	return iter
+}
+
+// SearchGlobal iterates over messages containing query in all chats (except secret ones).
+// Results are sorted by date (newest first), query may be empty if filter is set.
+func (c *TGClient) SearchGlobal(query string, filter SearchFilter) *MessagesIter {
+	var iter *MessagesIter
+	iter = c.newMessagesIter(func(offsetID, limit int32) (mtproto.TLReq, error) {
+		req := mtproto.TL_messages_searchGlobal{
+			Q:          query,
+			Filter:     filter.TL(),
+			OffsetPeer: mtproto.TL_inputPeerEmpty{},
+			Limit:      limit,
+		}
+		if iter.lastMsg != nil {
+			// next page offset is (rate, peer, id) of the last received message
+			peer, err := c.Resolve(MessagePeer(iter.lastMsg))
+			if err != nil {
+				return nil, merry.Wrap(err)
+			}
+			req.OffsetRate = iter.nextRate
+			req.OffsetPeer = peer
+			req.OffsetID = offsetID
+		}
+		return req, nil
+	})
+	return iter
+}
@@ -0,0 +1,60 @@
+package tgclient
+
+import (
+	"context"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// GetAuthorizations returns list of logged-in sessions (devices) of current account.
+func (c *TGClient) GetAuthorizations() ([]mtproto.TL_authorization, error) {
+	return c.GetAuthorizationsCtx(context.Background())
+}
+
+// GetAuthorizationsCtx is GetAuthorizations with context, see SendSyncCtx.
+func (c *TGClient) GetAuthorizationsCtx(ctx context.Context) ([]mtproto.TL_authorization, error) {
+	res, err := c.SendSyncCtx(ctx, mtproto.TL_account_getAuthorizations{})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	auths, ok := res.(mtproto.TL_account_authorizations)
+	if !ok {
+		return nil, mtproto.WrongRespError(res)
+	}
+	return auths.Authorizations, nil
+}
+
+// ResetAuthorization terminates session with given hash (TL_authorization.Hash).
+func (c *TGClient) ResetAuthorization(hash int64) error {
+	return c.ResetAuthorizationCtx(context.Background(), hash)
+}
+
+// ResetAuthorizationCtx is ResetAuthorization with context, see SendSyncCtx.
+func (c *TGClient) ResetAuthorizationCtx(ctx context.Context, hash int64) error {
+	res, err := c.SendSyncCtx(ctx, mtproto.TL_account_resetAuthorization{Hash: hash})
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if _, ok := res.(mtproto.TL_boolTrue); !ok {
+		return mtproto.WrongRespError(res)
+	}
+	return nil
+}
+
+// ResetOtherAuthorizations terminates all sessions except the current one.
+func (c *TGClient) ResetOtherAuthorizations() error {
+	return c.ResetOtherAuthorizationsCtx(context.Background())
+}
+
+// ResetOtherAuthorizationsCtx is ResetOtherAuthorizations with context, see SendSyncCtx.
+func (c *TGClient) ResetOtherAuthorizationsCtx(ctx context.Context) error {
+	res, err := c.SendSyncCtx(ctx, mtproto.TL_auth_resetAuthorizations{})
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if _, ok := res.(mtproto.TL_boolTrue); !ok {
+		return mtproto.WrongRespError(res)
+	}
+	return nil
+}
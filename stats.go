@@ -0,0 +1,47 @@
+package tgclient
+
+import (
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+)
+
+type Stats struct {
+	DCLatencies []mtproto.DCLatency
+}
+
+// Stats returns client connection statistics.
+func (c *TGClient) Stats() Stats {
+	return Stats{
+		DCLatencies: c.mt.DCLatencies(),
+	}
+}
+
+// StartDCLatencyProber periodically measures latencies to all known DC addresses
+// (first probe is made immediately). Measurements are available via Stats()
+// and are used by Downloader if PreferFastestDC is set.
+// Prober is stopped on Disconnect.
+func (c *TGClient) StartDCLatencyProber(interval time.Duration) {
+	if c.latencyProberStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	c.latencyProberStop = stop
+	go func() {
+		for {
+			c.mt.ProbeDCLatencies(10 * time.Second)
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+func (c *TGClient) stopDCLatencyProber() {
+	if c.latencyProberStop != nil {
+		close(c.latencyProberStop)
+		c.latencyProberStop = nil
+	}
+}
@@ -1,10 +1,11 @@
 package tgclient
 
 import (
+	"context"
 	"os"
 	"path/filepath"
-	"reflect"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/3bl3gamer/tgclient/mtproto"
@@ -13,10 +14,19 @@ import (
 )
 
 type TGClient struct {
-	mt                   *mtproto.MTProto
-	updatesState         *mtproto.TL_updates_state
-	handleUpdateExternal UpdateHandler
-	log                  mtproto.Logger
+	mt                    *mtproto.MTProto
+	updates               *UpdatesManager
+	dispatcher            *Dispatcher
+	peers                 *PeerCache
+	updateWorkersCount    int
+	updateWorkers         *updateWorkers
+	updateWorkersMutex    sync.RWMutex
+	catchUp               bool
+	handleGiveawayResults GiveawayResultsHandler
+	latencyProberStop     chan struct{}
+	transferLimiter       *RateLimiter
+	uploadParallelism     int
+	log                   mtproto.Logger
 	extraData
 	Downloader
 }
@@ -56,28 +66,43 @@ func NewTGClientExt(cfg *mtproto.AppConfig, sessStore mtproto.SessionStore, logH
 	})
 
 	client := &TGClient{
-		mt:           mt,
-		updatesState: &mtproto.TL_updates_state{},
-		log:          mtproto.Logger{Hnd: logHnd},
+		mt:                 mt,
+		log:                mtproto.Logger{Hnd: logHnd},
+		updateWorkersCount: DefaultUpdateWorkers,
 	}
+	client.updates = newUpdatesManager(client)
+	client.dispatcher = newDispatcher()
+	client.peers = newPeerCache(client.log)
 	client.extraData = *newExtraData(client)
 
 	mt.SetEventsHandler(client.handleEvent)
+	mt.Use(client.peers.middleware)
 	return client
 }
 
+// SetUpdateHandler sets handler that receives all updates, see Dispatcher.SetUpdateHandler.
+// Dispatcher() provides more convenient typed subscriptions.
 func (c *TGClient) SetUpdateHandler(handleUpdate UpdateHandler) {
-	c.handleUpdateExternal = handleUpdate
+	c.dispatcher.SetUpdateHandler(handleUpdate)
 }
 
 func (c *TGClient) InitAndConnect() error {
 	c.Downloader.Start(c)
+	c.startUpdateWorkers()
 	return merry.Wrap(c.mt.InitSessAndConnect())
 }
 
 func (c *TGClient) Disconnect() error {
+	c.stopDCLatencyProber()
+	if err := c.updates.SaveState(); err != nil {
+		c.log.Error(err, "failed to save updates state")
+	}
+	if err := c.peers.Save(); err != nil {
+		c.log.Error(err, "failed to save access hashes")
+	}
 	stopErr := c.Downloader.Stop()
 	discErr := c.mt.Disconnect()
+	c.stopUpdateWorkers()
 	if stopErr != nil {
 		merry.Wrap(stopErr)
 	}
@@ -85,59 +110,23 @@ func (c *TGClient) Disconnect() error {
 }
 
 func (c *TGClient) handleEvent(eventObj mtproto.TL) {
-	switch event := eventObj.(type) {
-	case mtproto.TL_updatesTooLong:
-		//TODO: what?
-		// Too many updates, it is necessary to execute updates.getDifference.
-		// https://core.telegram.org/constructor/updatesTooLong
-		c.log.Warn("updates too long")
-	case mtproto.TL_updateShort:
-		c.updatesState.Date = event.Date
-		c.handleUpdate(event.Update)
-	case mtproto.TL_updates:
-		c.updatesState.Date = event.Date
-		c.updatesState.Seq = event.Seq
-		c.rememberEventExtraData(event.Users)
-		c.rememberEventExtraData(event.Chats)
-		for _, u := range event.Updates {
-			c.handleUpdate(u)
-		}
-	case mtproto.TL_updateShortMessage:
-		c.updatesState.Date = event.Date
-		c.updatesState.PTS = event.PTS
-		// update.PtsCount
-		c.handleUpdate(event)
-	case mtproto.TL_updateShortChatMessage:
-		c.updatesState.Date = event.Date
-		c.updatesState.PTS = event.PTS
-		// update.PtsCount
-		c.handleUpdate(event)
-	case mtproto.TL_updatesCombined:
-		c.updatesState.Date = event.Date
-		c.updatesState.Seq = event.Seq
-		c.rememberEventExtraData(event.Users)
-		c.rememberEventExtraData(event.Chats)
-		// update.SeqStart
-		for _, u := range event.Updates {
-			c.handleUpdate(u)
-		}
-	case mtproto.TL_updateShortSentMessage:
-		c.updatesState.PTS = event.PTS
-		// update.PtsCount
-		c.handleUpdate(event)
-	default:
-		c.log.Warn(mtproto.UnexpectedTL("event", eventObj))
-	}
+	c.updates.Process(eventObj)
 }
 
-func (e *TGClient) handleUpdate(obj mtproto.TL) {
-	value := reflect.ValueOf(obj).FieldByName("Pts")
-	if value != (reflect.Value{}) {
-		e.updatesState.PTS = int32(value.Int())
-	}
-	if e.handleUpdateExternal != nil {
-		e.handleUpdateExternal(obj)
-	}
+// Updates returns updates manager: it tracks updates state and recovers missed updates.
+func (c *TGClient) Updates() *UpdatesManager {
+	return c.updates
+}
+
+// Dispatcher returns updates dispatcher for typed subscriptions (new messages, edits, etc.).
+func (c *TGClient) Dispatcher() *Dispatcher {
+	return c.dispatcher
+}
+
+func (c *TGClient) deliverUpdate(obj mtproto.TL) {
+	obj = c.expandShortUpdate(obj)
+	c.dispatchGiveawayResults(obj)
+	c.dispatcher.Dispatch(obj)
 }
 
 func (c *TGClient) AuthExt(authData mtproto.AuthDataProvider, message mtproto.TLReq) (mtproto.TL, error) {
@@ -154,33 +143,151 @@ func (c *TGClient) AuthExt(authData mtproto.AuthDataProvider, message mtproto.TL
 	}
 }
 
-func (c *TGClient) AuthAndInitEvents(authData mtproto.AuthDataProvider) error {
-	// after reconnection TG *sometimes* stops sending updates
-	c.mt.SetReconnectionHandler(func() error {
+// AuthEx performs blocking authorization (prompting all required data from authData)
+// and returns authorized user. Unlike AuthExt it does not check if the client is already authorized.
+func (c *TGClient) AuthEx(authData mtproto.AuthDataProvider) (*mtproto.TL_user, error) {
+	user, err := c.mt.AuthEx(authData)
+	return user, merry.Wrap(err)
+}
+
+// NewAuthFlow returns non-blocking step-by-step authorization flow.
+// After it is done, AuthAndInitEvents (or AuthExt) should still be called to init updates.
+func (c *TGClient) NewAuthFlow() *mtproto.AuthFlow {
+	return c.mt.NewAuthFlow()
+}
+
+// SetCatchUp enables fetching updates missed while client was offline: after each reconnection
+// and on start (if updates state was restored, see UpdatesManager.SetStore) updates.getDifference is called.
+// Otherwise updates stream starts from the current state and missed updates are skipped.
+// Should be called before AuthAndInitEvents.
+func (c *TGClient) SetCatchUp(enabled bool) {
+	c.catchUp = enabled
+}
+
+// resyncUpdates is called after reconnection: it re-syncs updates state
+// (so TG continues sending updates) and emits ConnectionRestored.
+func (c *TGClient) resyncUpdates() error {
+	if c.catchUp {
+		if err := c.updates.GetDifference(); err != nil {
+			return merry.Wrap(err)
+		}
+	} else {
 		res := c.SendSync(mtproto.TL_updates_getState{})
-		if _, ok := res.(mtproto.TL_updates_state); !ok {
+		state, ok := res.(mtproto.TL_updates_state)
+		if !ok {
 			return mtproto.WrongRespError(res)
 		}
-		return nil
-	})
+		c.updates.SetState(state)
+	}
+	state, _ := c.updates.State()
+	// handlers may send requests, so they should not block reconnection routine
+	go c.dispatcher.dispatchConnectionRestored(ConnectionRestored{CaughtUp: c.catchUp, State: state})
+	return nil
+}
+
+func (c *TGClient) AuthAndInitEvents(authData mtproto.AuthDataProvider) error {
+	// after reconnection TG *sometimes* stops sending updates
+	c.mt.SetReconnectionHandler(c.resyncUpdates)
 
 	res, err := c.AuthExt(authData, mtproto.TL_updates_getState{})
 	if err != nil {
 		return merry.Wrap(err)
 	}
-	if _, ok := res.(mtproto.TL_updates_state); !ok {
+	state, ok := res.(mtproto.TL_updates_state)
+	if !ok {
 		return mtproto.WrongRespError(res)
 	}
+	if _, restored := c.updates.State(); restored && c.catchUp {
+		// state was loaded from the store (see UpdatesManager.SetStore), fetching updates missed since last run
+		return merry.Wrap(c.updates.GetDifference())
+	}
+	c.updates.SetState(state)
 	return nil
 }
 
+// SetAuthKeyUnregisteredHandler sets routine that is called when some request fails
+// with AUTH_KEY_UNREGISTERED. See MTProto.SetAuthKeyUnregisteredHandler.
+func (c *TGClient) SetAuthKeyUnregisteredHandler(handler func() error) {
+	c.mt.SetAuthKeyUnregisteredHandler(handler)
+}
+
+// SetAuthKeyDuplicatedHandler sets routine that is called after AUTH_KEY_DUPLICATED
+// was received and the auth key was regenerated. See MTProto.SetAuthKeyDuplicatedHandler.
+func (c *TGClient) SetAuthKeyDuplicatedHandler(handler func()) {
+	c.mt.SetAuthKeyDuplicatedHandler(handler)
+}
+
+// SetFatalAuthErrorHandler sets routine that is called when session becomes unusable
+// (revoked, expired or user deactivated). See MTProto.SetFatalAuthErrorHandler.
+func (c *TGClient) SetFatalAuthErrorHandler(handler func(err error)) {
+	c.mt.SetFatalAuthErrorHandler(handler)
+}
+
+// SetFloodWaitPolicy enables automatic FLOOD_WAIT handling (resend after wait) for all requests.
+// Should be set before the connection (file download connections copy it when created).
+func (c *TGClient) SetFloodWaitPolicy(policy *mtproto.FloodWaitPolicy) {
+	c.mt.SetFloodWaitPolicy(policy)
+}
+
+// SetTempAuthKeyTTL enables perfect forward secrecy (temporary auth keys with given lifetime,
+// mtproto.DefaultTempAuthKeyTTL is recommended). Should be set before the connection.
+func (c *TGClient) SetTempAuthKeyTTL(ttl time.Duration) {
+	c.mt.SetTempAuthKeyTTL(ttl)
+}
+
+// SetTransferRateLimiter sets limiter shared by all uploads and downloads (file parts
+// are requested not faster than it allows). Nil disables the limit. Should be set before transfers.
+// Single transfer may be limited with NewRateLimitedWriter/NewRateLimitedReader.
+func (c *TGClient) SetTransferRateLimiter(limiter *RateLimiter) {
+	c.transferLimiter = limiter
+}
+
+// Use adds request middlewares, see MTProto.Use.
+func (c *TGClient) Use(middlewares ...mtproto.Middleware) {
+	c.mt.Use(middlewares...)
+}
+
 func (c *TGClient) SendSync(msg mtproto.TLReq) mtproto.TL {
 	return c.mt.SendSync(msg)
 }
 
+// SendSyncCtx is like SendSync but returns ctx.Err() if ctx is done before the response is received.
+func (c *TGClient) SendSyncCtx(ctx context.Context, msg mtproto.TLReq) (mtproto.TL, error) {
+	res, err := c.mt.SendSyncCtx(ctx, msg)
+	return res, merry.Wrap(err)
+}
+
+// Invoke sends request and returns response or error (including RPC errors), see MTProto.Invoke.
+func (c *TGClient) Invoke(ctx context.Context, msg mtproto.TLReq) (mtproto.TL, error) {
+	res, err := c.mt.Invoke(ctx, msg)
+	return res, merry.Wrap(err)
+}
+
+// NewConnPool opens size parallel connections to the current DC for independent bulk requests,
+// see MTProto.NewConnPool. Pool should be closed when it is not needed anymore.
+func (c *TGClient) NewConnPool(size int) (*mtproto.ConnPool, error) {
+	pool, err := c.mt.NewConnPool(size)
+	return pool, merry.Wrap(err)
+}
+
+// SendAs sends request and returns response of expected type T, see mtproto.SendAs.
+func SendAs[T mtproto.TL](c *TGClient, msg mtproto.TLReq) (T, error) {
+	res, err := mtproto.SendAs[T](c.mt, msg)
+	return res, merry.Wrap(err)
+}
+
 func (c *TGClient) SendSyncRetry(
 	msg mtproto.TLReq, failRetryInterval time.Duration,
 	floodNumShortRetries int, floodMaxWait time.Duration,
 ) mtproto.TL {
 	return c.mt.SendSyncRetry(msg, failRetryInterval, floodNumShortRetries, floodMaxWait)
 }
+
+// SendSyncRetryCtx is like SendSyncRetry but returns ctx.Err() if ctx is done, see MTProto.SendSyncRetryCtx.
+func (c *TGClient) SendSyncRetryCtx(
+	ctx context.Context, msg mtproto.TLReq, failRetryInterval time.Duration,
+	floodNumShortRetries int, floodMaxWait time.Duration,
+) (mtproto.TL, error) {
+	res, err := c.mt.SendSyncRetryCtx(ctx, msg, failRetryInterval, floodNumShortRetries, floodMaxWait)
+	return res, merry.Wrap(err)
+}
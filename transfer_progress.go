@@ -0,0 +1,107 @@
+package tgclient
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// TransferProgress describes upload or download state.
+type TransferProgress struct {
+	Done    int64
+	Total   int64 // negative if unknown
+	Elapsed time.Duration
+}
+
+// Rate returns average transfer speed in bytes per second.
+func (p TransferProgress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Done) / p.Elapsed.Seconds()
+}
+
+// Remaining returns estimated time until the transfer is finished, zero if it is unknown.
+func (p TransferProgress) Remaining() time.Duration {
+	rate := p.Rate()
+	if p.Total < 0 || rate == 0 || p.Done >= p.Total {
+		return 0
+	}
+	return time.Duration(float64(p.Total-p.Done) / rate * float64(time.Second))
+}
+
+// TransferProgressHandler is called after each transferred chunk.
+// Returned error aborts the transfer (and is returned by the transfer function),
+// so it may be used to enforce time or size limits.
+type TransferProgressHandler func(TransferProgress) error
+
+type progressTracker struct {
+	mutex   sync.Mutex
+	done    int64
+	total   int64
+	startAt time.Time
+	handler TransferProgressHandler
+}
+
+func (t *progressTracker) add(n int) error {
+	t.mutex.Lock()
+	t.done += int64(n)
+	progress := TransferProgress{Done: t.done, Total: t.total, Elapsed: time.Since(t.startAt)}
+	t.mutex.Unlock()
+	return merry.Wrap(t.handler(progress))
+}
+
+type progressWriter struct {
+	w       io.Writer
+	tracker progressTracker
+}
+
+// NewProgressWriter wraps w reporting written bytes to handler. May be used with download helpers:
+//
+//	tg.DownloadFile(location, tgclient.NewProgressWriter(file, size, func(p tgclient.TransferProgress) error {
+//		fmt.Printf("%d/%d, %.0f B/s\n", p.Done, p.Total, p.Rate())
+//		return nil
+//	}))
+func NewProgressWriter(w io.Writer, total int64, handler TransferProgressHandler) io.Writer {
+	return newProgressWriter(w, total, handler)
+}
+
+func newProgressWriter(w io.Writer, total int64, handler TransferProgressHandler) *progressWriter {
+	return &progressWriter{w: w, tracker: progressTracker{total: total, handler: handler, startAt: time.Now()}}
+}
+
+func (p *progressWriter) Write(buf []byte) (int, error) {
+	n, err := p.w.Write(buf)
+	if err != nil {
+		return n, err
+	}
+	return n, p.tracker.add(n)
+}
+
+// Flush flushes underlying writer (if it supports flushing), see StreamFile.
+func (p *progressWriter) Flush() error {
+	return flushWriter(p.w)
+}
+
+type progressReader struct {
+	r       io.Reader
+	tracker progressTracker
+}
+
+// NewProgressReader wraps r reporting read bytes to handler. May be used with UploadFile.
+// Note that uploader reads data a few parts ahead of uploading it.
+func NewProgressReader(r io.Reader, total int64, handler TransferProgressHandler) io.Reader {
+	return &progressReader{r: r, tracker: progressTracker{total: total, handler: handler, startAt: time.Now()}}
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	if n > 0 {
+		if hndErr := p.tracker.add(n); hndErr != nil {
+			return n, hndErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,43 @@
+package tgclient
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestProgressWriterAbort(t *testing.T) {
+	errLimit := errors.New("limit")
+	var last TransferProgress
+	w := NewProgressWriter(io.Discard, 30, func(p TransferProgress) error {
+		last = p
+		if p.Done >= 20 {
+			return errLimit
+		}
+		return nil
+	})
+	if _, err := w.Write(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(make([]byte, 10)); !errors.Is(err, errLimit) {
+		t.Fatalf("expected limit error, got %v", err)
+	}
+	if last.Done != 20 || last.Total != 30 {
+		t.Errorf("wrong progress: %#v", last)
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	var done int64
+	r := NewProgressReader(bytes.NewReader(make([]byte, 100)), -1, func(p TransferProgress) error {
+		done = p.Done
+		return nil
+	})
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if done != 100 {
+		t.Errorf("wrong progress: %d", done)
+	}
+}
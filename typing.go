@@ -0,0 +1,78 @@
+package tgclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// chat action is shown by clients for 5-6 seconds, so it must be repeated a bit more often
+const typingRepeatInterval = 4 * time.Second
+
+// SetTyping shows chat action (SendMessageAction: TL_sendMessageTypingAction,
+// TL_sendMessageUploadDocumentAction, etc.) in peer (InputPeer or Peer) for a few seconds.
+// Nil action means typing, TL_sendMessageCancelAction hides the indicator.
+func (c *TGClient) SetTyping(peer mtproto.TL_InputPeer, action mtproto.TL_SendMessageAction) error {
+	return c.SetTypingCtx(context.Background(), peer, action)
+}
+
+// SetTypingCtx is SetTyping with context, see SendSyncCtx.
+func (c *TGClient) SetTypingCtx(ctx context.Context, peer mtproto.TL_InputPeer, action mtproto.TL_SendMessageAction) error {
+	inputPeer, err := c.toInputPeer(peer)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if action == nil {
+		action = mtproto.TL_sendMessageTypingAction{}
+	}
+	res, err := c.SendSyncCtx(ctx, mtproto.TL_messages_setTyping{Peer: inputPeer, Action: action})
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if _, ok := res.(mtproto.TL_boolTrue); !ok {
+		return merry.Wrap(mtproto.WrongRespError(res))
+	}
+	return nil
+}
+
+// KeepTyping repeats chat action (see SetTyping) until returned stop function is called,
+// which also cancels the action. Errors are only logged: indicator is not essential.
+//
+//	stop := tg.KeepTyping(peer, mtproto.TL_sendMessageUploadVideoAction{})
+//	msg, err := tg.SendVideo(peer, ...)
+//	stop()
+func (c *TGClient) KeepTyping(peer mtproto.TL_InputPeer, action mtproto.TL_SendMessageAction) (stop func()) {
+	stopChan := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			if err := c.SetTyping(peer, action); err != nil {
+				c.log.Warn("failed to set chat action: %s", err)
+			}
+			select {
+			case <-time.After(typingRepeatInterval):
+			case <-stopChan:
+				if err := c.SetTyping(peer, mtproto.TL_sendMessageCancelAction{}); err != nil {
+					c.log.Warn("failed to cancel chat action: %s", err)
+				}
+				return
+			}
+		}
+	}()
+	stopOnce := sync.Once{}
+	return func() {
+		stopOnce.Do(func() { close(stopChan) })
+		<-stopped
+	}
+}
+
+// WithTyping keeps chat action (see KeepTyping) while fn is running.
+func (c *TGClient) WithTyping(peer mtproto.TL_InputPeer, action mtproto.TL_SendMessageAction, fn func() error) error {
+	stop := c.KeepTyping(peer, action)
+	defer stop()
+	return merry.Wrap(fn())
+}
@@ -0,0 +1,168 @@
+package tgclient
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+var ErrNoUpdateState = merry.Sentinel("no update state data")
+
+// UpdateState is everything needed to resume updates stream after restart.
+type UpdateState struct {
+	PTS        int32
+	QTS        int32
+	Seq        int32
+	Date       int32
+	ChannelPTS map[int64]int32
+}
+
+func (s UpdateState) updatesState() mtproto.TL_updates_state {
+	return mtproto.TL_updates_state{PTS: s.PTS, QTS: s.QTS, Seq: s.Seq, Date: s.Date}
+}
+
+// UpdateStateStore persists UpdatesManager state. See UpdatesManager.SetStore.
+type UpdateStateStore interface {
+	Save(*UpdateState) error
+	Load(*UpdateState) error // should return ErrNoUpdateState if there is nothing saved yet
+}
+
+type UpdateStateNoopStore struct{}
+
+func (s *UpdateStateNoopStore) Save(state *UpdateState) error { return nil }
+func (s *UpdateStateNoopStore) Load(state *UpdateState) error { return merry.Wrap(ErrNoUpdateState) }
+
+// UpdateStateFileStore keeps state in a JSON file (same way as mtproto.SessFileStore).
+type UpdateStateFileStore struct {
+	FPath string
+}
+
+func (s *UpdateStateFileStore) Save(state *UpdateState) error {
+	f, err := os.Create(s.FPath + ".temp")
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(state); err != nil {
+		return merry.Wrap(err)
+	}
+	if err := f.Close(); err != nil {
+		return merry.Wrap(err)
+	}
+
+	if err := os.Rename(s.FPath+".temp", s.FPath); err != nil {
+		return merry.Wrap(err)
+	}
+	return nil
+}
+
+func (s *UpdateStateFileStore) Load(state *UpdateState) error {
+	f, err := os.Open(s.FPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return merry.Wrap(ErrNoUpdateState, merry.WithCause(err))
+	}
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(state); err != nil {
+		return merry.Wrap(err)
+	}
+	return nil
+}
+
+// UpdateStateSQLiteStore keeps state in SQLite database.
+// DB should be opened by the caller with any SQLite driver (mattn/go-sqlite3, modernc.org/sqlite, etc.),
+// tables (TablePrefix+"updates_state" and TablePrefix+"updates_channel_pts") are created on first use.
+type UpdateStateSQLiteStore struct {
+	DB          *sql.DB
+	TablePrefix string
+}
+
+func (s *UpdateStateSQLiteStore) createTables() error {
+	_, err := s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + s.TablePrefix + `updates_state (
+			id   INTEGER PRIMARY KEY CHECK (id = 0),
+			pts  INTEGER NOT NULL,
+			qts  INTEGER NOT NULL,
+			seq  INTEGER NOT NULL,
+			date INTEGER NOT NULL
+		)`)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	_, err = s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + s.TablePrefix + `updates_channel_pts (
+			channel_id INTEGER PRIMARY KEY,
+			pts        INTEGER NOT NULL
+		)`)
+	return merry.Wrap(err)
+}
+
+func (s *UpdateStateSQLiteStore) Save(state *UpdateState) error {
+	if err := s.createTables(); err != nil {
+		return merry.Wrap(err)
+	}
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO `+s.TablePrefix+`updates_state (id, pts, qts, seq, date) VALUES (0, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET pts = excluded.pts, qts = excluded.qts, seq = excluded.seq, date = excluded.date`,
+		state.PTS, state.QTS, state.Seq, state.Date)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	for channelID, pts := range state.ChannelPTS {
+		_, err = tx.Exec(`
+			INSERT INTO `+s.TablePrefix+`updates_channel_pts (channel_id, pts) VALUES (?, ?)
+			ON CONFLICT (channel_id) DO UPDATE SET pts = excluded.pts`,
+			channelID, pts)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+	}
+	return merry.Wrap(tx.Commit())
+}
+
+func (s *UpdateStateSQLiteStore) Load(state *UpdateState) error {
+	if err := s.createTables(); err != nil {
+		return merry.Wrap(err)
+	}
+	err := s.DB.QueryRow(`SELECT pts, qts, seq, date FROM `+s.TablePrefix+`updates_state WHERE id = 0`).
+		Scan(&state.PTS, &state.QTS, &state.Seq, &state.Date)
+	if errors.Is(err, sql.ErrNoRows) {
+		return merry.Wrap(ErrNoUpdateState)
+	}
+	if err != nil {
+		return merry.Wrap(err)
+	}
+
+	rows, err := s.DB.Query(`SELECT channel_id, pts FROM ` + s.TablePrefix + `updates_channel_pts`)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer rows.Close()
+	state.ChannelPTS = make(map[int64]int32)
+	for rows.Next() {
+		var channelID int64
+		var pts int32
+		if err := rows.Scan(&channelID, &pts); err != nil {
+			return merry.Wrap(err)
+		}
+		state.ChannelPTS[channelID] = pts
+	}
+	return merry.Wrap(rows.Err())
+}
@@ -0,0 +1,91 @@
+package tgclient
+
+import (
+	"sync"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+)
+
+const (
+	// DefaultUpdateWorkers is a default number of goroutines calling update handlers, see SetUpdateWorkers.
+	DefaultUpdateWorkers  = 8
+	updateWorkerQueueSize = 256
+)
+
+// updateWorkers calls update handlers in a fixed number of goroutines.
+// Updates of the same peer are always processed by the same worker, so they are handled in order.
+type updateWorkers struct {
+	queues []chan mtproto.TL
+	wg     sync.WaitGroup
+}
+
+// SetUpdateWorkers sets number of goroutines calling update handlers (DefaultUpdateWorkers by default).
+// Updates related to the same chat are handled sequentially in order of receiving,
+// updates from different chats may be handled concurrently.
+// Zero means handlers are called synchronously (so slow handler delays all other updates).
+// Should be called before InitAndConnect.
+func (c *TGClient) SetUpdateWorkers(count int) {
+	c.updateWorkersCount = count
+}
+
+func (c *TGClient) startUpdateWorkers() {
+	c.updateWorkersMutex.Lock()
+	defer c.updateWorkersMutex.Unlock()
+	if c.updateWorkers != nil || c.updateWorkersCount <= 0 {
+		return
+	}
+	w := &updateWorkers{queues: make([]chan mtproto.TL, c.updateWorkersCount)}
+	for i := range w.queues {
+		queue := make(chan mtproto.TL, updateWorkerQueueSize)
+		w.queues[i] = queue
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for update := range queue {
+				c.deliverUpdate(update)
+			}
+		}()
+	}
+	c.updateWorkers = w
+}
+
+// stopUpdateWorkers waits for already queued updates to be handled and stops workers.
+func (c *TGClient) stopUpdateWorkers() {
+	c.updateWorkersMutex.Lock()
+	w := c.updateWorkers
+	c.updateWorkers = nil
+	if w != nil {
+		for _, queue := range w.queues {
+			close(queue)
+		}
+	}
+	c.updateWorkersMutex.Unlock()
+	if w != nil {
+		w.wg.Wait()
+	}
+}
+
+func (c *TGClient) handleUpdate(update mtproto.TL) {
+	c.updateWorkersMutex.RLock()
+	defer c.updateWorkersMutex.RUnlock()
+	if c.updateWorkers == nil {
+		c.deliverUpdate(update)
+		return
+	}
+	queues := c.updateWorkers.queues
+	queues[updateWorkerIndex(update, len(queues))] <- update
+}
+
+// updateWorkerIndex selects worker by update peer. Updates without peer are handled by the first worker.
+func updateWorkerIndex(update mtproto.TL, count int) int {
+	var id int64
+	switch peer := updatePeer(update).(type) {
+	case mtproto.TL_peerUser:
+		id = peer.UserID
+	case mtproto.TL_peerChat:
+		id = peer.ChatID
+	case mtproto.TL_peerChannel:
+		id = peer.ChannelID
+	}
+	return int(uint64(id) % uint64(count))
+}
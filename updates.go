@@ -0,0 +1,522 @@
+package tgclient
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// time to wait for missing updates before requesting difference
+const updatesGapTimeout = 500 * time.Millisecond
+
+// state changes are accumulated during this interval and saved at once
+const updateStateSaveDelay = time.Second
+
+type updateCheckRes int
+
+const (
+	updateApply updateCheckRes = iota
+	updateSkip
+	updateGap
+)
+
+// UpdatesManager tracks common updates state (pts, qts, seq, date), checks incoming
+// updates for gaps and recovers missed ones with updates.getDifference.
+// Channels have their own pts, their gaps are recovered with updates.getChannelDifference.
+// Until the state is known (see SetState) updates are delivered without checks.
+// https://core.telegram.org/api/updates
+//
+// Updates are checked under the mutex but delivered (and differences are requested) without it,
+// so handlers may send requests whose responses are processed by the manager again.
+type UpdatesManager struct {
+	c        *TGClient
+	mutex    sync.Mutex
+	state    mtproto.TL_updates_state
+	hasState bool
+	pending  []mtproto.TL // updates that can not be applied yet due to gap
+	gapTimer *time.Timer
+
+	channelPTS map[int64]int32
+
+	outbox           []mtproto.TL   // checked updates waiting for delivery
+	needDiff         bool           // common difference should be requested
+	needChannelDiff  map[int64]bool // channel differences should be requested
+	syncing          bool           // some goroutine delivers outbox and requests differences
+	fetchingDiff     bool           // common difference request is in progress
+	fetchingChannels map[int64]bool // channel difference requests in progress
+	diffMutex        sync.Mutex     // serializes difference requests
+
+	store     UpdateStateStore
+	saveTimer *time.Timer
+}
+
+func newUpdatesManager(c *TGClient) *UpdatesManager {
+	return &UpdatesManager{
+		c:                c,
+		channelPTS:       make(map[int64]int32),
+		needChannelDiff:  make(map[int64]bool),
+		fetchingChannels: make(map[int64]bool),
+	}
+}
+
+// SetState sets current updates state (usually from updates.getState response).
+func (u *UpdatesManager) SetState(state mtproto.TL_updates_state) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	defer u.scheduleSaveUnlocked()
+	u.state = state
+	u.hasState = true
+	u.pending = nil
+}
+
+// SetStore sets storage for updates state and loads previously saved state from it (if any).
+// With loaded state and enabled catch-up (see TGClient.SetCatchUp) AuthAndInitEvents
+// will fetch updates missed since last run instead of starting from the current state.
+// State changes are saved with a small delay, SaveState may be used to save them immediately.
+func (u *UpdatesManager) SetStore(store UpdateStateStore) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.store = store
+	saved := UpdateState{}
+	if err := store.Load(&saved); err != nil {
+		if errors.Is(err, ErrNoUpdateState) {
+			return nil
+		}
+		return merry.Wrap(err)
+	}
+	u.state = saved.updatesState()
+	u.hasState = true
+	u.pending = nil
+	for channelID, pts := range saved.ChannelPTS {
+		u.channelPTS[channelID] = pts
+	}
+	return nil
+}
+
+// SaveState immediately saves current state to the store (if it is set).
+func (u *UpdatesManager) SaveState() error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return merry.Wrap(u.saveUnlocked())
+}
+
+func (u *UpdatesManager) saveUnlocked() error {
+	if u.saveTimer != nil {
+		u.saveTimer.Stop()
+		u.saveTimer = nil
+	}
+	if u.store == nil || !u.hasState {
+		return nil
+	}
+	state := UpdateState{
+		PTS:        u.state.PTS,
+		QTS:        u.state.QTS,
+		Seq:        u.state.Seq,
+		Date:       u.state.Date,
+		ChannelPTS: make(map[int64]int32, len(u.channelPTS)),
+	}
+	for channelID, pts := range u.channelPTS {
+		state.ChannelPTS[channelID] = pts
+	}
+	return merry.Wrap(u.store.Save(&state))
+}
+
+func (u *UpdatesManager) scheduleSaveUnlocked() {
+	if u.store == nil || u.saveTimer != nil {
+		return
+	}
+	u.saveTimer = time.AfterFunc(updateStateSaveDelay, func() {
+		if err := u.SaveState(); err != nil {
+			u.c.log.Error(err, "failed to save updates state")
+		}
+	})
+}
+
+// State returns current updates state and false if it is not known yet.
+func (u *UpdatesManager) State() (mtproto.TL_updates_state, bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.state, u.hasState
+}
+
+// Process handles Updates object (received as event or as a response to some request).
+func (u *UpdatesManager) Process(updates mtproto.TL) {
+	u.mutex.Lock()
+	if u.fetchingDiff {
+		// will be checked against the state received with difference
+		u.pending = append(u.pending, updates)
+	} else if u.processUnlocked(updates) == updateGap {
+		u.pending = append(u.pending, updates)
+		u.startGapTimerUnlocked()
+	} else {
+		u.applyPendingUnlocked()
+	}
+	u.scheduleSaveUnlocked()
+	u.mutex.Unlock()
+	u.sync()
+}
+
+// GetDifference fetches and delivers updates missed since the last known state.
+func (u *UpdatesManager) GetDifference() error {
+	err := u.fetchDifference()
+	u.sync()
+	return merry.Wrap(err)
+}
+
+// sync delivers checked updates and requests differences needed to fill gaps.
+// Only one goroutine does it at a time, others (including handlers processing
+// responses of their own requests) just add updates to the outbox and return.
+func (u *UpdatesManager) sync() {
+	u.mutex.Lock()
+	if u.syncing {
+		u.mutex.Unlock()
+		return
+	}
+	u.syncing = true
+	for {
+		if len(u.outbox) > 0 {
+			updates := u.outbox
+			u.outbox = nil
+			u.mutex.Unlock()
+			for _, update := range updates {
+				u.c.handleUpdate(update)
+			}
+			u.mutex.Lock()
+			continue
+		}
+		if channelID, ok := u.takeChannelDiffUnlocked(); ok {
+			u.mutex.Unlock()
+			if err := u.fetchChannelDifference(channelID); err != nil {
+				u.c.log.Error(err, "failed to get channel %d difference", channelID)
+			}
+			u.mutex.Lock()
+			continue
+		}
+		if u.needDiff {
+			u.needDiff = false
+			u.mutex.Unlock()
+			if err := u.fetchDifference(); err != nil {
+				u.c.log.Error(err, "failed to get updates difference")
+			}
+			u.mutex.Lock()
+			continue
+		}
+		break
+	}
+	u.syncing = false
+	u.mutex.Unlock()
+}
+
+func (u *UpdatesManager) takeChannelDiffUnlocked() (int64, bool) {
+	for channelID := range u.needChannelDiff {
+		delete(u.needChannelDiff, channelID)
+		return channelID, true
+	}
+	return 0, false
+}
+
+// deliverUnlocked adds update to the outbox, it will be passed to handlers by sync.
+func (u *UpdatesManager) deliverUnlocked(update mtproto.TL) {
+	u.outbox = append(u.outbox, update)
+}
+
+func (u *UpdatesManager) startGapTimerUnlocked() {
+	if u.gapTimer == nil {
+		u.gapTimer = time.AfterFunc(updatesGapTimeout, u.onGapTimeout)
+	}
+}
+
+func (u *UpdatesManager) onGapTimeout() {
+	u.mutex.Lock()
+	u.gapTimer = nil
+	if len(u.pending) == 0 || u.fetchingDiff {
+		u.mutex.Unlock()
+		return
+	}
+	u.c.log.Warn("updates gap was not filled in %s, getting difference", updatesGapTimeout)
+	isCommonGap := false
+	gapChannels := make(map[int64]bool)
+	for _, updates := range u.pending {
+		if short, ok := updates.(mtproto.TL_updateShort); ok {
+			if channelID, ok := updateChannelID(short.Update); ok {
+				gapChannels[channelID] = true
+				continue
+			}
+		}
+		isCommonGap = true
+	}
+	u.pending = nil
+	for channelID := range gapChannels {
+		u.needChannelDiff[channelID] = true
+	}
+	if isCommonGap {
+		u.needDiff = true
+	}
+	u.mutex.Unlock()
+	u.sync()
+}
+
+// applyPendingUnlocked retries pending updates until no more of them can be applied.
+func (u *UpdatesManager) applyPendingUnlocked() {
+	for progress := true; progress && len(u.pending) > 0; {
+		progress = false
+		remaining := u.pending[:0]
+		for _, updates := range u.pending {
+			if u.processUnlocked(updates) == updateGap {
+				remaining = append(remaining, updates)
+			} else {
+				progress = true
+			}
+		}
+		u.pending = remaining
+	}
+	if len(u.pending) == 0 && u.gapTimer != nil {
+		u.gapTimer.Stop()
+		u.gapTimer = nil
+	}
+}
+
+func (u *UpdatesManager) processUnlocked(updatesTL mtproto.TL) updateCheckRes {
+	switch updates := updatesTL.(type) {
+	case mtproto.TL_updatesTooLong:
+		// https://core.telegram.org/constructor/updatesTooLong
+		u.c.log.Warn("updates too long, getting difference")
+		u.needDiff = true
+		return updateApply
+	case mtproto.TL_updateShort:
+		res := u.processUpdateUnlocked(updates.Update)
+		if res == updateApply {
+			u.setDateUnlocked(updates.Date)
+		}
+		return res
+	case mtproto.TL_updateShortMessage:
+		return u.processPTSUpdateUnlocked(updates, updates.PTS, updates.PTSCount, updates.Date)
+	case mtproto.TL_updateShortChatMessage:
+		return u.processPTSUpdateUnlocked(updates, updates.PTS, updates.PTSCount, updates.Date)
+	case mtproto.TL_updateShortSentMessage:
+		return u.processPTSUpdateUnlocked(updates, updates.PTS, updates.PTSCount, updates.Date)
+	case mtproto.TL_updates:
+		return u.processCombinedUnlocked(updates.Updates, updates.Users, updates.Chats, updates.Date, updates.Seq, updates.Seq)
+	case mtproto.TL_updatesCombined:
+		return u.processCombinedUnlocked(updates.Updates, updates.Users, updates.Chats, updates.Date, updates.SeqStart, updates.Seq)
+	default:
+		u.c.log.Warn(mtproto.UnexpectedTL("updates", updatesTL))
+		return updateSkip
+	}
+}
+
+func (u *UpdatesManager) processCombinedUnlocked(updates, users, chats []mtproto.TL, date, seqStart, seq int32) updateCheckRes {
+	if u.hasState && seqStart != 0 {
+		if u.state.Seq+1 < seqStart {
+			return updateGap
+		}
+		if u.state.Seq+1 > seqStart {
+			return updateSkip
+		}
+	}
+	u.c.rememberEventExtraData(users)
+	u.c.rememberEventExtraData(chats)
+	for _, update := range updates {
+		if u.processUpdateUnlocked(update) == updateGap {
+			if channelID, ok := updateChannelID(update); ok {
+				// missing channel updates (including this one) will be received with channel difference
+				u.needChannelDiff[channelID] = true
+				continue
+			}
+			// remaining part of the sequence will be received with difference
+			u.needDiff = true
+			return updateApply
+		}
+	}
+	if seq != 0 {
+		u.state.Seq = seq
+	}
+	u.setDateUnlocked(date)
+	return updateApply
+}
+
+func (u *UpdatesManager) processUpdateUnlocked(update mtproto.TL) updateCheckRes {
+	if channelID, ok := updateChannelID(update); ok {
+		return u.processChannelUpdateUnlocked(channelID, update)
+	}
+	if pts, ptsCount, ok := updatePTS(update); ok {
+		return u.processPTSUpdateUnlocked(update, pts, ptsCount, 0)
+	}
+	if qts, ok := updateQTS(update); ok {
+		if u.hasState {
+			if u.state.QTS+1 < qts {
+				return updateGap
+			}
+			if u.state.QTS+1 > qts {
+				return updateSkip
+			}
+			u.state.QTS = qts
+		}
+		u.deliverUnlocked(update)
+		return updateApply
+	}
+	u.deliverUnlocked(update)
+	return updateApply
+}
+
+func (u *UpdatesManager) processPTSUpdateUnlocked(update mtproto.TL, pts, ptsCount, date int32) updateCheckRes {
+	if u.hasState {
+		if u.state.PTS+ptsCount < pts {
+			return updateGap
+		}
+		if u.state.PTS+ptsCount > pts {
+			return updateSkip
+		}
+		u.state.PTS = pts
+		u.setDateUnlocked(date)
+	}
+	u.deliverUnlocked(update)
+	return updateApply
+}
+
+// processAffectedPTS applies pts from messages.affectedHistory/affectedMessages responses:
+// such changes are not sent as updates. Channel pts is used if channelID is not zero.
+// Gap means some updates were missed, difference is requested for them.
+func (u *UpdatesManager) processAffectedPTS(channelID int64, pts, ptsCount int32) {
+	u.mutex.Lock()
+	if channelID != 0 {
+		if localPTS := u.channelPTS[channelID]; localPTS != 0 && !u.fetchingChannels[channelID] {
+			if localPTS+ptsCount < pts {
+				u.needChannelDiff[channelID] = true
+			} else if localPTS+ptsCount == pts {
+				u.channelPTS[channelID] = pts
+			}
+		}
+	} else if u.hasState && !u.fetchingDiff {
+		if u.state.PTS+ptsCount < pts {
+			u.needDiff = true
+		} else if u.state.PTS+ptsCount == pts {
+			u.state.PTS = pts
+			u.applyPendingUnlocked()
+		}
+	}
+	u.scheduleSaveUnlocked()
+	u.mutex.Unlock()
+	u.sync()
+}
+
+func (u *UpdatesManager) setDateUnlocked(date int32) {
+	if date > u.state.Date {
+		u.state.Date = date
+	}
+}
+
+// fetchDifference requests common difference (or initial state if it is unknown),
+// received updates are added to the outbox. Should be called without mutex.
+func (u *UpdatesManager) fetchDifference() error {
+	u.diffMutex.Lock()
+	defer u.diffMutex.Unlock()
+
+	u.mutex.Lock()
+	hasState := u.hasState
+	u.mutex.Unlock()
+	if !hasState {
+		res := u.c.SendSync(mtproto.TL_updates_getState{})
+		state, ok := res.(mtproto.TL_updates_state)
+		if !ok {
+			return mtproto.WrongRespError(res)
+		}
+		u.SetState(state)
+		return nil
+	}
+
+	u.mutex.Lock()
+	u.fetchingDiff = true
+	state := u.state
+	u.mutex.Unlock()
+	defer func() {
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+		defer u.scheduleSaveUnlocked()
+		u.fetchingDiff = false
+		u.applyPendingUnlocked()
+		if len(u.pending) > 0 {
+			u.startGapTimerUnlocked()
+		}
+	}()
+
+	for {
+		res := u.c.SendSync(mtproto.TL_updates_getDifference{PTS: state.PTS, Date: state.Date, QTS: state.QTS})
+		u.mutex.Lock()
+		isFinal := true
+		switch diff := res.(type) {
+		case mtproto.TL_updates_differenceEmpty:
+			u.state.Date = diff.Date
+			u.state.Seq = diff.Seq
+		case mtproto.TL_updates_difference:
+			u.deliverDifferenceUnlocked(diff.NewMessages, diff.NewEncryptedMessages, diff.OtherUpdates, diff.Users, diff.Chats)
+			u.state = diff.State
+		case mtproto.TL_updates_differenceSlice:
+			u.deliverDifferenceUnlocked(diff.NewMessages, diff.NewEncryptedMessages, diff.OtherUpdates, diff.Users, diff.Chats)
+			u.state = diff.IntermediateState
+			isFinal = false
+		case mtproto.TL_updates_differenceTooLong:
+			// https://core.telegram.org/api/updates#recovering-gaps
+			u.c.log.Warn("updates difference is too long, some updates are lost")
+			u.state.PTS = diff.PTS
+			isFinal = false
+		default:
+			u.mutex.Unlock()
+			return mtproto.WrongRespError(res)
+		}
+		state = u.state
+		u.mutex.Unlock()
+		if isFinal {
+			return nil
+		}
+	}
+}
+
+func (u *UpdatesManager) deliverDifferenceUnlocked(newMessages, newEncryptedMessages, otherUpdates, users, chats []mtproto.TL) {
+	u.c.rememberEventExtraData(users)
+	u.c.rememberEventExtraData(chats)
+	for _, msg := range newMessages {
+		u.deliverUnlocked(mtproto.TL_updateNewMessage{Message: msg})
+	}
+	for _, msg := range newEncryptedMessages {
+		u.deliverUnlocked(mtproto.TL_updateNewEncryptedMessage{Message: msg})
+	}
+	for _, update := range otherUpdates {
+		if channelID, ok := updateChannelID(update); ok {
+			// channel updates are checked against channel pts, updateChannelTooLong triggers channel difference
+			u.processChannelUpdateUnlocked(channelID, update)
+			continue
+		}
+		u.deliverUnlocked(update)
+	}
+}
+
+func updatePTS(update mtproto.TL) (int32, int32, bool) {
+	pts := updateField(update, "PTS")
+	ptsCount := updateField(update, "PTSCount")
+	if pts.Kind() != reflect.Int32 || ptsCount.Kind() != reflect.Int32 {
+		return 0, 0, false
+	}
+	return int32(pts.Int()), int32(ptsCount.Int()), true
+}
+
+func updateQTS(update mtproto.TL) (int32, bool) {
+	qts := updateField(update, "QTS")
+	if qts.Kind() != reflect.Int32 {
+		return 0, false
+	}
+	return int32(qts.Int()), true
+}
+
+func updateField(update mtproto.TL, name string) reflect.Value {
+	value := reflect.ValueOf(update)
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return value.FieldByName(name)
+}
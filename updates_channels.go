@@ -0,0 +1,164 @@
+package tgclient
+
+import (
+	"reflect"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+const channelDifferenceLimit = 100
+
+// processChannelUpdateUnlocked checks update against channel's own pts.
+// Channel pts becomes known with the first received channel update.
+// https://core.telegram.org/api/updates#channel-updates
+func (u *UpdatesManager) processChannelUpdateUnlocked(channelID int64, update mtproto.TL) updateCheckRes {
+	if tooLong, ok := update.(mtproto.TL_updateChannelTooLong); ok {
+		if tooLong.PTS != nil && u.channelPTS[channelID] == 0 {
+			u.channelPTS[channelID] = *tooLong.PTS
+		}
+		u.deliverUnlocked(update)
+		u.needChannelDiff[channelID] = true
+		return updateApply
+	}
+
+	pts, ptsCount, ok := updatePTS(update)
+	if !ok {
+		u.deliverUnlocked(update)
+		return updateApply
+	}
+	if u.fetchingChannels[channelID] {
+		// may be missing in the difference being received, so requesting it once more
+		u.needChannelDiff[channelID] = true
+		return updateApply
+	}
+	if localPTS := u.channelPTS[channelID]; localPTS != 0 {
+		if localPTS+ptsCount < pts {
+			return updateGap
+		}
+		if localPTS+ptsCount > pts {
+			return updateSkip
+		}
+	}
+	u.channelPTS[channelID] = pts
+	u.deliverUnlocked(update)
+	return updateApply
+}
+
+// GetChannelDifference fetches and delivers channel updates missed since the last known channel pts.
+func (u *UpdatesManager) GetChannelDifference(channelID int64) error {
+	err := u.fetchChannelDifference(channelID)
+	u.sync()
+	return merry.Wrap(err)
+}
+
+// fetchChannelDifference requests channel difference, received updates are added to the outbox.
+// Should be called without mutex.
+func (u *UpdatesManager) fetchChannelDifference(channelID int64) error {
+	u.diffMutex.Lock()
+	defer u.diffMutex.Unlock()
+
+	u.mutex.Lock()
+	pts := u.channelPTS[channelID]
+	u.mutex.Unlock()
+	if pts == 0 {
+		u.c.log.Warn("channel %d pts is unknown, can not get difference", channelID)
+		return nil
+	}
+	inputChannel, err := u.c.ResolveChannel(channelID)
+	if err != nil {
+		return merry.Prepend(err, "can not get difference")
+	}
+
+	u.mutex.Lock()
+	u.fetchingChannels[channelID] = true
+	u.mutex.Unlock()
+	defer func() {
+		u.mutex.Lock()
+		delete(u.fetchingChannels, channelID)
+		u.scheduleSaveUnlocked()
+		u.mutex.Unlock()
+	}()
+
+	for {
+		res := u.c.SendSync(mtproto.TL_updates_getChannelDifference{
+			Channel: inputChannel,
+			Filter:  mtproto.TL_channelMessagesFilterEmpty{},
+			PTS:     pts,
+			Limit:   channelDifferenceLimit,
+		})
+		u.mutex.Lock()
+		// timeout is a polling hint for final differences, non-final slices are requested immediately
+		isFinal := true
+		switch diff := res.(type) {
+		case mtproto.TL_updates_channelDifferenceEmpty:
+			u.channelPTS[channelID] = diff.PTS
+		case mtproto.TL_updates_channelDifference:
+			u.c.rememberEventExtraData(diff.Users)
+			u.c.rememberEventExtraData(diff.Chats)
+			for _, msg := range diff.NewMessages {
+				u.deliverUnlocked(mtproto.TL_updateNewChannelMessage{Message: msg})
+			}
+			for _, update := range diff.OtherUpdates {
+				u.deliverUnlocked(update)
+			}
+			u.channelPTS[channelID] = diff.PTS
+			isFinal = diff.Final
+		case mtproto.TL_updates_channelDifferenceTooLong:
+			// https://core.telegram.org/constructor/updates.channelDifferenceTooLong
+			u.c.log.Warn("channel %d difference is too long, some updates are lost", channelID)
+			u.c.rememberEventExtraData(diff.Users)
+			u.c.rememberEventExtraData(diff.Chats)
+			for _, msg := range diff.Messages {
+				u.deliverUnlocked(mtproto.TL_updateNewChannelMessage{Message: msg})
+			}
+			if dialog, ok := diff.Dialog.(mtproto.TL_dialog); ok && dialog.PTS != nil {
+				u.channelPTS[channelID] = *dialog.PTS
+			}
+			isFinal = diff.Final
+		default:
+			u.mutex.Unlock()
+			return mtproto.WrongRespError(res)
+		}
+		prevPTS := pts
+		pts = u.channelPTS[channelID]
+		u.mutex.Unlock()
+		if isFinal {
+			return nil
+		}
+		if pts == prevPTS {
+			return merry.Errorf("channel %d difference is not final but pts %d did not change", channelID, pts)
+		}
+	}
+}
+
+// updateChannelID returns channel ID for channel updates (that have channel's own pts).
+func updateChannelID(update mtproto.TL) (int64, bool) {
+	switch x := update.(type) {
+	case mtproto.TL_updateNewChannelMessage:
+		return messageChannelID(x.Message)
+	case mtproto.TL_updateEditChannelMessage:
+		return messageChannelID(x.Message)
+	case mtproto.TL_updateChannelTooLong:
+		return x.ChannelID, true
+	}
+	// some updates (like updateChannelParticipant) have ChannelID but use common qts
+	if _, _, ok := updatePTS(update); !ok {
+		return 0, false
+	}
+	if channelID := updateField(update, "ChannelID"); channelID.Kind() == reflect.Int64 {
+		return channelID.Int(), true
+	}
+	return 0, false
+}
+
+func messageChannelID(msg mtproto.TL) (int64, bool) {
+	peerID := updateField(msg, "PeerID")
+	if !peerID.IsValid() || peerID.IsNil() {
+		return 0, false
+	}
+	if peer, ok := peerID.Interface().(mtproto.TL_peerChannel); ok {
+		return peer.ChannelID, true
+	}
+	return 0, false
+}
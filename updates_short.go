@@ -0,0 +1,86 @@
+package tgclient
+
+import (
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+// expandShortUpdate converts updateShortMessage and updateShortChatMessage to updateNewMessage
+// with full TL_message, so handlers do not have to deal with short forms.
+// Sender and chat (if not known yet) are fetched and remembered as extra data.
+// https://core.telegram.org/api/updates#updates-sequence
+func (c *TGClient) expandShortUpdate(update mtproto.TL) mtproto.TL {
+	switch upd := update.(type) {
+	case mtproto.TL_updateShortMessage:
+		// Private chat sender can not be fetched without access hash (which is absent in short update),
+		// so unknown users are left as is: they may be received later with other updates.
+		return mtproto.TL_updateNewMessage{
+			Message: mtproto.TL_message{
+				Out:         upd.Out,
+				Mentioned:   upd.Mentioned,
+				MediaUnread: upd.MediaUnread,
+				Silent:      upd.Silent,
+				ID:          upd.ID,
+				PeerID:      mtproto.TL_peerUser{UserID: upd.UserID},
+				FwdFrom:     upd.FwdFrom,
+				ViaBotID:    upd.ViaBotID,
+				ReplyTo:     upd.ReplyTo,
+				Date:        upd.Date,
+				Message:     upd.Message,
+				Entities:    upd.Entities,
+				TTLPeriod:   upd.TTLPeriod,
+			},
+			PTS:      upd.PTS,
+			PTSCount: upd.PTSCount,
+		}
+	case mtproto.TL_updateShortChatMessage:
+		if err := c.fetchShortChatMessageExtra(upd); err != nil {
+			c.log.Error(err, "failed to fetch chat message sender or chat")
+		}
+		return mtproto.TL_updateNewMessage{
+			Message: mtproto.TL_message{
+				Out:         upd.Out,
+				Mentioned:   upd.Mentioned,
+				MediaUnread: upd.MediaUnread,
+				Silent:      upd.Silent,
+				ID:          upd.ID,
+				FromID:      mtproto.TL_peerUser{UserID: upd.FromID},
+				PeerID:      mtproto.TL_peerChat{ChatID: upd.ChatID},
+				FwdFrom:     upd.FwdFrom,
+				ViaBotID:    upd.ViaBotID,
+				ReplyTo:     upd.ReplyTo,
+				Date:        upd.Date,
+				Message:     upd.Message,
+				Entities:    upd.Entities,
+				TTLPeriod:   upd.TTLPeriod,
+			},
+			PTS:      upd.PTS,
+			PTSCount: upd.PTSCount,
+		}
+	}
+	return update
+}
+
+func (c *TGClient) fetchShortChatMessageExtra(upd mtproto.TL_updateShortChatMessage) error {
+	if c.FindExtraChat(upd.ChatID) == nil {
+		res := c.SendSync(mtproto.TL_messages_getChats{ID: []int64{upd.ChatID}})
+		chats, ok := res.(mtproto.TL_messages_chats)
+		if !ok {
+			return merry.Wrap(mtproto.WrongRespError(res))
+		}
+		c.rememberEventExtraData(chats.Chats)
+	}
+	if c.FindExtraUser(upd.FromID) == nil {
+		res := c.SendSync(mtproto.TL_users_getUsers{ID: []mtproto.TL{mtproto.TL_inputUserFromMessage{
+			Peer:   mtproto.TL_inputPeerChat{ChatID: upd.ChatID},
+			MsgID:  upd.ID,
+			UserID: upd.FromID,
+		}}})
+		users, ok := res.(mtproto.VectorObject)
+		if !ok {
+			return merry.Wrap(mtproto.WrongRespError(res))
+		}
+		c.rememberEventExtraData(users)
+	}
+	return nil
+}
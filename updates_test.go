@@ -0,0 +1,164 @@
+package tgclient
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+)
+
+func TestUpdatesManagerPTSOrder(t *testing.T) {
+	var received []int32
+	c := &TGClient{log: mtproto.Logger{Hnd: mtproto.NoopLogHandler{}}, dispatcher: newDispatcher()}
+	c.SetUpdateHandler(func(update mtproto.TL) {
+		// short messages are delivered expanded
+		received = append(received, update.(mtproto.TL_updateNewMessage).Message.(mtproto.TL_message).ID)
+	})
+	u := newUpdatesManager(c)
+	u.SetState(mtproto.TL_updates_state{PTS: 10})
+
+	msg := func(id, pts int32) mtproto.TL {
+		return mtproto.TL_updateShortMessage{ID: id, PTS: pts, PTSCount: 1}
+	}
+	u.Process(msg(1, 11))
+	u.Process(msg(3, 13)) // gap, should wait for #2
+	u.Process(msg(1, 11)) // duplicate, should be skipped
+	u.Process(msg(2, 12)) // fills the gap
+
+	if !reflect.DeepEqual(received, []int32{1, 2, 3}) {
+		t.Errorf("wrong updates order: %v", received)
+	}
+	if state, _ := u.State(); state.PTS != 13 {
+		t.Errorf("wrong pts: %d", state.PTS)
+	}
+	if len(u.pending) != 0 || u.gapTimer != nil {
+		t.Errorf("pending updates should be applied")
+	}
+}
+
+func TestUpdatesManagerReentrantProcess(t *testing.T) {
+	var received []int32
+	c := &TGClient{log: mtproto.Logger{Hnd: mtproto.NoopLogHandler{}}, dispatcher: newDispatcher()}
+	u := newUpdatesManager(c)
+	c.SetUpdateHandler(func(update mtproto.TL) {
+		newMsg, ok := update.(mtproto.TL_updateNewMessage)
+		if !ok {
+			return
+		}
+		id := newMsg.Message.(mtproto.TL_message).ID
+		received = append(received, id)
+		if id == 1 {
+			// like a response to a message sent from the handler
+			u.Process(mtproto.TL_updateShortSentMessage{ID: 2, PTS: 12, PTSCount: 1})
+		}
+	})
+	u.SetState(mtproto.TL_updates_state{PTS: 10})
+
+	done := make(chan struct{})
+	go func() {
+		u.Process(mtproto.TL_updateShortMessage{ID: 1, PTS: 11, PTSCount: 1})
+		u.Process(mtproto.TL_updateShortMessage{ID: 3, PTS: 13, PTSCount: 1})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("deadlock: handler is called under updates manager mutex")
+	}
+	if state, _ := u.State(); state.PTS != 13 {
+		t.Errorf("wrong pts: %d", state.PTS)
+	}
+	if !reflect.DeepEqual(received, []int32{1, 3}) {
+		t.Errorf("wrong updates: %v", received)
+	}
+}
+
+func TestUpdatesManagerChannelPTS(t *testing.T) {
+	var received []int32
+	c := &TGClient{log: mtproto.Logger{Hnd: mtproto.NoopLogHandler{}}, dispatcher: newDispatcher()}
+	c.SetUpdateHandler(func(update mtproto.TL) {
+		received = append(received, update.(mtproto.TL_updateDeleteChannelMessages).PTS)
+	})
+	u := newUpdatesManager(c)
+	u.SetState(mtproto.TL_updates_state{PTS: 10})
+
+	del := func(channelID int64, pts int32) mtproto.TL {
+		return mtproto.TL_updateShort{Update: mtproto.TL_updateDeleteChannelMessages{ChannelID: channelID, PTS: pts, PTSCount: 1}}
+	}
+	u.Process(del(1, 100)) // first update for channel, pts is accepted
+	u.Process(del(2, 5))   // other channel, independent pts
+	u.Process(del(1, 100)) // duplicate, should be skipped
+	u.Process(del(1, 101))
+
+	if !reflect.DeepEqual(received, []int32{100, 5, 101}) {
+		t.Errorf("wrong updates: %v", received)
+	}
+	if u.channelPTS[1] != 101 || u.channelPTS[2] != 5 {
+		t.Errorf("wrong channel pts: %v", u.channelPTS)
+	}
+	if state, _ := u.State(); state.PTS != 10 {
+		t.Errorf("common pts should not change: %d", state.PTS)
+	}
+}
+
+func TestUpdatesManagerAffectedPTS(t *testing.T) {
+	var received []int32
+	c := &TGClient{log: mtproto.Logger{Hnd: mtproto.NoopLogHandler{}}, dispatcher: newDispatcher()}
+	c.SetUpdateHandler(func(update mtproto.TL) {
+		received = append(received, update.(mtproto.TL_updateNewMessage).Message.(mtproto.TL_message).ID)
+	})
+	u := newUpdatesManager(c)
+	u.SetState(mtproto.TL_updates_state{PTS: 10})
+	u.channelPTS[1] = 100
+
+	u.Process(mtproto.TL_updateShortMessage{ID: 1, PTS: 17, PTSCount: 1}) // waits for the deletion
+	u.processAffectedPTS(0, 16, 6)                                        // like deleteHistory response
+	u.processAffectedPTS(1, 103, 3)                                       // channel history
+
+	if state, _ := u.State(); state.PTS != 17 {
+		t.Errorf("wrong pts: %d", state.PTS)
+	}
+	if !reflect.DeepEqual(received, []int32{1}) {
+		t.Errorf("pending update was not applied: %v", received)
+	}
+	if u.channelPTS[1] != 103 {
+		t.Errorf("wrong channel pts: %d", u.channelPTS[1])
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.gapTimer != nil {
+		u.gapTimer.Stop()
+		t.Errorf("gap timer should be stopped")
+	}
+}
+
+func TestUpdateStateFileStore(t *testing.T) {
+	store := &UpdateStateFileStore{FPath: t.TempDir() + "/updates.json"}
+	if err := store.Load(&UpdateState{}); !errors.Is(err, ErrNoUpdateState) {
+		t.Fatalf("expected ErrNoUpdateState, got %v", err)
+	}
+
+	c := &TGClient{log: mtproto.Logger{Hnd: mtproto.NoopLogHandler{}}, dispatcher: newDispatcher()}
+	u := newUpdatesManager(c)
+	if err := u.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	u.SetState(mtproto.TL_updates_state{PTS: 10, QTS: 2, Seq: 3, Date: 4})
+	u.channelPTS[1] = 100
+	if err := u.SaveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	u = newUpdatesManager(c)
+	if err := u.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if state, ok := u.State(); !ok || state != (mtproto.TL_updates_state{PTS: 10, QTS: 2, Seq: 3, Date: 4}) {
+		t.Errorf("wrong restored state: %v %#v", ok, state)
+	}
+	if u.channelPTS[1] != 100 {
+		t.Errorf("wrong restored channel pts: %v", u.channelPTS)
+	}
+}
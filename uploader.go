@@ -0,0 +1,235 @@
+package tgclient
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"hash"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/3bl3gamer/tgclient/mtproto"
+	"github.com/ansel1/merry/v2"
+)
+
+const (
+	uploadPartSize = 512 * 1024
+	// files larger than this must be uploaded with upload.saveBigFilePart
+	bigFileMinSize = 10 * 1024 * 1024
+	// DefaultUploadParallelism is a default number of parts uploaded simultaneously, see SetUploadParallelism.
+	DefaultUploadParallelism = 4
+)
+
+type uploadPart struct {
+	num        int32
+	data       []byte
+	totalParts int32 // for saveBigFilePart, -1 if still unknown
+}
+
+// uploadPartsReader splits data into parts reading one part ahead, so the last part is known.
+type uploadPartsReader struct {
+	data  io.Reader
+	hash  hash.Hash
+	num   int32
+	ahead *uploadPart
+}
+
+// readPart returns nil if data has ended exactly at the previous part end.
+func (r *uploadPartsReader) readPart() (*uploadPart, error) {
+	buf := make([]byte, uploadPartSize)
+	n, err := io.ReadFull(r.data, buf)
+	if err == io.EOF && r.num > 0 {
+		return nil, nil
+	}
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, merry.Wrap(err)
+	}
+	r.hash.Write(buf[:n])
+	part := &uploadPart{num: r.num, data: buf[:n]}
+	r.num += 1
+	return part, nil
+}
+
+// next returns next part and true if it is the last one. Should not be called after the last part.
+func (r *uploadPartsReader) next() (*uploadPart, bool, error) {
+	part := r.ahead
+	r.ahead = nil
+	if part == nil {
+		var err error
+		if part, err = r.readPart(); err != nil {
+			return nil, false, merry.Wrap(err)
+		}
+		if part == nil {
+			return nil, false, merry.New("no more parts")
+		}
+	}
+	if len(part.data) < uploadPartSize {
+		return part, true, nil
+	}
+	ahead, err := r.readPart()
+	if err != nil {
+		return nil, false, merry.Wrap(err)
+	}
+	r.ahead = ahead
+	return part, ahead == nil, nil
+}
+
+// SetUploadParallelism sets number of file parts uploaded simultaneously by UploadFile
+// (DefaultUploadParallelism by default).
+func (c *TGClient) SetUploadParallelism(count int) {
+	c.uploadParallelism = count
+}
+
+// UploadFile uploads data and returns InputFile which may be used in TL_inputMediaUploadedDocument and similar:
+// TL_inputFile (uploaded via upload.saveFilePart) or TL_inputFileBig (via upload.saveBigFilePart)
+// for files larger than 10MB. Parts are uploaded concurrently while data is being read,
+// so data may be streamed from network or from a transcoder without saving it to disk.
+//
+// Size may be negative if it is unknown. In that case first 10MB are buffered to choose
+// the upload method, big files are then uploaded with unknown total parts count.
+func (c *TGClient) UploadFile(data io.Reader, size int64, name string) (mtproto.TL_InputFile, error) {
+	return c.UploadFileCtx(context.Background(), data, size, name)
+}
+
+// UploadFileCtx is UploadFile with context, see SendSyncCtx.
+func (c *TGClient) UploadFileCtx(ctx context.Context, data io.Reader, size int64, name string) (mtproto.TL_InputFile, error) {
+	fileID := rand.Int63()
+	reader := &uploadPartsReader{data: data, hash: md5.New()}
+
+	var head []*uploadPart
+	headIsAll := false
+	isBig := size > bigFileMinSize
+	totalParts := int32((size + uploadPartSize - 1) / uploadPartSize)
+	if size < 0 {
+		// reading a bit more than bigFileMinSize to check whether file is big
+		for !headIsAll && len(head)*uploadPartSize <= bigFileMinSize {
+			part, isLast, err := reader.next()
+			if err != nil {
+				return nil, merry.Wrap(err)
+			}
+			head = append(head, part)
+			headIsAll = isLast
+		}
+		isBig = !headIsAll
+		totalParts = -1
+		if headIsAll {
+			totalParts = int32(len(head))
+		}
+	}
+
+	parts := make(chan *uploadPart)
+	parallelism := c.uploadParallelism
+	if parallelism <= 0 {
+		parallelism = DefaultUploadParallelism
+	}
+	errs := make(chan error, parallelism)
+	done := make(chan struct{})
+	doneOnce := sync.Once{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range parts {
+				if err := c.uploadPart(ctx, fileID, part, isBig); err != nil {
+					errs <- err
+					doneOnce.Do(func() { close(done) })
+					return
+				}
+			}
+		}()
+	}
+
+	partsCount, err := sendUploadParts(reader, head, headIsAll, totalParts, parts, done)
+	close(parts)
+	wg.Wait()
+	select {
+	case uploadErr := <-errs:
+		return nil, merry.Wrap(uploadErr)
+	default:
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if totalParts >= 0 && partsCount != totalParts {
+		return nil, merry.Errorf("expected %d parts of %d bytes, got %d", totalParts, size, partsCount)
+	}
+
+	if isBig {
+		return mtproto.TL_inputFileBig{ID: fileID, Parts: partsCount, Name: name}, nil
+	}
+	return mtproto.TL_inputFile{
+		ID:          fileID,
+		Parts:       partsCount,
+		Name:        name,
+		MD5Checksum: hex.EncodeToString(reader.hash.Sum(nil)),
+	}, nil
+}
+
+// sendUploadParts passes already read head parts and then the rest of the data to uploaders
+// until the last part or done. Returns total number of parts.
+func sendUploadParts(
+	reader *uploadPartsReader, head []*uploadPart, headIsAll bool, totalParts int32,
+	parts chan *uploadPart, done chan struct{},
+) (int32, error) {
+	send := func(part *uploadPart, isLast bool) bool {
+		part.totalParts = totalParts
+		if isLast {
+			// when total parts count is unknown, it must be specified in the last part
+			part.totalParts = part.num + 1
+		}
+		select {
+		case parts <- part:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	for i, part := range head {
+		if !send(part, headIsAll && i == len(head)-1) {
+			return reader.num, nil
+		}
+	}
+	for isLast := headIsAll; !isLast; {
+		var part *uploadPart
+		var err error
+		part, isLast, err = reader.next()
+		if err != nil {
+			return reader.num, merry.Wrap(err)
+		}
+		if !send(part, isLast) {
+			break
+		}
+	}
+	return reader.num, nil
+}
+
+func (c *TGClient) uploadPart(ctx context.Context, fileID int64, part *uploadPart, isBig bool) error {
+	var req mtproto.TLReq
+	if isBig {
+		req = mtproto.TL_upload_saveBigFilePart{
+			FileID:         fileID,
+			FilePart:       part.num,
+			FileTotalParts: part.totalParts,
+			Bytes:          part.data,
+		}
+	} else {
+		req = mtproto.TL_upload_saveFilePart{
+			FileID:   fileID,
+			FilePart: part.num,
+			Bytes:    part.data,
+		}
+	}
+	c.transferLimiter.Wait(len(part.data))
+	res, err := c.SendSyncRetryCtx(ctx, req, 2*time.Second, 5, 10*time.Second)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if _, ok := res.(mtproto.TL_boolTrue); !ok {
+		return mtproto.WrongRespError(res)
+	}
+	return nil
+}
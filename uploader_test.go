@@ -0,0 +1,31 @@
+package tgclient
+
+import (
+	"bytes"
+	"crypto/md5"
+	"testing"
+)
+
+func TestUploadPartsReader(t *testing.T) {
+	for _, size := range []int{0, 1, uploadPartSize, uploadPartSize + 1, uploadPartSize * 3} {
+		reader := &uploadPartsReader{data: bytes.NewReader(make([]byte, size)), hash: md5.New()}
+		total := 0
+		for {
+			part, isLast, err := reader.next()
+			if err != nil {
+				t.Fatalf("size %d: %s", size, err)
+			}
+			total += len(part.data)
+			if isLast {
+				break
+			}
+		}
+		expectedParts := int32((size + uploadPartSize - 1) / uploadPartSize)
+		if expectedParts == 0 {
+			expectedParts = 1 // empty file is uploaded as one empty part
+		}
+		if total != size || reader.num != expectedParts {
+			t.Errorf("size %d: got %d bytes in %d parts", size, total, reader.num)
+		}
+	}
+}